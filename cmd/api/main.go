@@ -8,13 +8,20 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/rafrdz/ctrl-alt-me/internal/certs"
 	"github.com/rafrdz/ctrl-alt-me/internal/database"
+	"github.com/rafrdz/ctrl-alt-me/internal/inbox"
+	"github.com/rafrdz/ctrl-alt-me/internal/notify"
 	"github.com/rafrdz/ctrl-alt-me/internal/server"
 	"github.com/rafrdz/ctrl-alt-me/internal/service"
+	"github.com/rafrdz/ctrl-alt-me/internal/storage"
 )
 
 const (
@@ -22,13 +29,56 @@ const (
 	DefaultFrontendPort = "5173"
 	DefaultDatabaseName = "job_applications.db"
 	DefaultFrontendHost = "localhost"
+
+	DefaultTrashRetentionDays = 30
+	TrashPurgeInterval        = time.Hour
+	TextExtractionInterval    = time.Minute
+	WebhookDispatchInterval   = 10 * time.Second
+
+	DefaultSMTPPort          = 587
+	DefaultFollowUpAfterDays = 14
+	NotifyInterval           = 15 * time.Minute
+	InboxPollInterval        = time.Minute
+)
+
+var (
+	AttachmentsDir = filepath.Join("data", "attachments")
+
+	DefaultSelfSignedCertFile = filepath.Join("data", "tls", "cert.pem")
+	DefaultSelfSignedKeyFile  = filepath.Join("data", "tls", "key.pem")
 )
 
 type Config struct {
-	Port         string
-	FrontendPort string
-	DatabaseName string
-	FrontendHost string
+	Port             string
+	FrontendPort     string
+	DatabaseName     string
+	FrontendHost     string
+	FrontendScheme   string
+	CORSOrigins      []string
+	CORSCredentials  bool
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSSelfSigned    bool
+	TLSHosts         []string
+	HTTPRedirectPort string
+	TrashRetention   time.Duration
+	UndoDepth        int
+	// AttachmentMaxSize is the largest accepted upload in bytes
+	AttachmentMaxSize int64
+	// SMTP is where email notifications are sent through, they are off without a host
+	SMTP notify.SMTPConfig
+	// Ntfy and Gotify receive push notifications, they are off without a URL
+	Ntfy              notify.NtfyConfig
+	Gotify            notify.GotifyConfig
+	Notify            notify.Config
+	NotifyTemplateDir string
+	// InboxPath is a maildir or mbox file incoming email is filed from, if set
+	InboxPath string
+}
+
+// TLSEnabled reports whether the server should be served over HTTPS
+func (c *Config) TLSEnabled() bool {
+	return c.TLSSelfSigned || (c.TLSCertFile != "" && c.TLSKeyFile != "")
 }
 
 func main() {
@@ -38,7 +88,15 @@ func main() {
 
 	// Load environment variables
 	config := createConfig(logger)
-	logger.Debug("Environment variables loaded", "port", config.Port, "frontendPort", config.FrontendPort, "frontendHost", config.FrontendHost, "databaseName", config.DatabaseName)
+	logger.Debug("Environment variables loaded", "port", config.Port, "frontendPort", config.FrontendPort, "frontendHost", config.FrontendHost, "frontendScheme", config.FrontendScheme, "corsOrigins", config.CORSOrigins, "databaseName", config.DatabaseName, "tls", config.TLSEnabled(), "httpRedirectPort", config.HTTPRedirectPort)
+
+	// Generate (or reuse) the self-signed certificate before anything else is started
+	if config.TLSSelfSigned {
+		if err := certs.EnsureSelfSigned(config.TLSCertFile, config.TLSKeyFile, config.TLSHosts, logger); err != nil {
+			logger.Error("Failed to prepare self-signed certificate", "error", err)
+			os.Exit(1)
+		}
+	}
 
 	// Open connection to the database, this will be closed during graceful shutdown
 	db, err := database.InitDB(config.DatabaseName, logger)
@@ -48,34 +106,110 @@ func main() {
 	}
 
 	appService := service.NewJobApplicationService(db, logger)
+	appService.SetUndoDepth(config.UndoDepth)
+
+	attachments, err := storage.NewStore(AttachmentsDir, config.AttachmentMaxSize)
+	if err != nil {
+		logger.Error("Failed to initialize attachment storage", "error", err)
+		os.Exit(1)
+	}
+	appService.SetAttachmentStore(attachments)
 	logger.Info("Application service initialized")
 
 	// Set up the httpServer
-	handler := server.NewHTTPHandler(appService, logger, config.FrontendHost, config.FrontendPort)
+	cors := server.CORSConfig{
+		AllowedOrigins:   config.CORSOrigins,
+		AllowCredentials: config.CORSCredentials,
+	}
+	if err := cors.Validate(); err != nil {
+		logger.Error("Invalid CORS configuration", "error", err)
+		os.Exit(1)
+	}
+	handler := server.NewHTTPHandler(appService, logger, cors)
+	// The event stream lifts the write timeout for its own connections, see server.handleEvents
 	httpServer := &http.Server{
 		Addr:         ":" + config.Port,
 		Handler:      handler,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 5 * time.Second,
 	}
+	// Shutdown waits for every request to finish, which the event streams never would on their own
+	httpServer.RegisterOnShutdown(appService.CloseEventStreams)
 
 	// Start the HTTP httpServer and listen for termination signals
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Permanently remove applications that have been in the trash for longer than the retention period
+	if config.TrashRetention > 0 {
+		go appService.RunTrashPurger(ctx, config.TrashRetention, TrashPurgeInterval)
+	}
+
+	// Extract the text of uploaded attachments in the background so they can be searched
+	go appService.RunTextExtractor(ctx, TextExtractionInterval)
+
+	// Send webhook deliveries as changes are made and retry failed ones
+	go appService.RunWebhookDispatcher(ctx, WebhookDispatchInterval)
+
+	// Send follow-up reminders and digests over every configured channel, and reminders to webhooks
+	notifiers, err := createNotifiers(config)
+	if err != nil {
+		logger.Error("Failed to configure notifications", "error", err)
+		os.Exit(1)
+	}
+	if len(notifiers) > 0 || config.Notify.FollowUpAfterDays > 0 {
+		runner := notify.NewRunner(appService, notifiers, notify.NewTemplates(config.NotifyTemplateDir), config.Notify, logger)
+		go runner.Run(ctx)
+	}
+
+	// File the email that arrives in the inbox with the applications it is about
+	if config.InboxPath != "" {
+		source, err := inbox.Open(config.InboxPath, attachments.MaxSize(), logger)
+		if err != nil {
+			logger.Error("Failed to open inbox", "path", config.InboxPath, "error", err)
+			os.Exit(1)
+		}
+		go inbox.NewWatcher(appService, source, logger).Run(ctx, InboxPollInterval)
+	}
+
 	// Channel to communicate server startup errors
-	serverErrors := make(chan error, 1)
+	serverErrors := make(chan error, 2)
 
 	go func() {
-		logger.Info("Starting HTTP server", "addr", httpServer.Addr)
-		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		var err error
+		if config.TLSEnabled() {
+			logger.Info("Starting HTTPS server", "addr", httpServer.Addr, "cert", config.TLSCertFile)
+			err = httpServer.ListenAndServeTLS(config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			logger.Info("Starting HTTP server", "addr", httpServer.Addr)
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
 			logger.Error("Failed to start HTTP server", "error", err)
 			serverErrors <- err
 		}
 	}()
 
+	// Optionally redirect plain HTTP traffic to the HTTPS listener
+	var redirectServer *http.Server
+	if config.TLSEnabled() && config.HTTPRedirectPort != "" {
+		redirectServer = &http.Server{
+			Addr:         ":" + config.HTTPRedirectPort,
+			Handler:      server.NewRedirectHandler(config.Port, logger),
+			ReadTimeout:  5 * time.Second,
+			WriteTimeout: 5 * time.Second,
+		}
+		go func() {
+			logger.Info("Starting HTTP to HTTPS redirect server", "addr", redirectServer.Addr)
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Failed to start redirect server", "error", err)
+				serverErrors <- err
+			}
+		}()
+	}
+
 	time.Sleep(100 * time.Millisecond)
-	logger.Info("HTTP server started successfully", "port", config.Port)
+	logger.Info("HTTP server started successfully", "port", config.Port, "tls", config.TLSEnabled())
 
 	// Wait for either shutdown signal or server error
 	select {
@@ -94,6 +228,13 @@ func main() {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if redirectServer != nil {
+		logger.Info("Shutting down redirect server...")
+		if err := redirectServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Error during redirect server shutdown", "error", err)
+		}
+	}
+
 	logger.Info("Shutting down HTTP server...")
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
 		logger.Error("Error during HTTP server shutdown", "error", err)
@@ -122,12 +263,112 @@ func createConfig(logger *slog.Logger) *Config {
 		logger.Error("Error loading .env file, using env or default values")
 	}
 
-	return &Config{
-		Port:         getEnvDefault("BACKEND_PORT", DefaultBackendPort),
-		FrontendPort: getEnvDefault("FRONTEND_PORT", DefaultFrontendPort),
-		DatabaseName: getEnvDefault("DATABASE_NAME", DefaultDatabaseName),
-		FrontendHost: getEnvDefault("FRONTEND_HOST", DefaultFrontendHost),
+	config := &Config{
+		Port:              getEnvDefault("BACKEND_PORT", DefaultBackendPort),
+		FrontendPort:      getEnvDefault("FRONTEND_PORT", DefaultFrontendPort),
+		DatabaseName:      getEnvDefault("DATABASE_NAME", DefaultDatabaseName),
+		FrontendHost:      getEnvDefault("FRONTEND_HOST", DefaultFrontendHost),
+		CORSOrigins:       getEnvList("CORS_ALLOWED_ORIGINS"),
+		CORSCredentials:   getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		TLSCertFile:       os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:        os.Getenv("TLS_KEY_FILE"),
+		TLSSelfSigned:     getEnvBool("TLS_SELF_SIGNED", false),
+		HTTPRedirectPort:  os.Getenv("HTTP_REDIRECT_PORT"),
+		TrashRetention:    time.Duration(getEnvInt("TRASH_RETENTION_DAYS", DefaultTrashRetentionDays)) * 24 * time.Hour,
+		UndoDepth:         getEnvInt("UNDO_HISTORY_DEPTH", service.DefaultUndoDepth),
+		AttachmentMaxSize: int64(getEnvInt("ATTACHMENT_MAX_SIZE_MB", service.DefaultMaxAttachmentSize>>20)) << 20,
+	}
+
+	if !config.TLSSelfSigned && (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		// Serving plain HTTP when HTTPS was asked for would go unnoticed
+		logger.Error("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		os.Exit(1)
+	}
+	if config.TLSSelfSigned {
+		// A generated certificate would replace the configured one, so don't guess which is meant
+		if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+			logger.Error("TLS_SELF_SIGNED cannot be combined with TLS_CERT_FILE or TLS_KEY_FILE, set one or the other")
+			os.Exit(1)
+		}
+		config.TLSCertFile = DefaultSelfSignedCertFile
+		config.TLSKeyFile = DefaultSelfSignedKeyFile
+		// Always cover the local machine, plus the configured frontend host and any extra hosts
+		config.TLSHosts = append(certs.LocalHosts(), config.FrontendHost)
+		config.TLSHosts = append(config.TLSHosts, getEnvList("TLS_HOSTS")...)
+	}
+
+	// The frontend is served from the same origin when TLS is on, so default to a matching scheme
+	defaultScheme := "http"
+	if config.TLSEnabled() {
+		defaultScheme = "https"
+	}
+	config.FrontendScheme = getEnvDefault("FRONTEND_SCHEME", defaultScheme)
+
+	config.SMTP = notify.SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     getEnvInt("SMTP_PORT", DefaultSMTPPort),
+		Security: strings.ToLower(getEnvDefault("SMTP_SECURITY", notify.SecurityStartTLS)),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		To:       getEnvList("SMTP_TO"),
+	}
+	config.Ntfy = notify.NtfyConfig{
+		URL:      os.Getenv("NTFY_URL"),
+		Token:    os.Getenv("NTFY_TOKEN"),
+		Priority: getEnvInt("NTFY_PRIORITY", 0),
+	}
+	config.Gotify = notify.GotifyConfig{
+		URL:      os.Getenv("GOTIFY_URL"),
+		Token:    os.Getenv("GOTIFY_TOKEN"),
+		Priority: getEnvInt("GOTIFY_PRIORITY", 0),
+	}
+	config.Notify = notify.Config{
+		FollowUpAfterDays: getEnvInt("NOTIFY_FOLLOW_UP_DAYS", DefaultFollowUpAfterDays),
+		Digest:            strings.ToLower(os.Getenv("NOTIFY_DIGEST")),
+		BaseURL:           config.FrontendScheme + "://" + config.FrontendHost + ":" + config.FrontendPort,
+		Interval:          NotifyInterval,
+	}
+	config.NotifyTemplateDir = os.Getenv("NOTIFY_TEMPLATE_DIR")
+	config.InboxPath = os.Getenv("INBOX_PATH")
+
+	// Without an explicit allow-list only the configured frontend may call the API
+	if len(config.CORSOrigins) == 0 {
+		config.CORSOrigins = []string{config.FrontendScheme + "://" + config.FrontendHost + ":" + config.FrontendPort}
+	}
+
+	return config
+}
+
+// createNotifiers returns a notifier for every configured channel
+func createNotifiers(config *Config) ([]notify.Notifier, error) {
+	if d := config.Notify.Digest; d != "" && d != service.DigestDaily && d != service.DigestWeekly {
+		return nil, errors.New("NOTIFY_DIGEST must be daily, weekly or empty")
+	}
+
+	var notifiers []notify.Notifier
+	if config.SMTP.Host != "" {
+		mailer, err := notify.NewMailer(config.SMTP)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, mailer)
+	}
+	if config.Ntfy.URL != "" {
+		ntfy, err := notify.NewNtfy(config.Ntfy)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, ntfy)
+	}
+	if config.Gotify.URL != "" {
+		gotify, err := notify.NewGotify(config.Gotify)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, gotify)
 	}
+	return notifiers, nil
 }
 
 func getEnvDefault(key, defaultValue string) string {
@@ -138,6 +379,35 @@ func getEnvDefault(key, defaultValue string) string {
 	return value
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	switch strings.ToLower(os.Getenv(key)) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	default:
+		return defaultValue
+	}
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 func configureLogger() (*slog.Logger, *os.File) {
 	// Create a "logs" directory
 	if err := os.MkdirAll("logs", 0755); err != nil {
@@ -31,6 +31,7 @@ export const JobApplicationForm: React.FC<JobApplicationFormProps> = ({
     link: application?.link || '',
     status: application?.status || 'applied',
     notes: application?.notes || '',
+    tags: application?.tags || [],
   });
 
   const createMutation = useCreateJobApplication();
@@ -130,6 +131,22 @@ export const JobApplicationForm: React.FC<JobApplicationFormProps> = ({
         </select>
       </div>
 
+      <div className="form-group">
+        <label htmlFor="tags">Tags</label>
+        <input
+          type="text"
+          id="tags"
+          name="tags"
+          defaultValue={formData.tags?.join(', ')}
+          onChange={(e) => setFormData(prev => ({
+            ...prev,
+            tags: e.target.value.split(/[,;]/).map(tag => tag.trim()).filter(Boolean),
+          }))}
+          placeholder="remote, referral"
+          disabled={isLoading}
+        />
+      </div>
+
       <div className="form-group">
         <label htmlFor="notes">Notes</label>
         <MarkdownEditor
@@ -2,7 +2,7 @@ import React, { useState } from 'react';
 import { KanbanBoard } from './KanbanBoard';
 import { JobApplicationsList } from './JobApplicationsList';
 import { Header } from './Header';
-import { useJobApplications } from '../hooks/useJobApplications';
+import { useJobApplications, useLiveUpdates } from '../hooks/useJobApplications';
 
 type ViewMode = 'kanban' | 'list';
 
@@ -10,6 +10,7 @@ export const JobApplicationsView: React.FC = () => {
   const [viewMode, setViewMode] = useState<ViewMode>('list');
   const [showCreateForm, setShowCreateForm] = useState(false);
   const { refetch } = useJobApplications();
+  useLiveUpdates();
 
   const handleViewModeChange = (mode: ViewMode) => {
     setViewMode(mode);
@@ -1,6 +1,7 @@
+import { useEffect } from 'react';
 import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query';
-import { jobApplicationsApi } from '../services/api';
-import type { JobApplication, NewJobApplication } from '../types/jobApplication';
+import { eventsApi, jobApplicationsApi } from '../services/api';
+import type { JobApplication, NewJobApplication, WebhookEvent } from '../types/jobApplication';
 
 // Query keys
 export const QUERY_KEYS = {
@@ -17,6 +18,25 @@ export const useJobApplications = () => {
   });
 };
 
+// Refetch applications when they are changed elsewhere, e.g. in another tab or by the inbox.
+// EventSource reconnects on its own and resumes after the last event it received.
+export const useLiveUpdates = () => {
+  const queryClient = useQueryClient();
+
+  useEffect(() => {
+    const source = new EventSource(eventsApi.streamUrl());
+    const refetch = () => {
+      queryClient.invalidateQueries({
+        queryKey: QUERY_KEYS.jobApplications,
+      });
+    };
+    // reset means events were missed, e.g. after a server restart
+    const events: (WebhookEvent | 'reset')[] = ['created', 'updated', 'status_changed', 'deleted', 'reset'];
+    events.forEach((event) => source.addEventListener(event, refetch));
+    return () => source.close();
+  }, [queryClient]);
+};
+
 // Get job application by ID
 export const useJobApplication = (id: number) => {
   return useQuery({
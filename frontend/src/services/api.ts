@@ -1,12 +1,23 @@
 import axios from 'axios';
-import type { JobApplication, NewJobApplication } from '../types/jobApplication';
+import type { ActivityReport, Attachment, AttachmentKind, Document, DocumentOutcome, FunnelReport, GhostedApplication, Goal, GoalMetric, InboundMessage, InboundState, InboxRule, InboxRuleInput, JobApplication, JobApplicationStatus, JobDescription, JobDescriptionDiff, JobDescriptionInput, JobSearchReport, NewJobApplication, ReportTemplate, ReportTemplateInput, ResponseTimes, SearchResult, StageTime, Webhook, WebhookDelivery, WebhookInput } from '../types/jobApplication';
 
 const API_BASE_URL = import.meta.env.VITE_API_URL || 'http://localhost:3000';
 
+// Identifies this browser so undo/redo only reverts its own changes
+const getClientId = (): string => {
+  let id = localStorage.getItem('clientId');
+  if (!id) {
+    id = crypto.randomUUID();
+    localStorage.setItem('clientId', id);
+  }
+  return id;
+};
+
 const api = axios.create({
   baseURL: API_BASE_URL,
   headers: {
     'Content-Type': 'application/json',
+    'X-Client-ID': getClientId(),
   },
 });
 
@@ -31,7 +42,18 @@ export const jobApplicationsApi = {
 
   // Update job application
   update: async (application: JobApplication): Promise<JobApplication> => {
-    const response = await api.put('/api/job-applications', application);
+    // Send the version we last saw so concurrent edits from another tab are rejected (412)
+    const response = await api.put(`/api/job-applications/${application.id}`, application, {
+      headers: application.version ? { 'If-Match': `"${application.id}-${application.version}"` } : {},
+    });
+    return response.data;
+  },
+
+  // Partially update a job application (JSON Merge Patch)
+  patch: async (id: number, changes: Partial<NewJobApplication>): Promise<JobApplication> => {
+    const response = await api.patch(`/api/job-applications/${id}`, changes, {
+      headers: { 'Content-Type': 'application/merge-patch+json' },
+    });
     return response.data;
   },
 
@@ -40,6 +62,89 @@ export const jobApplicationsApi = {
     await api.delete(`/api/job-applications/${id}`);
   },
 
+  // Undo the most recent change made from this browser
+  undo: async (steps = 1): Promise<void> => {
+    await api.post('/api/undo', null, { params: { steps } });
+  },
+
+  // Redo the most recently undone change
+  redo: async (steps = 1): Promise<void> => {
+    await api.post('/api/redo', null, { params: { steps } });
+  },
+
+  // List the files attached to a job application
+  getAttachments: async (id: number): Promise<Attachment[]> => {
+    const response = await api.get(`/api/job-applications/${id}/attachments`);
+    return response.data;
+  },
+
+  // Get the current job description of a job application, or the given version
+  getJobDescription: async (id: number, version?: number): Promise<JobDescription> => {
+    const response = await api.get(`/api/job-applications/${id}/job-description`, { params: { version } });
+    return response.data;
+  },
+
+  // Store a new version of the job description
+  setJobDescription: async (id: number, description: JobDescriptionInput): Promise<JobDescription> => {
+    const response = await api.put(`/api/job-applications/${id}/job-description`, description);
+    return response.data;
+  },
+
+  // List every version of the job description, newest first
+  getJobDescriptionVersions: async (id: number): Promise<JobDescription[]> => {
+    const response = await api.get(`/api/job-applications/${id}/job-description/versions`);
+    return response.data;
+  },
+
+  // Compare two versions of the job description, by default the current one with its predecessor
+  diffJobDescription: async (id: number, from?: number, to?: number): Promise<JobDescriptionDiff> => {
+    const response = await api.get(`/api/job-applications/${id}/job-description/diff`, { params: { from, to } });
+    return response.data;
+  },
+
+  // Attach a file to a job application
+  uploadAttachment: async (id: number, file: File, kind: AttachmentKind = 'other'): Promise<Attachment> => {
+    const formData = new FormData();
+    formData.append('file', file);
+    formData.append('kind', kind);
+    const response = await api.post(`/api/job-applications/${id}/attachments`, formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data;
+  },
+
+  // URL from which an attachment can be downloaded
+  attachmentUrl: (id: number, attachmentId: number): string =>
+    `${API_BASE_URL}/api/job-applications/${id}/attachments/${attachmentId}`,
+
+  // Delete an attachment
+  deleteAttachment: async (id: number, attachmentId: number): Promise<void> => {
+    await api.delete(`/api/job-applications/${id}/attachments/${attachmentId}`);
+  },
+
+  // List the document versions sent with a job application
+  getDocuments: async (id: number): Promise<Document[]> => {
+    const response = await api.get(`/api/job-applications/${id}/documents`);
+    return response.data;
+  },
+
+  // Record that a document version was sent with a job application
+  linkDocument: async (id: number, documentId: number): Promise<Document> => {
+    const response = await api.post(`/api/job-applications/${id}/documents`, { document_id: documentId });
+    return response.data;
+  },
+
+  // Remove a document version from a job application
+  unlinkDocument: async (id: number, documentId: number): Promise<void> => {
+    await api.delete(`/api/job-applications/${id}/documents/${documentId}`);
+  },
+
+  // Search notes and attachment text
+  search: async (q: string, limit?: number): Promise<SearchResult[]> => {
+    const response = await api.get('/api/search', { params: { q, limit } });
+    return response.data;
+  },
+
   // Import job applications from CSV
   importCSV: async (file: File): Promise<{ imported: number; message: string }> => {
     const formData = new FormData();
@@ -49,6 +154,7 @@ export const jobApplicationsApi = {
     const response = await fetch(`${API_BASE_URL}/job-applications/import`, {
       method: 'POST',
       body: formData,
+      headers: { 'X-Client-ID': getClientId() },
       // Don't set Content-Type header - let browser set it with boundary for FormData
     });
 
@@ -57,7 +163,7 @@ export const jobApplicationsApi = {
       let errorMessage = `HTTP error! status: ${response.status}`;
       try {
         const errorJson = JSON.parse(errorText);
-        errorMessage = errorJson.error || errorJson.message || errorMessage;
+        errorMessage = errorJson.error?.message || errorJson.message || errorMessage;
       } catch {
         errorMessage = errorText || errorMessage;
       }
@@ -72,4 +178,201 @@ export const jobApplicationsApi = {
   },
 };
 
+export const documentsApi = {
+  // List the document library, optionally only the versions of one document
+  getAll: async (name?: string): Promise<Document[]> => {
+    const response = await api.get('/api/documents', { params: name ? { name } : {} });
+    return response.data;
+  },
+
+  // Upload a file as the next version of the named document
+  upload: async (name: string, file: File, kind: AttachmentKind = 'resume'): Promise<Document> => {
+    const formData = new FormData();
+    formData.append('file', file);
+    formData.append('name', name);
+    formData.append('kind', kind);
+    const response = await api.post('/api/documents', formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data;
+  },
+
+  // URL from which a document version can be downloaded
+  contentUrl: (id: number): string => `${API_BASE_URL}/api/documents/${id}/content`,
+
+  // Delete a document version that is not linked to any application
+  delete: async (id: number): Promise<void> => {
+    await api.delete(`/api/documents/${id}`);
+  },
+
+  // Compare document versions by the outcome of the applications they were sent with
+  report: async (kind?: AttachmentKind): Promise<DocumentOutcome[]> => {
+    const response = await api.get('/api/reports/documents', { params: kind ? { kind } : {} });
+    return response.data;
+  },
+};
+
+export const reportsApi = {
+  // The job search activity report as data, for previewing
+  activity: async (params: { from?: string; to?: string; template?: string } = {}): Promise<JobSearchReport> => {
+    const response = await api.get('/api/reports/activity', { params: { ...params, format: 'json' } });
+    return response.data;
+  },
+
+  // URL of the printable activity report, to open or download
+  activityUrl: (
+    format: 'html' | 'pdf',
+    params: { from?: string; to?: string; template?: string; paper?: 'a4' | 'letter' } = {}
+  ): string => {
+    const query = new URLSearchParams({ format });
+    Object.entries(params).forEach(([key, value]) => {
+      if (value) query.set(key, value);
+    });
+    return `${API_BASE_URL}/api/reports/activity?${query.toString()}`;
+  },
+
+  getTemplates: async (): Promise<ReportTemplate[]> => {
+    const response = await api.get('/api/reports/templates');
+    return response.data;
+  },
+
+  // Save a template under a name, replacing any earlier one
+  setTemplate: async (name: string, template: ReportTemplateInput): Promise<ReportTemplate> => {
+    const response = await api.put(`/api/reports/templates/${encodeURIComponent(name)}`, template);
+    return response.data;
+  },
+
+  deleteTemplate: async (name: string): Promise<void> => {
+    await api.delete(`/api/reports/templates/${encodeURIComponent(name)}`);
+  },
+};
+
+export const statsApi = {
+  // Funnel of the applications created in a date range, optionally grouped
+  funnel: async (params: { from?: string; to?: string; group_by?: 'tag' | 'source' | 'company' } = {}): Promise<FunnelReport> => {
+    const response = await api.get('/api/stats/funnel', { params });
+    return response.data;
+  },
+
+  // Time from applying to the first response
+  responseTimes: async (params: { from?: string; to?: string } = {}): Promise<ResponseTimes> => {
+    const response = await api.get('/api/stats/response-times', { params });
+    return response.data;
+  },
+
+  // Time spent in each status
+  timeInStage: async (params: { from?: string; to?: string } = {}): Promise<StageTime[]> => {
+    const response = await api.get('/api/stats/time-in-stage', { params });
+    return response.data;
+  },
+
+  // Open applications without any change for the given number of days
+  ghosted: async (days?: number): Promise<GhostedApplication[]> => {
+    const response = await api.get('/api/stats/ghosted', { params: { days } });
+    return response.data;
+  },
+
+  // Daily and weekly activity with progress towards the goals
+  activity: async (params: { from?: string; to?: string } = {}): Promise<ActivityReport> => {
+    const response = await api.get('/api/stats/activity', { params });
+    return response.data;
+  },
+
+  getGoals: async (): Promise<Goal[]> => {
+    const response = await api.get('/api/goals');
+    return response.data;
+  },
+
+  // Set the weekly target of a metric
+  setGoal: async (metric: GoalMetric, weeklyTarget: number): Promise<Goal> => {
+    const response = await api.put(`/api/goals/${metric}`, { weekly_target: weeklyTarget });
+    return response.data;
+  },
+
+  deleteGoal: async (metric: GoalMetric): Promise<void> => {
+    await api.delete(`/api/goals/${metric}`);
+  },
+
+  // URL of a server-rendered chart, usable as an image source
+  chartUrl: (
+    chart: 'funnel' | 'status' | 'weekly',
+    format: 'svg' | 'png' = 'svg',
+    params: { from?: string; to?: string; width?: number; height?: number } = {}
+  ): string => {
+    const query = new URLSearchParams();
+    Object.entries(params).forEach(([key, value]) => {
+      if (value !== undefined && value !== '') query.set(key, String(value));
+    });
+    const qs = query.toString();
+    return `${API_BASE_URL}/api/charts/${chart}.${format}${qs ? `?${qs}` : ''}`;
+  },
+};
+
 export default api;
+
+export const webhooksApi = {
+  getAll: async (): Promise<Webhook[]> => {
+    const response = await api.get('/api/webhooks');
+    return response.data;
+  },
+
+  // The created webhook includes its secret, which is not shown again
+  create: async (webhook: WebhookInput): Promise<Webhook> => {
+    const response = await api.post('/api/webhooks', webhook);
+    return response.data;
+  },
+
+  update: async (id: number, webhook: WebhookInput): Promise<Webhook> => {
+    const response = await api.put(`/api/webhooks/${id}`, webhook);
+    return response.data;
+  },
+
+  delete: async (id: number): Promise<void> => {
+    await api.delete(`/api/webhooks/${id}`);
+  },
+
+  deliveries: async (id: number, limit?: number): Promise<WebhookDelivery[]> => {
+    const response = await api.get(`/api/webhooks/${id}/deliveries`, { params: { limit } });
+    return response.data;
+  },
+
+  // Send a ping right away and return its delivery
+  test: async (id: number): Promise<WebhookDelivery> => {
+    const response = await api.post(`/api/webhooks/${id}/test`);
+    return response.data;
+  },
+};
+
+export const inboxApi = {
+  getAll: async (state?: InboundState, limit?: number): Promise<InboundMessage[]> => {
+    const response = await api.get('/api/inbox', { params: { state, limit } });
+    return response.data;
+  },
+
+  // Apply the suggested status change, or another application or status
+  apply: async (id: number, override?: { application_id?: number; status?: JobApplicationStatus }): Promise<InboundMessage> => {
+    const response = await api.post(`/api/inbox/${id}/apply`, override ?? {});
+    return response.data;
+  },
+
+  dismiss: async (id: number): Promise<InboundMessage> => {
+    const response = await api.post(`/api/inbox/${id}/dismiss`);
+    return response.data;
+  },
+
+  getRules: async (): Promise<InboxRule[]> => {
+    const response = await api.get('/api/inbox/rules');
+    return response.data;
+  },
+
+  // Replace every rule, they are checked in the given order
+  setRules: async (rules: InboxRuleInput[]): Promise<InboxRule[]> => {
+    const response = await api.put('/api/inbox/rules', rules);
+    return response.data;
+  },
+};
+
+export const eventsApi = {
+  // URL of the stream of application changes, for an EventSource
+  streamUrl: (): string => `${API_BASE_URL}/api/events`,
+};
@@ -5,8 +5,10 @@ export interface JobApplication {
   link: string;
   status: string;
   notes: string;
+  tags: string[];
   created_at: string;
   updated_at: string;
+  version: number;
 }
 
 export interface NewJobApplication {
@@ -15,6 +17,267 @@ export interface NewJobApplication {
   link: string;
   status: string;
   notes: string;
+  tags?: string[];
+  job_description?: JobDescriptionInput;
+}
+
+// Pasted text is read as Markdown, html is converted to Markdown
+export interface JobDescriptionInput {
+  text?: string;
+  html?: string;
+}
+
+export interface JobDescription {
+  application_id: number;
+  version: number;
+  markdown: string;
+  source: 'text' | 'html';
+  created_at: string;
+}
+
+export interface JobDescriptionDiff {
+  application_id: number;
+  from: number;
+  to: number;
+  lines: { op: 'equal' | 'insert' | 'delete'; text: string }[];
+  unified: string;
+}
+
+export type AttachmentKind = 'resume' | 'cover_letter' | 'offer' | 'job_description' | 'email' | 'other';
+
+export interface Attachment {
+  id: number;
+  application_id: number;
+  kind: AttachmentKind;
+  filename: string;
+  content_type: string;
+  size: number;
+  sha256: string;
+  created_at: string;
+  text_status: 'pending' | 'extracted' | 'unsupported' | 'failed';
+}
+
+export interface SearchResult {
+  application_id: number;
+  company: string;
+  position: string;
+  status: string;
+  source: 'application' | 'attachment';
+  attachment_id?: number;
+  filename?: string;
+  snippet: string;
+}
+
+export interface Document {
+  id: number;
+  name: string;
+  version: number;
+  kind: AttachmentKind;
+  filename: string;
+  content_type: string;
+  size: number;
+  sha256: string;
+  created_at: string;
+  applications: number;
+}
+
+export interface DocumentOutcome {
+  document_id: number;
+  name: string;
+  version: number;
+  kind: AttachmentKind;
+  applications: number;
+  by_status: Record<string, number>;
+  responses: number;
+  interviews: number;
+  response_rate: number;
+  interview_rate: number;
+}
+
+export interface FunnelStage {
+  stage: 'applied' | 'interview' | 'offer';
+  count: number;
+  conversion_percent: number;
+  overall_percent: number;
+}
+
+export interface Funnel {
+  key: string;
+  applications: number;
+  stages: FunnelStage[];
+  by_status: Record<string, number>;
+}
+
+export interface FunnelReport {
+  from?: string;
+  to?: string;
+  group_by?: 'tag' | 'source' | 'company';
+  total: Funnel;
+  groups?: Funnel[];
+}
+
+export interface DurationStats {
+  count: number;
+  median_days: number;
+  p90_days: number;
+  mean_days: number;
+}
+
+export interface ResponseTimes {
+  from?: string;
+  to?: string;
+  responded: DurationStats;
+  awaiting: number;
+  waiting_so_far: DurationStats;
+  response_rate: number;
+}
+
+export interface StageTime {
+  status: string;
+  completed: DurationStats;
+  current: DurationStats;
+}
+
+export interface GhostedApplication extends JobApplication {
+  days_since_change: number;
+}
+
+export type GoalMetric = 'applications' | 'status_changes' | 'interviews';
+
+export interface Goal {
+  metric: GoalMetric;
+  weekly_target: number;
+  updated_at: string;
+}
+
+export interface ActivityCounts {
+  applications: number;
+  status_changes: number;
+  interviews: number;
+}
+
+export interface GoalProgress {
+  metric: GoalMetric;
+  target: number;
+  actual: number;
+  progress: number;
+  met: boolean;
+}
+
+export interface Streak {
+  current: number;
+  longest: number;
+}
+
+export interface ActivityReport {
+  from: string;
+  to: string;
+  days: (ActivityCounts & { date: string })[];
+  weeks: (ActivityCounts & { week_start: string; goals: GoalProgress[] })[];
+  active_days: Streak;
+  goal_weeks: (Streak & { metric: GoalMetric })[];
+}
+
+export type ReportColumnKey = 'date' | 'company' | 'position' | 'contact_method' | 'status' | 'link';
+
+export interface ReportTemplateInput {
+  title: string;
+  header: string;
+  footer: string;
+  columns: ReportColumnKey[];
+}
+
+export interface ReportTemplate extends ReportTemplateInput {
+  name: string;
+  updated_at?: string;
+}
+
+export interface ReportEntry {
+  application_id: number;
+  date: string;
+  company: string;
+  position: string;
+  contact_method: string;
+  status: string;
+  link: string;
+}
+
+export interface JobSearchReport {
+  from: string;
+  to: string;
+  template: string;
+  title: string;
+  header: string;
+  footer: string;
+  columns: { key: ReportColumnKey; label: string }[];
+  generated: string;
+  entries: ReportEntry[];
+}
+
+export type WebhookEvent = 'created' | 'updated' | 'status_changed' | 'deleted' | 'reminder_due';
+
+export interface WebhookInput {
+  url: string;
+  description?: string;
+  events: WebhookEvent[];
+  secret?: string;
+  active?: boolean;
+}
+
+export interface Webhook {
+  id: number;
+  url: string;
+  description: string;
+  events: WebhookEvent[];
+  // Only returned when it was generated or changed
+  secret?: string;
+  active: boolean;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface WebhookDelivery {
+  id: number;
+  webhook_id: number;
+  event: WebhookEvent | 'ping';
+  payload: unknown;
+  status: 'pending' | 'sending' | 'succeeded' | 'failed';
+  attempts: number;
+  next_attempt_at?: string;
+  response_status?: number;
+  error?: string;
+  created_at: string;
+  delivered_at?: string;
+}
+
+export type InboundState = 'unmatched' | 'unclassified' | 'unchanged' | 'proposed' | 'applied' | 'dismissed';
+
+export interface InboundMessage {
+  id: number;
+  message_id: string;
+  from: string;
+  subject: string;
+  sent_at: string | null;
+  application_id: number | null;
+  matched_by?: 'contact_email' | 'domain' | 'company_name' | 'manual';
+  rule_id: number | null;
+  // The status the message suggests for its application
+  status?: JobApplicationStatus;
+  state: InboundState;
+  attachment_id: number | null;
+  created_at: string;
+}
+
+export interface InboxRuleInput {
+  status: JobApplicationStatus;
+  // Case-insensitive regular expression looked for in the subject and body
+  pattern: string;
+  // Change the status right away instead of proposing it for review
+  apply: boolean;
+}
+
+export interface InboxRule extends InboxRuleInput {
+  id: number;
 }
 
 export type JobApplicationStatus = 'applied' | 'interview' | 'rejected' | 'ghosted';
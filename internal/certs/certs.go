@@ -0,0 +1,150 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// selfSignedValidity is how long a generated certificate is valid for
+	selfSignedValidity = 365 * 24 * time.Hour
+	// renewBefore is how close to expiry a persisted certificate is regenerated
+	renewBefore = 30 * 24 * time.Hour
+)
+
+// EnsureSelfSigned makes sure a usable self-signed certificate exists at certFile/keyFile.
+// An existing pair is reused unless it fails to load, is about to expire or does not cover
+// all of the requested hosts, in which case a new pair is generated and written to disk.
+func EnsureSelfSigned(certFile, keyFile string, hosts []string, logger *slog.Logger) error {
+	ok, reason := reusable(certFile, keyFile, hosts)
+	if ok {
+		logger.Info("Using existing self-signed certificate", "cert", certFile)
+		return nil
+	}
+	logger.Info("Generating self-signed certificate", "cert", certFile, "reason", reason, "hosts", hosts)
+
+	certPEM, keyPEM, err := generate(hosts)
+	if err != nil {
+		return fmt.Errorf("generate self-signed certificate: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return err
+	}
+	return nil
+}
+
+// reusable reports whether the certificate on disk can be used as-is, and if not, why
+func reusable(certFile, keyFile string, hosts []string) (bool, string) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, "missing"
+		}
+		return false, "unreadable"
+	}
+
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return false, "unparsable"
+	}
+	if time.Until(leaf.NotAfter) < renewBefore {
+		return false, "expiring"
+	}
+	for _, h := range hosts {
+		if leaf.VerifyHostname(h) != nil {
+			return false, "missing host " + h
+		}
+	}
+	return true, ""
+}
+
+// generate creates a PEM encoded ECDSA certificate and key valid for the given hosts
+func generate(hosts []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"ctrl-alt-me"}, CommonName: "ctrl-alt-me"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// LocalHosts returns the host names and addresses a LAN deployment is typically reached by:
+// localhost, the machine host name and every non-loopback interface address.
+func LocalHosts() []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		hosts = append(hosts, name)
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return hosts
+	}
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		hosts = append(hosts, ipNet.IP.String())
+	}
+	return hosts
+}
@@ -0,0 +1,226 @@
+// Package chart renders simple bar charts as SVG or PNG without any external dependencies,
+// so reports can be embedded in emails and wikis.
+package chart
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Default and allowed chart sizes, in pixels
+const (
+	DefaultWidth  = 640
+	DefaultHeight = 360
+	MinSize       = 200
+	MaxSize       = 2000
+)
+
+// Text sizes
+const (
+	titleSize = 16
+	labelSize = 11
+)
+
+// Colors used when a bar has none of its own
+const (
+	DefaultColor = "#4f7cac"
+	textColor    = "#222222"
+	mutedColor   = "#666666"
+	gridColor    = "#dddddd"
+	background   = "#ffffff"
+)
+
+// Bar is one bar of a chart
+type Bar struct {
+	Label string
+	Value float64
+	// Note is shown next to the value, e.g. a percentage
+	Note  string
+	Color string
+}
+
+// BarChart is a titled bar chart
+type BarChart struct {
+	Title    string
+	Subtitle string
+	Bars     []Bar
+	// Horizontal draws one bar per row, growing to the right, instead of columns
+	Horizontal    bool
+	Width, Height int
+}
+
+// anchor is the horizontal alignment of text
+type anchor int
+
+const (
+	anchorStart anchor = iota
+	anchorMiddle
+	anchorEnd
+)
+
+// canvas is a drawing surface. Text is positioned by the vertical middle of its line.
+type canvas interface {
+	rect(x, y, w, h float64, color string)
+	line(x1, y1, x2, y2 float64, color string)
+	text(x, y float64, s string, size float64, a anchor, color string)
+	textWidth(s string, size float64) float64
+}
+
+func (c BarChart) size() (int, int) {
+	w, h := c.Width, c.Height
+	if w == 0 {
+		w = DefaultWidth
+	}
+	if h == 0 {
+		h = DefaultHeight
+	}
+	return min(max(w, MinSize), MaxSize), min(max(h, MinSize), MaxSize)
+}
+
+func (c BarChart) draw(cv canvas) {
+	w, h := c.size()
+	width, height := float64(w), float64(h)
+	cv.rect(0, 0, width, height, background)
+
+	top := 12.0
+	if c.Title != "" {
+		cv.text(width/2, top+titleSize/2, c.Title, titleSize, anchorMiddle, textColor)
+		top += titleSize + 12
+	}
+	if c.Subtitle != "" {
+		cv.text(width/2, top+labelSize/2, c.Subtitle, labelSize, anchorMiddle, mutedColor)
+		top += labelSize + 8
+	}
+	top += 8
+
+	if len(c.Bars) == 0 {
+		cv.text(width/2, (top+height)/2, "No data", labelSize, anchorMiddle, mutedColor)
+		return
+	}
+	if c.Horizontal {
+		c.drawRows(cv, top, width, height)
+	} else {
+		c.drawColumns(cv, top, width, height)
+	}
+}
+
+// valueText formats a bar's value with its note
+func valueText(b Bar) string {
+	s := formatValue(b.Value)
+	if b.Note != "" {
+		s += " (" + b.Note + ")"
+	}
+	return s
+}
+
+func formatValue(v float64) string {
+	if v == math.Trunc(v) {
+		return strconv.FormatFloat(v, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(v, 'f', 1, 64)
+}
+
+func barColor(b Bar) string {
+	if b.Color == "" {
+		return DefaultColor
+	}
+	return b.Color
+}
+
+func maxValue(bars []Bar) float64 {
+	m := 0.0
+	for _, b := range bars {
+		m = max(m, b.Value)
+	}
+	return m
+}
+
+// drawRows draws one horizontal bar per row with its label on the left and value on the right
+func (c BarChart) drawRows(cv canvas, top, width, height float64) {
+	labelWidth, valueWidth := 0.0, 0.0
+	for _, b := range c.Bars {
+		labelWidth = max(labelWidth, cv.textWidth(b.Label, labelSize))
+		valueWidth = max(valueWidth, cv.textWidth(valueText(b), labelSize))
+	}
+	left := min(labelWidth+24, width/3)
+	plotWidth := width - left - valueWidth - 24
+	rowHeight := (height - top - 12) / float64(len(c.Bars))
+	barHeight := min(rowHeight*0.65, 40)
+
+	scale := maxValue(c.Bars)
+	for i, b := range c.Bars {
+		middle := top + rowHeight*(float64(i)+0.5)
+		cv.text(left-8, middle, b.Label, labelSize, anchorEnd, textColor)
+		barWidth := 0.0
+		if scale > 0 {
+			barWidth = plotWidth * b.Value / scale
+		}
+		cv.rect(left, middle-barHeight/2, barWidth, barHeight, barColor(b))
+		cv.text(left+barWidth+6, middle, valueText(b), labelSize, anchorStart, textColor)
+	}
+	cv.line(left, top, left, height-12, mutedColor)
+}
+
+// drawColumns draws vertical bars over a value axis with grid lines
+func (c BarChart) drawColumns(cv canvas, top, width, height float64) {
+	scale, step := niceScale(maxValue(c.Bars))
+	axisWidth := cv.textWidth(formatValue(scale), labelSize)
+	left := axisWidth + 20
+	bottom := height - labelSize - 20
+	plotWidth := width - left - 16
+	plotHeight := bottom - top
+
+	for v := 0.0; v <= scale+step/2; v += step {
+		y := bottom - plotHeight*v/scale
+		cv.line(left, y, left+plotWidth, y, gridColor)
+		cv.text(left-6, y, formatValue(v), labelSize, anchorEnd, mutedColor)
+	}
+
+	slot := plotWidth / float64(len(c.Bars))
+	barWidth := slot * 0.7
+	// Show only every n-th label if they would overlap
+	labelEvery := 1
+	for _, b := range c.Bars {
+		if need := int(math.Ceil((cv.textWidth(b.Label, labelSize) + 8) / slot)); need > labelEvery {
+			labelEvery = need
+		}
+	}
+	valuesFit := cv.textWidth(formatValue(maxValue(c.Bars)), labelSize) <= slot
+
+	for i, b := range c.Bars {
+		x := left + slot*float64(i) + (slot-barWidth)/2
+		barHeight := plotHeight * b.Value / scale
+		cv.rect(x, bottom-barHeight, barWidth, barHeight, barColor(b))
+		if valuesFit && b.Value > 0 {
+			cv.text(x+barWidth/2, bottom-barHeight-labelSize/2-3, formatValue(b.Value), labelSize, anchorMiddle, textColor)
+		}
+		if i%labelEvery == 0 {
+			cv.text(x+barWidth/2, bottom+labelSize/2+8, b.Label, labelSize, anchorMiddle, textColor)
+		}
+	}
+	cv.line(left, bottom, left+plotWidth, bottom, mutedColor)
+}
+
+// niceScale rounds the top of the value axis up to a round number and picks a step that
+// divides it into at most five whole-number intervals
+func niceScale(m float64) (top, step float64) {
+	if m <= 0 {
+		return 1, 1
+	}
+	raw := m / 5
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, f := range []float64{1, 2, 5, 10} {
+		step = f * magnitude
+		if step >= raw {
+			break
+		}
+	}
+	step = max(step, 1)
+	return math.Ceil(m/step) * step, step
+}
+
+// Percent formats a share between 0 and 1 as a whole percentage
+func Percent(share float64) string {
+	return fmt.Sprintf("%.0f%%", share*100)
+}
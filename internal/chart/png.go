@@ -0,0 +1,103 @@
+package chart
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"unicode"
+)
+
+// pngCanvas draws onto an image, writing text with the built-in bitmap font
+type pngCanvas struct {
+	img *image.RGBA
+}
+
+// parseColor reads a #rrggbb color
+func parseColor(s string) color.RGBA {
+	if len(s) == 7 && s[0] == '#' {
+		if v, err := strconv.ParseUint(s[1:], 16, 32); err == nil {
+			return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+		}
+	}
+	return color.RGBA{A: 0xff}
+}
+
+func (p *pngCanvas) rect(x, y, w, h float64, c string) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	r := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+w)), int(math.Round(y+h)))
+	draw.Draw(p.img, r, image.NewUniform(parseColor(c)), image.Point{}, draw.Src)
+}
+
+func (p *pngCanvas) line(x1, y1, x2, y2 float64, c string) {
+	col := parseColor(c)
+	steps := int(math.Max(math.Abs(x2-x1), math.Abs(y2-y1)))
+	for i := 0; i <= steps; i++ {
+		t := 0.0
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		p.img.SetRGBA(int(math.Round(x1+(x2-x1)*t)), int(math.Round(y1+(y2-y1)*t)), col)
+	}
+}
+
+// fontScale is the number of pixels per font dot used for text of the given size
+func fontScale(size float64) int {
+	return max(1, int(math.Round(size/6)))
+}
+
+func (p *pngCanvas) text(x, y float64, s string, size float64, a anchor, c string) {
+	scale := fontScale(size)
+	switch a {
+	case anchorMiddle:
+		x -= p.textWidth(s, size) / 2
+	case anchorEnd:
+		x -= p.textWidth(s, size)
+	}
+	col := parseColor(c)
+	left, top := int(math.Round(x)), int(math.Round(y))-glyphHeight*scale/2
+
+	for _, r := range s {
+		rows, ok := glyphs[unicode.ToUpper(r)]
+		if !ok {
+			rows = glyphs['?']
+		}
+		for gy, bits := range rows {
+			for gx := 0; gx < glyphWidth; gx++ {
+				if bits&(1<<(glyphWidth-1-gx)) == 0 {
+					continue
+				}
+				dot := image.Rect(left+gx*scale, top+gy*scale, left+(gx+1)*scale, top+(gy+1)*scale)
+				draw.Draw(p.img, dot, image.NewUniform(col), image.Point{}, draw.Src)
+			}
+		}
+		left += (glyphWidth + 1) * scale
+	}
+}
+
+func (p *pngCanvas) textWidth(s string, size float64) float64 {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	scale := fontScale(size)
+	return float64(n*(glyphWidth+1)*scale - scale)
+}
+
+// PNG renders the chart as a PNG image
+func (c BarChart) PNG() ([]byte, error) {
+	w, h := c.size()
+	p := &pngCanvas{img: image.NewRGBA(image.Rect(0, 0, w, h))}
+	c.draw(p)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, p.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
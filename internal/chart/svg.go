@@ -0,0 +1,50 @@
+package chart
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+// svgCanvas writes SVG elements
+type svgCanvas struct {
+	buf bytes.Buffer
+}
+
+func (s *svgCanvas) rect(x, y, w, h float64, color string) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	fmt.Fprintf(&s.buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`+"\n", x, y, w, h, color)
+}
+
+func (s *svgCanvas) line(x1, y1, x2, y2 float64, color string) {
+	fmt.Fprintf(&s.buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="1"/>`+"\n", x1, y1, x2, y2, color)
+}
+
+func (s *svgCanvas) text(x, y float64, text string, size float64, a anchor, color string) {
+	anchors := [...]string{anchorStart: "start", anchorMiddle: "middle", anchorEnd: "end"}
+	fmt.Fprintf(&s.buf, `<text x="%.1f" y="%.1f" font-size="%.0f" text-anchor="%s" dominant-baseline="central" fill="%s">`, x, y, size, anchors[a], color)
+	xml.EscapeText(&s.buf, []byte(text))
+	s.buf.WriteString("</text>\n")
+}
+
+// textWidth estimates the width of text in the sans-serif fonts browsers fall back to
+func (s *svgCanvas) textWidth(text string, size float64) float64 {
+	return float64(len([]rune(text))) * size * 0.6
+}
+
+// SVG renders the chart as a standalone SVG document
+func (c BarChart) SVG() []byte {
+	w, h := c.size()
+	s := &svgCanvas{}
+	fmt.Fprintf(&s.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Helvetica, Arial, sans-serif">`+"\n", w, h, w, h)
+	if c.Title != "" {
+		s.buf.WriteString("<title>")
+		xml.EscapeText(&s.buf, []byte(c.Title))
+		s.buf.WriteString("</title>\n")
+	}
+	c.draw(s)
+	s.buf.WriteString("</svg>\n")
+	return s.buf.Bytes()
+}
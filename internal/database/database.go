@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -21,13 +22,431 @@ const CreateTable = `
 	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);`
 
+// Migrations are applied in order after CreateTable. PRAGMA user_version records how many
+// have run, so only append to this list and never edit an entry that has shipped.
+var Migrations = []string{
+	// 1: optimistic concurrency control
+	`ALTER TABLE job_applications ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	// 2-3: archive and trash
+	`ALTER TABLE job_applications ADD COLUMN archived_at DATETIME`,
+	`ALTER TABLE job_applications ADD COLUMN deleted_at DATETIME`,
+	// 4-5: change log used for history and undo/redo
+	`CREATE TABLE job_application_changes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	application_id INTEGER NOT NULL,
+	action TEXT NOT NULL,
+	actor TEXT NOT NULL DEFAULT '',
+	group_key TEXT NOT NULL DEFAULT '',
+	before_state TEXT,
+	after_state TEXT,
+	state TEXT NOT NULL,
+	result_version INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX idx_job_application_changes_actor ON job_application_changes (actor, state, id)`,
+	// 6-8: tags
+	`CREATE TABLE tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	color TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE job_application_tags (
+	application_id INTEGER NOT NULL REFERENCES job_applications (id) ON DELETE CASCADE,
+	tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+	PRIMARY KEY (application_id, tag_id)
+	)`,
+	`CREATE INDEX idx_job_application_tags_tag ON job_application_tags (tag_id)`,
+	// 9-10: attachments, whose content is stored on disk by SHA-256
+	`CREATE TABLE attachments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	application_id INTEGER NOT NULL REFERENCES job_applications (id) ON DELETE CASCADE,
+	kind TEXT NOT NULL DEFAULT 'other',
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	sha256 TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (application_id, sha256)
+	)`,
+	`CREATE INDEX idx_attachments_sha256 ON attachments (sha256)`,
+	// 11-13: document library, versioned by name and linked to the applications they were sent with
+	`CREATE TABLE documents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL COLLATE NOCASE,
+	version INTEGER NOT NULL,
+	kind TEXT NOT NULL DEFAULT 'resume',
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	sha256 TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (name, version)
+	)`,
+	`CREATE TABLE application_documents (
+	application_id INTEGER NOT NULL REFERENCES job_applications (id) ON DELETE CASCADE,
+	document_id INTEGER NOT NULL REFERENCES documents (id) ON DELETE RESTRICT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (application_id, document_id)
+	)`,
+	`CREATE INDEX idx_application_documents_document ON application_documents (document_id)`,
+	// 14-21: full-text search over application notes and the text extracted from attachments.
+	// Triggers keep the application index in sync with every write.
+	`ALTER TABLE attachments ADD COLUMN text_status TEXT NOT NULL DEFAULT 'pending'`,
+	`CREATE VIRTUAL TABLE application_search USING fts4(title, notes, tokenize=unicode61)`,
+	`INSERT INTO application_search (docid, title, notes) SELECT id, company || ' ' || position, COALESCE(notes, '') FROM job_applications`,
+	`CREATE TRIGGER job_applications_search_insert AFTER INSERT ON job_applications BEGIN
+	INSERT INTO application_search (docid, title, notes) VALUES (new.id, new.company || ' ' || new.position, COALESCE(new.notes, ''));
+	END`,
+	`CREATE TRIGGER job_applications_search_update AFTER UPDATE OF company, position, notes ON job_applications BEGIN
+	UPDATE application_search SET title = new.company || ' ' || new.position, notes = COALESCE(new.notes, '') WHERE docid = new.id;
+	END`,
+	`CREATE TRIGGER job_applications_search_delete AFTER DELETE ON job_applications BEGIN
+	DELETE FROM application_search WHERE docid = old.id;
+	END`,
+	`CREATE VIRTUAL TABLE attachment_search USING fts4(filename, body, tokenize=unicode61)`,
+	`CREATE TRIGGER attachments_search_delete AFTER DELETE ON attachments BEGIN
+	DELETE FROM attachment_search WHERE docid = old.id;
+	END`,
+	// 22: job description snapshots, stored as Markdown with every revision kept
+	`CREATE TABLE job_descriptions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	application_id INTEGER NOT NULL REFERENCES job_applications (id) ON DELETE CASCADE,
+	version INTEGER NOT NULL,
+	markdown TEXT NOT NULL,
+	source TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (application_id, version)
+	)`,
+	// 23: per application lookups of the change log, used by history and statistics
+	`CREATE INDEX idx_job_application_changes_application ON job_application_changes (application_id, id)`,
+	// 24: weekly activity goals
+	`CREATE TABLE goals (
+	metric TEXT PRIMARY KEY,
+	weekly_target INTEGER NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	// 25: templates for the printable activity report
+	`CREATE TABLE report_templates (
+	name TEXT PRIMARY KEY COLLATE NOCASE,
+	title TEXT NOT NULL,
+	header TEXT NOT NULL DEFAULT '',
+	footer TEXT NOT NULL DEFAULT '',
+	columns TEXT NOT NULL,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	// 26: outbound webhook subscriptions, events is a comma-separated list of event types
+	`CREATE TABLE webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	events TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	active INTEGER NOT NULL DEFAULT 1,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+	// 27: the delivery log and retry queue of the webhooks
+	`CREATE TABLE webhook_deliveries (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+	event TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	response_status INTEGER,
+	error TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	delivered_at DATETIME
+	)`,
+	// 28: lookups of the deliveries that are due
+	`CREATE INDEX idx_webhook_deliveries_due ON webhook_deliveries (status, next_attempt_at)`,
+	// 29: per webhook lookups of the delivery log
+	`CREATE INDEX idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, id)`,
+	// 30: notifications that were sent, so each is only sent once
+	`CREATE TABLE notifications (
+	kind TEXT NOT NULL,
+	key TEXT NOT NULL,
+	sent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (kind, key)
+	)`,
+	// 31-33: record sent notifications per channel, keeping those already sent by email
+	`CREATE TABLE sent_notifications (
+	channel TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	key TEXT NOT NULL,
+	sent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (channel, kind, key)
+	)`,
+	`INSERT INTO sent_notifications (channel, kind, key, sent_at) SELECT 'email', kind, key, sent_at FROM notifications`,
+	`DROP TABLE notifications`,
+	// 34-35: rules that classify inbound email by the status it suggests, checked by position
+	`CREATE TABLE inbox_rules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	position INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	pattern TEXT NOT NULL,
+	apply INTEGER NOT NULL DEFAULT 0
+	)`,
+	`INSERT INTO inbox_rules (position, status, pattern) VALUES
+	(1, 'rejected', 'unfortunately|not (be )?(moving|move) forward|(decided|chosen|elected) to (move forward|proceed|pursue|go) with other|no longer (being )?consider|position has been filled|not (been )?selected|will not be (moving|proceeding)'),
+	(2, 'offer', 'pleased to (extend|offer)|offer letter|(extend|make) (you )?an offer'),
+	(3, 'interview', '(schedule|book|arrange|set up) (an? |your |the )?(interview|call|chat|time)|invite you (to|for) an? (interview|call|conversation|chat)|interview invitation|your availability')`,
+	// 36: inbound email, kept with the application it was matched to and the change it suggests
+	`CREATE TABLE inbound_messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	message_id TEXT NOT NULL UNIQUE,
+	sender TEXT NOT NULL,
+	subject TEXT NOT NULL DEFAULT '',
+	sent_at DATETIME,
+	application_id INTEGER REFERENCES job_applications (id) ON DELETE SET NULL,
+	matched_by TEXT NOT NULL DEFAULT '',
+	rule_id INTEGER REFERENCES inbox_rules (id) ON DELETE SET NULL,
+	status TEXT NOT NULL DEFAULT '',
+	state TEXT NOT NULL,
+	attachment_id INTEGER REFERENCES attachments (id) ON DELETE SET NULL,
+	raw BLOB,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`,
+}
+
 const InsertStmt = `INSERT INTO job_applications (company, position, link, status, notes) VALUES (?, ?, ?, ?, ?)`
-const SelectAllStmt = `SELECT * FROM job_applications`
-const SelectByIDStmt = `SELECT * FROM job_applications WHERE id = ?`
-const UpdateStmt = `UPDATE job_applications SET company = ?, position = ?, link = ?, status = ?, notes = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
-const DeleteStmt = `DELETE FROM job_applications WHERE id = ?`
+const SelectColumns = `id, company, position, link, status, COALESCE(notes, ''), created_at, updated_at, version, archived_at, deleted_at`
+
+// Rows with deleted_at set are in the trash and only visible through the Trash statements
+const SelectAllStmt = `SELECT ` + SelectColumns + ` FROM job_applications WHERE deleted_at IS NULL AND archived_at IS NULL`
+const SelectWithArchivedStmt = `SELECT ` + SelectColumns + ` FROM job_applications WHERE deleted_at IS NULL`
+const SelectArchivedStmt = `SELECT ` + SelectColumns + ` FROM job_applications WHERE deleted_at IS NULL AND archived_at IS NOT NULL`
+const SelectByIDStmt = `SELECT ` + SelectColumns + ` FROM job_applications WHERE id = ? AND deleted_at IS NULL`
+const SelectAnyByIDStmt = `SELECT ` + SelectColumns + ` FROM job_applications WHERE id = ?`
+
+// UpdateStmt and the other single row writes take the expected version as their last argument, 0 matches any version
+const UpdateStmt = `UPDATE job_applications SET company = ?, position = ?, link = ?, status = ?, notes = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND deleted_at IS NULL AND version = COALESCE(NULLIF(?, 0), version)`
+const SoftDeleteStmt = `UPDATE job_applications SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND deleted_at IS NULL AND version = COALESCE(NULLIF(?, 0), version)`
+const ArchiveStmt = `UPDATE job_applications SET archived_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND deleted_at IS NULL AND version = COALESCE(NULLIF(?, 0), version)`
+const UnarchiveStmt = `UPDATE job_applications SET archived_at = NULL, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND deleted_at IS NULL AND version = COALESCE(NULLIF(?, 0), version)`
 const ImportStmt = `INSERT INTO job_applications (company, position, link, status, notes, created_at) VALUES (?, ?, ?, ?, ?, ?)`
 
+const SelectTrashStmt = `SELECT ` + SelectColumns + ` FROM job_applications WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+const RestoreStmt = `UPDATE job_applications SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND deleted_at IS NOT NULL`
+const PurgeStmt = `DELETE FROM job_applications WHERE id = ? AND deleted_at IS NOT NULL`
+const PurgeAllStmt = `DELETE FROM job_applications WHERE deleted_at IS NOT NULL`
+
+// PurgeExpiredStmt takes the retention period in seconds
+const PurgeExpiredStmt = `DELETE FROM job_applications WHERE deleted_at IS NOT NULL AND deleted_at < datetime('now', '-' || ? || ' seconds')`
+
+// PurgeOrphanedChangesStmt removes the history of applications that no longer exist
+const PurgeOrphanedChangesStmt = `DELETE FROM job_application_changes WHERE application_id NOT IN (SELECT id FROM job_applications)`
+
+// RestoreStateStmt writes a full snapshot back, as done by undo and redo. The last two arguments are the ID and expected version.
+const RestoreStateStmt = `UPDATE job_applications SET company = ?, position = ?, link = ?, status = ?, notes = ?, archived_at = ?, deleted_at = ?, updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = ? AND version = ?`
+
+const TagColumns = `t.id, t.name, t.color, t.created_at, (SELECT COUNT(*) FROM job_application_tags jat WHERE jat.tag_id = t.id)`
+const SelectTagsStmt = `SELECT ` + TagColumns + ` FROM tags t ORDER BY t.name COLLATE NOCASE`
+const SelectTagByIDStmt = `SELECT ` + TagColumns + ` FROM tags t WHERE t.id = ?`
+const InsertTagStmt = `INSERT INTO tags (name, color) VALUES (?, ?)`
+const UpdateTagStmt = `UPDATE tags SET name = ?, color = ? WHERE id = ?`
+const DeleteTagStmt = `DELETE FROM tags WHERE id = ?`
+
+// EnsureTagStmt creates a tag by name unless one already exists, ignoring case
+const EnsureTagStmt = `INSERT INTO tags (name) SELECT ?1 WHERE NOT EXISTS (SELECT 1 FROM tags WHERE name = ?1)`
+const ClearApplicationTagsStmt = `DELETE FROM job_application_tags WHERE application_id = ?`
+const AddApplicationTagStmt = `INSERT OR IGNORE INTO job_application_tags (application_id, tag_id) SELECT ?, id FROM tags WHERE name = ?`
+const SelectApplicationTagsStmt = `SELECT jat.application_id, t.name FROM job_application_tags jat JOIN tags t ON t.id = jat.tag_id ORDER BY t.name COLLATE NOCASE`
+const SelectApplicationTagsByIDStmt = `SELECT jat.application_id, t.name FROM job_application_tags jat JOIN tags t ON t.id = jat.tag_id WHERE jat.application_id = ? ORDER BY t.name COLLATE NOCASE`
+
+// TaggedWithFilter restricts a job_applications query to rows carrying the tags bound to the
+// placeholders in %s; the final argument is how many of them must match
+const TaggedWithFilter = ` AND id IN (SELECT jat.application_id FROM job_application_tags jat JOIN tags t ON t.id = jat.tag_id WHERE t.name IN (%s) GROUP BY jat.application_id HAVING COUNT(DISTINCT t.id) >= ?)`
+
+const AttachmentColumns = `id, application_id, kind, filename, content_type, size, sha256, created_at, text_status`
+const InsertAttachmentStmt = `INSERT INTO attachments (application_id, kind, filename, content_type, size, sha256) VALUES (?, ?, ?, ?, ?, ?)`
+const SelectAttachmentsStmt = `SELECT ` + AttachmentColumns + ` FROM attachments WHERE application_id = ? ORDER BY id`
+const SelectAttachmentStmt = `SELECT ` + AttachmentColumns + ` FROM attachments WHERE application_id = ? AND id = ?`
+const SelectAttachmentByHashStmt = `SELECT ` + AttachmentColumns + ` FROM attachments WHERE application_id = ? AND sha256 = ?`
+const DeleteAttachmentStmt = `DELETE FROM attachments WHERE application_id = ? AND id = ?`
+const SelectPendingAttachmentsStmt = `SELECT ` + AttachmentColumns + ` FROM attachments WHERE text_status = 'pending' ORDER BY id LIMIT ?`
+const SetAttachmentTextStatusStmt = `UPDATE attachments SET text_status = ? WHERE id = ?`
+const DeleteAttachmentTextStmt = `DELETE FROM attachment_search WHERE docid = ?`
+const InsertAttachmentTextStmt = `INSERT INTO attachment_search (docid, filename, body) VALUES (?, ?, ?)`
+const SelectAttachmentTextStmt = `SELECT body FROM attachment_search WHERE docid = ?`
+
+// SearchStmt finds applications whose title or notes, or whose attachments, match the full-text
+// query in the first argument. The second argument is the maximum number of results.
+const SearchStmt = `SELECT * FROM (
+	SELECT j.id, j.company, j.position, j.status, 'application' AS source, 0, '', snippet(application_search, '**', '**', '…', -1, 16), j.updated_at
+	FROM application_search JOIN job_applications j ON j.id = application_search.docid
+	WHERE application_search MATCH ?1 AND j.deleted_at IS NULL
+	UNION ALL
+	SELECT j.id, j.company, j.position, j.status, 'attachment' AS source, a.id, a.filename, snippet(attachment_search, '**', '**', '…', -1, 16), j.updated_at
+	FROM attachment_search JOIN attachments a ON a.id = attachment_search.docid JOIN job_applications j ON j.id = a.application_id
+	WHERE attachment_search MATCH ?1 AND j.deleted_at IS NULL
+	) ORDER BY updated_at DESC, source LIMIT ?2`
+
+// CountBlobReferencesStmt counts the attachments and documents whose content has the given hash
+const CountBlobReferencesStmt = `SELECT (SELECT COUNT(*) FROM attachments WHERE sha256 = ?1) + (SELECT COUNT(*) FROM documents WHERE sha256 = ?1)`
+const SelectBlobHashesStmt = `SELECT sha256 FROM attachments UNION SELECT sha256 FROM documents`
+
+const DocumentColumns = `d.id, d.name, d.version, d.kind, d.filename, d.content_type, d.size, d.sha256, d.created_at, (SELECT COUNT(*) FROM application_documents ad WHERE ad.document_id = d.id)`
+
+// InsertDocumentStmt stores the next version of the named document, keeping the spelling of its first version
+const InsertDocumentStmt = `INSERT INTO documents (name, version, kind, filename, content_type, size, sha256) SELECT COALESCE(MIN(name), ?1), COALESCE(MAX(version), 0) + 1, ?2, ?3, ?4, ?5, ?6 FROM documents WHERE name = ?1`
+const SelectDocumentsStmt = `SELECT ` + DocumentColumns + ` FROM documents d ORDER BY d.name COLLATE NOCASE, d.version DESC`
+const SelectDocumentsByNameStmt = `SELECT ` + DocumentColumns + ` FROM documents d WHERE d.name = ? ORDER BY d.version DESC`
+const SelectDocumentByIDStmt = `SELECT ` + DocumentColumns + ` FROM documents d WHERE d.id = ?`
+const SelectDocumentByHashStmt = `SELECT ` + DocumentColumns + ` FROM documents d WHERE d.name = ? AND d.sha256 = ?`
+const DeleteDocumentStmt = `DELETE FROM documents WHERE id = ?`
+const LinkDocumentStmt = `INSERT OR IGNORE INTO application_documents (application_id, document_id) VALUES (?, ?)`
+const UnlinkDocumentStmt = `DELETE FROM application_documents WHERE application_id = ? AND document_id = ?`
+const SelectApplicationDocumentsStmt = `SELECT ` + DocumentColumns + ` FROM documents d JOIN application_documents l ON l.document_id = d.id WHERE l.application_id = ? ORDER BY d.kind, d.name COLLATE NOCASE`
+
+// DocumentOutcomesStmt counts the applications each document was sent with by their status.
+// Documents that were never used appear once with a NULL status.
+const DocumentOutcomesStmt = `SELECT d.id, d.name, d.version, d.kind, j.status, COUNT(j.id) FROM documents d
+	LEFT JOIN application_documents l ON l.document_id = d.id
+	LEFT JOIN job_applications j ON j.id = l.application_id AND j.deleted_at IS NULL
+	GROUP BY d.id, j.status ORDER BY d.name COLLATE NOCASE, d.version`
+
+const JobDescriptionColumns = `application_id, version, markdown, source, created_at`
+
+// InsertJobDescriptionStmt stores the next version of an application's job description
+const InsertJobDescriptionStmt = `INSERT INTO job_descriptions (application_id, version, markdown, source) SELECT ?1, COALESCE(MAX(version), 0) + 1, ?2, ?3 FROM job_descriptions WHERE application_id = ?1`
+const SelectJobDescriptionsStmt = `SELECT ` + JobDescriptionColumns + ` FROM job_descriptions WHERE application_id = ? ORDER BY version DESC`
+const SelectLatestJobDescriptionStmt = `SELECT ` + JobDescriptionColumns + ` FROM job_descriptions WHERE application_id = ? ORDER BY version DESC LIMIT 1`
+const SelectJobDescriptionVersionStmt = `SELECT ` + JobDescriptionColumns + ` FROM job_descriptions WHERE application_id = ? AND version = ?`
+
+// FunnelStmt lists the applications created within a date range (inclusive, either end may be
+// empty) with whether their status, now or at any earlier point, reached interview and offer
+const FunnelStmt = `SELECT j.id, j.company, j.link, j.status,
+	j.status IN ('interview', 'offer') OR COALESCE(h.interviewed, 0), j.status = 'offer' OR COALESCE(h.offered, 0)
+	FROM job_applications j
+	LEFT JOIN (SELECT application_id,
+		MAX(json_extract(after_state, '$.status') IN ('interview', 'offer')) AS interviewed,
+		MAX(json_extract(after_state, '$.status') = 'offer') AS offered
+		FROM job_application_changes GROUP BY application_id) h ON h.application_id = j.id
+	WHERE j.deleted_at IS NULL AND (?1 = '' OR date(j.created_at) >= ?1) AND (?2 = '' OR date(j.created_at) <= ?2)
+	ORDER BY j.id`
+
+// StatusTimelineStmt lists the applications created within a date range, like FunnelStmt, each
+// with the status before and after every change recorded for it, oldest first
+const StatusTimelineStmt = `SELECT j.id, j.status, j.created_at, c.created_at,
+	json_extract(c.before_state, '$.status'), json_extract(c.after_state, '$.status')
+	FROM job_applications j
+	LEFT JOIN job_application_changes c ON c.application_id = j.id
+	WHERE j.deleted_at IS NULL AND (?1 = '' OR date(j.created_at) >= ?1) AND (?2 = '' OR date(j.created_at) <= ?2)
+	ORDER BY j.id, c.id`
+
+// SelectGhostedStmt lists open applications on the board that have not changed for the given number of days
+const SelectGhostedStmt = `SELECT ` + SelectColumns + ` FROM job_applications WHERE deleted_at IS NULL AND archived_at IS NULL
+	AND status IN ('applied', 'interview') AND updated_at < datetime('now', '-' || ? || ' days') ORDER BY updated_at`
+
+const GoalColumns = `metric, weekly_target, updated_at`
+const SelectGoalsStmt = `SELECT ` + GoalColumns + ` FROM goals ORDER BY metric`
+const SelectGoalStmt = `SELECT ` + GoalColumns + ` FROM goals WHERE metric = ?`
+const UpsertGoalStmt = `INSERT INTO goals (metric, weekly_target) VALUES (?1, ?2) ON CONFLICT (metric) DO UPDATE SET weekly_target = ?2, updated_at = CURRENT_TIMESTAMP`
+const DeleteGoalStmt = `DELETE FROM goals WHERE metric = ?`
+
+// ActivityStmt counts per day the applications created, their status changes and the interviews
+// reached, whether by a status change or by creating an application as interviewing. Undone
+// changes do not count.
+const ActivityStmt = `SELECT day, SUM(created), SUM(changed), SUM(interviews) FROM (
+	SELECT date(created_at) AS day, 1 AS created, 0 AS changed, 0 AS interviews FROM job_applications WHERE deleted_at IS NULL
+	UNION ALL
+	SELECT date(created_at), 0, action = 'updated' AND before_status != after_status,
+		after_status = 'interview' AND COALESCE(before_status, '') != 'interview'
+	FROM (SELECT created_at, action, json_extract(before_state, '$.status') AS before_status, json_extract(after_state, '$.status') AS after_status
+		FROM job_application_changes WHERE action IN ('created', 'updated') AND state != 'undone')
+	) GROUP BY day ORDER BY day`
+
+// SelectCreatedBetweenStmt lists the applications, archived ones included, created on the dates
+// from the first to the second argument (inclusive), oldest first
+const SelectCreatedBetweenStmt = `SELECT ` + SelectColumns + ` FROM job_applications WHERE deleted_at IS NULL
+	AND date(created_at) BETWEEN ? AND ? ORDER BY created_at, id`
+
+const ReportTemplateColumns = `name, title, header, footer, columns, updated_at`
+const SelectReportTemplatesStmt = `SELECT ` + ReportTemplateColumns + ` FROM report_templates ORDER BY name COLLATE NOCASE`
+const SelectReportTemplateStmt = `SELECT ` + ReportTemplateColumns + ` FROM report_templates WHERE name = ?`
+const UpsertReportTemplateStmt = `INSERT INTO report_templates (name, title, header, footer, columns) VALUES (?1, ?2, ?3, ?4, ?5)
+	ON CONFLICT (name) DO UPDATE SET title = ?2, header = ?3, footer = ?4, columns = ?5, updated_at = CURRENT_TIMESTAMP`
+const DeleteReportTemplateStmt = `DELETE FROM report_templates WHERE name = ?`
+
+const WebhookColumns = `id, url, description, events, secret, active, created_at, updated_at`
+const SelectWebhooksStmt = `SELECT ` + WebhookColumns + ` FROM webhooks ORDER BY id`
+const SelectWebhookStmt = `SELECT ` + WebhookColumns + ` FROM webhooks WHERE id = ?`
+const InsertWebhookStmt = `INSERT INTO webhooks (url, description, events, secret, active) VALUES (?, ?, ?, ?, ?)`
+const UpdateWebhookStmt = `UPDATE webhooks SET url = ?, description = ?, events = ?, secret = ?, active = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+const DeleteWebhookStmt = `DELETE FROM webhooks WHERE id = ?`
+
+const WebhookDeliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at, response_status, error, created_at, delivered_at`
+
+// EnqueueWebhookDeliveriesStmt queues a payload for every active webhook subscribed to the event
+// in the first argument
+const EnqueueWebhookDeliveriesStmt = `INSERT INTO webhook_deliveries (webhook_id, event, payload)
+	SELECT id, ?1, ?2 FROM webhooks WHERE active AND instr(',' || events || ',', ',' || ?1 || ',') > 0`
+
+// InsertWebhookDeliveryStmt logs a delivery that is sent right away instead of being queued
+const InsertWebhookDeliveryStmt = `INSERT INTO webhook_deliveries (webhook_id, event, payload, status) VALUES (?, ?, ?, 'sending')`
+const SelectWebhookDeliveryStmt = `SELECT ` + WebhookDeliveryColumns + ` FROM webhook_deliveries WHERE id = ?`
+
+// SelectWebhookDeliveriesStmt lists a webhook's most recent deliveries, the last argument is the maximum number
+const SelectWebhookDeliveriesStmt = `SELECT ` + WebhookDeliveryColumns + ` FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`
+
+// SelectDueWebhookDeliveriesStmt lists pending deliveries whose next attempt is due, oldest first
+const SelectDueWebhookDeliveriesStmt = `SELECT ` + WebhookDeliveryColumns + ` FROM webhook_deliveries
+	WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP ORDER BY id LIMIT ?`
+
+// UpdateWebhookDeliveryStmt records an attempt. The fifth argument is the delay in seconds
+// before the next attempt, delivered_at is set once the delivery succeeded.
+const UpdateWebhookDeliveryStmt = `UPDATE webhook_deliveries SET status = ?1, attempts = ?2, response_status = ?3, error = ?4,
+	next_attempt_at = datetime('now', '+' || ?5 || ' seconds'), delivered_at = CASE WHEN ?1 = 'succeeded' THEN CURRENT_TIMESTAMP END
+	WHERE id = ?6`
+
+const InsertNotificationStmt = `INSERT OR IGNORE INTO sent_notifications (channel, kind, key) VALUES (?, ?, ?)`
+const SelectNotificationStmt = `SELECT EXISTS (SELECT 1 FROM sent_notifications WHERE channel = ? AND kind = ? AND key = ?)`
+
+// SelectChangesBetweenStmt lists the snapshots of every change made from the first timestamp
+// (inclusive) to the second (exclusive), oldest first
+const SelectChangesBetweenStmt = `SELECT before_state, after_state, created_at FROM job_application_changes
+	WHERE created_at >= ? AND created_at < ? ORDER BY id`
+
+const InboxRuleColumns = `id, status, pattern, apply`
+const SelectInboxRulesStmt = `SELECT ` + InboxRuleColumns + ` FROM inbox_rules ORDER BY position, id`
+const DeleteInboxRulesStmt = `DELETE FROM inbox_rules`
+const InsertInboxRuleStmt = `INSERT INTO inbox_rules (position, status, pattern, apply) VALUES (?, ?, ?, ?)`
+
+const InboundMessageColumns = `id, message_id, sender, subject, sent_at, application_id, matched_by, rule_id, status, state, attachment_id, created_at`
+const SelectInboundMessagesStmt = `SELECT ` + InboundMessageColumns + ` FROM inbound_messages WHERE ?1 = '' OR state = ?1 ORDER BY id DESC LIMIT ?2`
+const SelectInboundMessageStmt = `SELECT ` + InboundMessageColumns + ` FROM inbound_messages WHERE id = ?`
+const SelectInboundMessageRawStmt = `SELECT raw FROM inbound_messages WHERE id = ?`
+const SelectInboundMessageByMessageIDStmt = `SELECT ` + InboundMessageColumns + ` FROM inbound_messages WHERE message_id = ?`
+const InsertInboundMessageStmt = `INSERT INTO inbound_messages (message_id, sender, subject, sent_at, raw, state) VALUES (?, ?, ?, ?, ?, ?)`
+
+// UpdateInboundMessageStmt records what became of a message. The raw message is dropped once
+// it is attached to an application.
+const UpdateInboundMessageStmt = `UPDATE inbound_messages SET application_id = ?1, matched_by = ?2, rule_id = ?3, status = ?4, state = ?5,
+	attachment_id = ?6, raw = CASE WHEN ?6 IS NULL THEN raw END WHERE id = ?7`
+
+const ChangeColumns = `id, application_id, action, actor, group_key, before_state, after_state, state, result_version, created_at`
+const InsertChangeStmt = `INSERT INTO job_application_changes (application_id, action, actor, group_key, before_state, after_state, state, result_version) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+const SelectChangesByApplicationStmt = `SELECT ` + ChangeColumns + ` FROM job_application_changes WHERE application_id = ? ORDER BY id`
+const SelectLatestChangeByStateStmt = `SELECT ` + ChangeColumns + ` FROM job_application_changes WHERE actor = ? AND state = ? ORDER BY id DESC LIMIT 1`
+const SelectOldestChangeByStateStmt = `SELECT ` + ChangeColumns + ` FROM job_application_changes WHERE actor = ? AND state = ? ORDER BY id ASC LIMIT 1`
+const SelectChangeGroupStmt = `SELECT ` + ChangeColumns + ` FROM job_application_changes WHERE actor = ? AND state = ? AND group_key = ? ORDER BY id`
+const UpdateChangeStateStmt = `UPDATE job_application_changes SET state = ?, result_version = ? WHERE id = ?`
+const UpdateChangeResultVersionStmt = `UPDATE job_application_changes SET result_version = ? WHERE id = ?`
+
+// SelectPreviousChangeStmt and SelectNextChangeStmt find an actor's change of an application
+// in the given state that comes right before or after a change
+const SelectPreviousChangeStmt = `SELECT ` + ChangeColumns + ` FROM job_application_changes WHERE actor = ? AND application_id = ? AND state = ? AND id < ? ORDER BY id DESC LIMIT 1`
+const SelectNextChangeStmt = `SELECT ` + ChangeColumns + ` FROM job_application_changes WHERE actor = ? AND application_id = ? AND state = ? AND id > ? ORDER BY id ASC LIMIT 1`
+
+// DiscardRedoStmt drops an actor's undone changes once they make a new change
+const DiscardRedoStmt = `UPDATE job_application_changes SET state = 'discarded' WHERE actor = ? AND state = 'undone'`
+
+// TrimHistoryStmt keeps only the most recent revertible changes of an actor, the last argument is the depth
+const TrimHistoryStmt = `UPDATE job_application_changes SET state = 'discarded' WHERE actor = ? AND state = 'applied' AND id NOT IN (SELECT id FROM job_application_changes WHERE actor = ? AND state = 'applied' ORDER BY id DESC LIMIT ?)`
+
 func InitDB(dbName string, logger *slog.Logger) (*sql.DB, error) {
 	// Create the data directory if it doesn't exist
 	if err := os.MkdirAll("data", 0755); err != nil {
@@ -36,7 +455,8 @@ func InitDB(dbName string, logger *slog.Logger) (*sql.DB, error) {
 
 	dbPath := filepath.Join("data", dbName)
 
-	db, err := sql.Open("sqlite3", dbPath)
+	// Foreign keys are off by default in SQLite, and the busy timeout lets concurrent writers wait instead of failing
+	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on&_busy_timeout=5000")
 	if err != nil {
 		return nil, err
 	}
@@ -52,5 +472,38 @@ func InitDB(dbName string, logger *slog.Logger) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	if err := migrate(db, logger); err != nil {
+		return nil, err
+	}
 	return db, nil
 }
+
+// migrate applies every migration that has not been applied yet, each in its own transaction
+func migrate(db *sql.DB, logger *slog.Logger) error {
+	var current int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&current); err != nil {
+		return err
+	}
+
+	for i := current; i < len(Migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(Migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		// PRAGMA does not support bound parameters
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		logger.Info("Applied database migration", "version", i+1)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+// Package diff compares texts line by line using Myers' algorithm.
+package diff
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Line operations
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// Line is one line of a diff
+type Line struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// SplitLines splits text into lines, ignoring a trailing newline
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Lines returns the shortest edit turning a into b. It uses the linear space variant of the
+// algorithm, so memory grows with the length of the texts rather than with the number of edits.
+func Lines(a, b []string) []Line {
+	total := len(a) + len(b)
+	if total == 0 {
+		return nil
+	}
+
+	// The search from the end runs on diagonals up to (n+m)/2 either side of n-m, plus one
+	// either side read at the edges of the search
+	offset := 2 * (total + 1)
+	d := &differ{
+		a:      a,
+		b:      b,
+		offset: offset,
+		fwd:    make([]int, 2*offset+1),
+		bwd:    make([]int, 2*offset+1),
+		lines:  make([]Line, 0, max(len(a), len(b))),
+	}
+	d.compare(0, len(a), 0, len(b))
+	return deletesFirst(d.lines)
+}
+
+// differ holds the state of one comparison. fwd[k+offset] and bwd[k+offset] are the furthest x
+// reached on diagonal k by the searches from the start and from the end of the current range.
+type differ struct {
+	a, b     []string
+	offset   int
+	fwd, bwd []int
+	lines    []Line
+}
+
+// compare appends the shortest edit turning a[aLo:aHi] into b[bLo:bHi], splitting the ranges
+// at the middle snake of the edit until one of them is empty
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.lines = append(d.lines, Line{Op: Equal, Text: d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix++
+	}
+	aHi, bHi = aHi-suffix, bHi-suffix
+
+	switch {
+	case aLo == aHi:
+		for _, text := range d.b[bLo:bHi] {
+			d.lines = append(d.lines, Line{Op: Insert, Text: text})
+		}
+	case bLo == bHi:
+		for _, text := range d.a[aLo:aHi] {
+			d.lines = append(d.lines, Line{Op: Delete, Text: text})
+		}
+	default:
+		x1, y1, x2, y2 := d.middleSnake(aLo, aHi, bLo, bHi)
+		d.compare(aLo, x1, bLo, y1)
+		for _, text := range d.a[x1:x2] {
+			d.lines = append(d.lines, Line{Op: Equal, Text: text})
+		}
+		d.compare(x2, aHi, y2, bHi)
+	}
+
+	for _, text := range d.a[aHi : aHi+suffix] {
+		d.lines = append(d.lines, Line{Op: Equal, Text: text})
+	}
+}
+
+// middleSnake returns the start and end of the snake in the middle of a shortest edit of
+// a[aLo:aHi] into b[bLo:bHi], searching from both ends until the two paths meet. The ranges must
+// be non-empty and must not start or end with the same line, so both halves around the snake
+// are smaller than the whole.
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x1, y1, x2, y2 int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	fwd, bwd, off := d.fwd, d.bwd, d.offset
+
+	fwd[off+1] = 0
+	bwd[off+delta-1] = n
+	for e := 0; e <= (n+m+1)/2; e++ {
+		for k := -e; k <= e; k += 2 {
+			var x int
+			if k == -e || (k != e && fwd[off+k-1] < fwd[off+k+1]) {
+				x = fwd[off+k+1]
+			} else {
+				x = fwd[off+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			fwd[off+k] = x
+			if odd && k >= delta-(e-1) && k <= delta+(e-1) && x >= bwd[off+k] {
+				return aLo + startX, bLo + startY, aLo + x, bLo + y
+			}
+		}
+
+		for k := delta - e; k <= delta+e; k += 2 {
+			var x int
+			if k == delta+e || (k != delta-e && bwd[off+k-1] < bwd[off+k+1]) {
+				x = bwd[off+k-1]
+			} else {
+				x = bwd[off+k+1] - 1
+			}
+			y := x - k
+			endX, endY := x, y
+			for x > 0 && y > 0 && d.a[aLo+x-1] == d.b[bLo+y-1] {
+				x--
+				y--
+			}
+			bwd[off+k] = x
+			if !odd && k >= -e && k <= e && x <= fwd[off+k] {
+				return aLo + x, bLo + y, aLo + endX, bLo + endY
+			}
+		}
+	}
+	panic("diff: paths did not meet")
+}
+
+// deletesFirst orders every run of changes so its deleted lines come before its inserted ones
+func deletesFirst(lines []Line) []Line {
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+		end := i
+		for end < len(lines) && lines[end].Op != Equal {
+			end++
+		}
+		run := slices.Clone(lines[i:end])
+		j := i
+		for _, op := range []string{Delete, Insert} {
+			for _, l := range run {
+				if l.Op == op {
+					lines[j] = l
+					j++
+				}
+			}
+		}
+		i = end
+	}
+	return lines
+}
+
+// Unified formats a diff in the unified format with the given number of context lines
+func Unified(fromName, toName string, lines []Line, context int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	// Line numbers (1-based) in a and b at the start of every diff line
+	aLine, bLine := make([]int, len(lines)), make([]int, len(lines))
+	ai, bi := 1, 1
+	for i, l := range lines {
+		aLine[i], bLine[i] = ai, bi
+		if l.Op != Insert {
+			ai++
+		}
+		if l.Op != Delete {
+			bi++
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		if lines[i].Op == Equal {
+			i++
+			continue
+		}
+
+		// Grow the hunk while changes are separated by at most 2*context equal lines
+		start := max(i-context, 0)
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Op == Equal {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				end = min(end+context, len(lines))
+				break
+			}
+			end = run
+		}
+
+		aCount, bCount := 0, 0
+		for _, l := range lines[start:end] {
+			if l.Op != Insert {
+				aCount++
+			}
+			if l.Op != Delete {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aLine[start], aCount), hunkRange(bLine[start], bCount))
+		for _, l := range lines[start:end] {
+			switch l.Op {
+			case Equal:
+				sb.WriteString(" ")
+			case Insert:
+				sb.WriteString("+")
+			case Delete:
+				sb.WriteString("-")
+			}
+			sb.WriteString(l.Text)
+			sb.WriteString("\n")
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// An empty range is given as the line before it
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,137 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// apply rebuilds both sides of a diff
+func apply(lines []Line) (a, b []string) {
+	for _, l := range lines {
+		if l.Op != Insert {
+			a = append(a, l.Text)
+		}
+		if l.Op != Delete {
+			b = append(b, l.Text)
+		}
+	}
+	return a, b
+}
+
+// edits counts the inserted and deleted lines of a diff
+func edits(lines []Line) int {
+	n := 0
+	for _, l := range lines {
+		if l.Op != Equal {
+			n++
+		}
+	}
+	return n
+}
+
+// lcs returns the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{"both empty", "", "", nil},
+		{"all inserted", "", "a\nb", []Line{{Insert, "a"}, {Insert, "b"}}},
+		{"all deleted", "a\nb", "", []Line{{Delete, "a"}, {Delete, "b"}}},
+		{"equal", "a\nb", "a\nb", []Line{{Equal, "a"}, {Equal, "b"}}},
+		{
+			"replaced line",
+			"a\nb\nc", "a\nx\nc",
+			[]Line{{Equal, "a"}, {Delete, "b"}, {Insert, "x"}, {Equal, "c"}},
+		},
+		{
+			"replaced block deletes first",
+			"a\nb\nc\nd", "a\nx\ny\nd",
+			[]Line{{Equal, "a"}, {Delete, "b"}, {Delete, "c"}, {Insert, "x"}, {Insert, "y"}, {Equal, "d"}},
+		},
+		{
+			"moved line",
+			"a\nb\nc", "b\nc\na",
+			[]Line{{Delete, "a"}, {Equal, "b"}, {Equal, "c"}, {Insert, "a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(SplitLines(tt.a), SplitLines(tt.b))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Random texts over a small alphabet have many equally short edits; every diff has to rebuild
+// both texts with as few edits as the longest common subsequence allows
+func TestLinesShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	text := func() []string {
+		lines := make([]string, rng.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 2000; i++ {
+		a, b := text(), text()
+		lines := Lines(a, b)
+		gotA, gotB := apply(lines)
+		if !slices.Equal(gotA, a) || !slices.Equal(gotB, b) {
+			t.Fatalf("diff of %q and %q rebuilds %q and %q", a, b, gotA, gotB)
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); edits(lines) != want {
+			t.Fatalf("diff of %q and %q has %d edits, want %d", a, b, edits(lines), want)
+		}
+	}
+}
+
+// Texts with nothing in common need as many edits as they have lines, which used to keep a copy
+// of the search state per edit
+func TestLinesLargeDistinct(t *testing.T) {
+	a, b := make([]string, 4000), make([]string, 4000)
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d", i)
+		b[i] = fmt.Sprintf("b%d", i)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	lines := Lines(a, b)
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4<<20 {
+		t.Errorf("Lines allocated %d bytes", allocated)
+	}
+	if edits(lines) != 8000 {
+		t.Errorf("diff has %d edits, want 8000", edits(lines))
+	}
+	if unified := Unified("a", "b", lines, 3); !strings.HasPrefix(unified, "--- a\n+++ b\n@@ -1,4000 +1,4000 @@\n-a0\n") {
+		t.Errorf("unexpected unified diff start %q", unified[:min(len(unified), 60)])
+	}
+}
@@ -0,0 +1,168 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+)
+
+// maxPartDepth limits how deeply multipart bodies are descended into
+const maxPartDepth = 5
+
+// headerDecoder decodes RFC 2047 encoded words in UTF-8, US-ASCII and Latin-1
+var headerDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// DecodeHeader decodes the encoded words of a message header
+func DecodeHeader(value string) string {
+	decoded, err := headerDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// MessageText returns the body of an email as plain text, preferring a text/plain part over
+// an HTML one
+func MessageText(m *mail.Message) (string, error) {
+	plain, html, err := partText(m.Header, m.Body, 0)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(plain) == "" && html != "" {
+		return htmlText([]byte(html))
+	}
+	return plain, nil
+}
+
+// emailText extracts the subject, sender and body of an RFC 822 message
+func emailText(data []byte) (string, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	body, err := MessageText(m)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, h := range []string{"From", "To", "Date", "Subject"} {
+		if v := m.Header.Get(h); v != "" {
+			b.WriteString(h + ": " + DecodeHeader(v) + "\n")
+		}
+	}
+	return b.String() + "\n" + body, nil
+}
+
+// header is the part of a MIME header that decides how a body is decoded
+type header interface {
+	Get(key string) string
+}
+
+// partText returns the text/plain and text/html content of a body, descending into
+// multipart bodies. Attachments are skipped.
+func partText(h header, body io.Reader, depth int) (plain, html string, err error) {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if disposition, _, _ := mime.ParseMediaType(h.Get("Content-Disposition")); disposition == "attachment" {
+		return "", "", nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxPartDepth || params["boundary"] == "" {
+			return "", "", nil
+		}
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := r.NextRawPart()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return plain, html, err
+			}
+			pp, ph, err := partText(p.Header, p, depth+1)
+			if err != nil {
+				return plain, html, err
+			}
+			// The first alternative of each kind wins, the parts of a mixed body add up
+			if pp != "" && (mediaType != "multipart/alternative" || plain == "") {
+				plain += pp + "\n"
+			}
+			if ph != "" && (mediaType != "multipart/alternative" || html == "") {
+				html += ph + "\n"
+			}
+		}
+		return plain, html, nil
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return "", "", nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(io.LimitReader(body, MaxTextLength))
+	if err != nil {
+		return "", "", err
+	}
+	text := decodeCharset(params["charset"], data)
+	if mediaType == "text/html" {
+		return "", text, nil
+	}
+	return text, "", nil
+}
+
+// newlineStripper drops the line breaks base64 bodies are wrapped with
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		c, err := n.r.Read(p)
+		j := 0
+		for _, b := range p[:c] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[j] = b
+				j++
+			}
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
+// decodeCharset converts text in the charsets common in email to UTF-8
+func decodeCharset(charset string, data []byte) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "cp1252":
+		r := make([]rune, len(data))
+		for i, b := range data {
+			r[i] = rune(b)
+		}
+		return string(r)
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+// charsetReader lets the header decoder read Latin-1 in addition to UTF-8 and US-ASCII, text in
+// other charsets is kept where it is valid UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(decodeCharset(charset, data)), nil
+}
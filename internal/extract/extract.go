@@ -0,0 +1,90 @@
+// Package extract pulls plain text out of uploaded documents so they can be searched.
+// Everything is implemented with the standard library; formats that would need external
+// tools (scanned images, legacy Word files) are reported as unsupported.
+package extract
+
+import (
+	"errors"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrUnsupported is returned for content types text cannot be extracted from
+var ErrUnsupported = errors.New("unsupported format")
+
+// MaxTextLength caps the length of extracted text in bytes
+const MaxTextLength = 1 << 20
+
+// Supported reports whether text can be extracted from content of the given type
+func Supported(contentType string) bool {
+	_, ok := extractors[mediaType(contentType)]
+	return ok
+}
+
+var extractors = map[string]func([]byte) (string, error){
+	"application/pdf": pdfText,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": docxText,
+	"application/vnd.oasis.opendocument.text":                                 odtText,
+	"text/html":      htmlText,
+	"text/plain":     plainText,
+	"text/markdown":  plainText,
+	"message/rfc822": emailText,
+}
+
+// Text extracts the plain text of data, which has the given content type
+func Text(contentType string, data []byte) (string, error) {
+	extract, ok := extractors[mediaType(contentType)]
+	if !ok {
+		return "", ErrUnsupported
+	}
+
+	text, err := extract(data)
+	if err != nil {
+		return "", err
+	}
+	return truncate(normalizeSpace(text), MaxTextLength), nil
+}
+
+func mediaType(contentType string) string {
+	t, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+	return t
+}
+
+func plainText(data []byte) (string, error) {
+	return strings.ToValidUTF8(string(data), "�"), nil
+}
+
+// normalizeSpace trims trailing spaces from every line and collapses runs of blank lines
+func normalizeSpace(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r\f\v")
+		if strings.TrimSpace(line) == "" {
+			if !blank && len(out) > 0 {
+				out = append(out, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,56 @@
+package extract
+
+import (
+	"html"
+	"strings"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/htmlscan"
+)
+
+// htmlBlockElements start on a new line when rendered
+var htmlBlockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hr": true, "li": true, "main": true, "nav": true, "ol": true,
+	"p": true, "pre": true, "section": true, "table": true, "tr": true, "ul": true,
+}
+
+// htmlSkippedElements have content that is not rendered as text
+var htmlSkippedElements = map[string]bool{
+	"script": true, "style": true, "head": true, "noscript": true, "template": true, "svg": true,
+}
+
+// htmlText renders an HTML document as plain text, one block element per line
+func htmlText(data []byte) (string, error) {
+	return HTMLToText(string(data)), nil
+}
+
+// HTMLToText strips the markup from an HTML fragment or document, keeping block elements on
+// their own lines and dropping scripts and styles
+func HTMLToText(s string) string {
+	var sb strings.Builder
+	text := func(s string) {
+		sb.WriteString(html.UnescapeString(s))
+	}
+	tag := func(name string, closing bool, attrs string) {
+		if htmlBlockElements[name] {
+			if !strings.HasSuffix(sb.String(), "\n") {
+				sb.WriteByte('\n')
+			}
+		} else if name == "td" || name == "th" {
+			sb.WriteByte('\t')
+		}
+	}
+	htmlscan.Scan(s, htmlSkippedElements, text, tag)
+	return collapseInlineSpace(sb.String())
+}
+
+// collapseInlineSpace turns runs of spaces within a line into one, as browsers do
+func collapseInlineSpace(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.Join(lines, "\n")
+}
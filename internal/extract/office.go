@@ -0,0 +1,120 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxXMLPartSize guards against zip bombs in office documents
+const maxXMLPartSize = 32 << 20
+
+// docxText extracts the body text of a Word document, keeping paragraph breaks
+func docxText(data []byte) (string, error) {
+	return zipXMLText(data, "word/document.xml", func(name string, start bool, attr []xml.Attr) string {
+		switch name {
+		case "p":
+			if !start {
+				return "\n"
+			}
+		case "tab":
+			if start {
+				return "\t"
+			}
+		case "br", "cr":
+			if start {
+				return "\n"
+			}
+		}
+		return ""
+	}, "t")
+}
+
+// odtText extracts the body text of an OpenDocument text document
+func odtText(data []byte) (string, error) {
+	return zipXMLText(data, "content.xml", func(name string, start bool, attr []xml.Attr) string {
+		switch name {
+		case "p", "h":
+			if !start {
+				return "\n"
+			}
+		case "tab":
+			if start {
+				return "\t"
+			}
+		case "line-break":
+			if start {
+				return "\n"
+			}
+		case "s":
+			// <text:s text:c="3"/> stands for several spaces
+			if start {
+				n := 1
+				for _, a := range attr {
+					if a.Name.Local == "c" {
+						if c, err := strconv.Atoi(a.Value); err == nil && c > 0 && c < 100 {
+							n = c
+						}
+					}
+				}
+				return strings.Repeat(" ", n)
+			}
+		}
+		return ""
+	}, "p", "h", "span", "a")
+}
+
+// zipXMLText reads the XML part of a zip based document and collects the character data found
+// inside the textElements. markup returns the text that an element's start or end stands for.
+func zipXMLText(data []byte, part string, markup func(name string, start bool, attr []xml.Attr) string, textElements ...string) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("reading document archive: %w", err)
+	}
+
+	f, err := zr.Open(part)
+	if err != nil {
+		return "", fmt.Errorf("document has no %s: %w", part, err)
+	}
+	defer f.Close()
+
+	dec := xml.NewDecoder(io.LimitReader(f, maxXMLPartSize))
+	var sb strings.Builder
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("parsing %s: %w", part, err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if slices.Contains(textElements, t.Name.Local) {
+				depth++
+			}
+			sb.WriteString(markup(t.Name.Local, true, t.Attr))
+		case xml.EndElement:
+			if slices.Contains(textElements, t.Name.Local) {
+				depth--
+			}
+			sb.WriteString(markup(t.Name.Local, false, nil))
+		case xml.CharData:
+			if depth > 0 {
+				sb.Write(t)
+			}
+		}
+		if sb.Len() > MaxTextLength {
+			break
+		}
+	}
+	return sb.String(), nil
+}
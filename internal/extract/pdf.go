@@ -0,0 +1,1058 @@
+package extract
+
+import (
+	"bytes"
+	"cmp"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// This is a deliberately small PDF reader: it locates objects by scanning for "n g obj" rather
+// than trusting the cross-reference table, which also copes with damaged files, decodes the
+// common stream filters and interprets just the text operators of page content streams.
+// Uploads are untrusted, so every number taken from the file is range checked and the work
+// done per file is bounded.
+
+const (
+	// maxFormDepth limits how deeply form XObjects drawn by other forms are followed
+	maxFormDepth = 4
+	// maxNesting limits how deeply arrays and dictionaries may nest
+	maxNesting = 64
+	// maxOperations and maxScanned cap the tokens and bytes of content streams interpreted per
+	// file, pages sharing a stream and forms drawn by forms can otherwise multiply the work
+	maxOperations = 5_000_000
+	maxScanned    = 256 << 20
+	// maxDecoded caps the bytes decoded from streams per file
+	maxDecoded = 256 << 20
+	// maxStreamSize caps the decoded size of a single stream
+	maxStreamSize = 64 << 20
+)
+
+type (
+	pdfName   string
+	pdfString []byte
+	pdfRef    struct{ num, gen int }
+	pdfDict   map[pdfName]any
+	pdfArray  []any
+	// pdfKeyword is an operator or keyword such as BT, Tj, obj or R
+	pdfKeyword string
+)
+
+type pdfObject struct {
+	value  any
+	stream []byte
+}
+
+type pdfFile struct {
+	objects map[int]*pdfObject
+	fonts   map[pdfRef]*pdfFont
+	cmaps   map[pdfRef]*toUnicode
+	// streams caches decoded streams by object number, pages often share them
+	streams map[int][]byte
+	// operations, scanned and decoded count the work done so far, see maxOperations,
+	// maxScanned and maxDecoded
+	operations int
+	scanned    int
+	decoded    int
+}
+
+var errTooMuchData = errors.New("too much data")
+
+var objHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func pdfText(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF")) {
+		return "", errors.New("not a PDF file")
+	}
+
+	f := &pdfFile{
+		objects: map[int]*pdfObject{},
+		fonts:   map[pdfRef]*pdfFont{},
+		cmaps:   map[pdfRef]*toUnicode{},
+		streams: map[int][]byte{},
+	}
+	f.readObjects(data)
+	if f.hasEncryption() {
+		return "", fmt.Errorf("%w: encrypted PDF", ErrUnsupported)
+	}
+	f.readObjectStreams()
+
+	var sb strings.Builder
+	for _, page := range f.pages() {
+		f.pageText(&sb, page)
+		sb.WriteString("\n\n")
+		if sb.Len() > MaxTextLength {
+			break
+		}
+	}
+	return sb.String(), nil
+}
+
+// readObjects parses every top-level "n g obj ... endobj" in the file. Later definitions of
+// an object replace earlier ones, as incremental updates are appended to the file.
+func (f *pdfFile) readObjects(data []byte) {
+	headers := objHeader.FindAllSubmatchIndex(data, -1)
+	endstreams := indexAll(data, []byte("endstream"))
+	for i, m := range headers {
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+
+		// A value never runs into the next object, so damaged objects cannot make every
+		// object after them be read to the end of the file
+		end := len(data)
+		if i+1 < len(headers) {
+			end = headers[i+1][0]
+		}
+		lx := &pdfLexer{data: data[:end], pos: m[1]}
+		value, err := lx.value()
+		if err != nil {
+			continue
+		}
+		obj := &pdfObject{value: value}
+
+		if dict, ok := value.(pdfDict); ok {
+			if kw, _ := lx.peekKeyword(); kw == "stream" {
+				lx.next()
+				// The stream's data may well contain something that looks like an object header
+				lx.data = data
+				obj.stream = lx.streamData(dict, endstreams)
+			}
+		}
+		f.objects[num] = obj
+	}
+}
+
+// indexAll returns the offset of every occurrence of sep in data
+func indexAll(data, sep []byte) []int {
+	var offsets []int
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], sep)
+		if i < 0 {
+			return offsets
+		}
+		offsets = append(offsets, pos+i)
+		pos += i + len(sep)
+	}
+}
+
+// pdfInt returns v as an int if it is a whole number between 0 and limit
+func pdfInt(v any, limit int) (int, bool) {
+	n, ok := v.(float64)
+	if !ok || n < 0 || n > float64(limit) || n != float64(int(n)) {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// readObjectStreams adds the objects stored compressed inside object streams
+func (f *pdfFile) readObjectStreams() {
+	for _, obj := range f.snapshot() {
+		dict, ok := obj.value.(pdfDict)
+		if !ok || dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		data, err := f.decode(dict, obj.stream)
+		if err != nil {
+			continue
+		}
+
+		n, _ := pdfInt(f.resolve(dict["N"]), len(data))
+		first, ok := pdfInt(f.resolve(dict["First"]), len(data))
+		if !ok {
+			continue
+		}
+
+		// The header lists object numbers and offsets relative to First
+		header := &pdfLexer{data: data[:first]}
+		for range n {
+			numV, err1 := header.value()
+			offV, err2 := header.value()
+			if err1 != nil || err2 != nil {
+				break
+			}
+			num, ok1 := pdfInt(numV, math.MaxInt32)
+			off, ok2 := pdfInt(offV, len(data)-first)
+			if !ok1 || !ok2 {
+				continue
+			}
+			if _, exists := f.objects[num]; exists {
+				continue
+			}
+			lx := &pdfLexer{data: data, pos: first + off}
+			if v, err := lx.value(); err == nil {
+				f.objects[num] = &pdfObject{value: v}
+			}
+		}
+	}
+}
+
+func (f *pdfFile) snapshot() []*pdfObject {
+	objs := make([]*pdfObject, 0, len(f.objects))
+	for _, o := range f.objects {
+		objs = append(objs, o)
+	}
+	return objs
+}
+
+func (f *pdfFile) hasEncryption() bool {
+	for _, obj := range f.objects {
+		if dict, ok := obj.value.(pdfDict); ok {
+			if _, ok := dict["Encrypt"]; ok && dict["Root"] != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resolve follows indirect references
+func (f *pdfFile) resolve(v any) any {
+	for range 8 {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		obj, ok := f.objects[ref.num]
+		if !ok {
+			return nil
+		}
+		v = obj.value
+	}
+	return nil
+}
+
+func (f *pdfFile) dict(v any) pdfDict {
+	d, _ := f.resolve(v).(pdfDict)
+	return d
+}
+
+// streamOf returns the decoded stream of the object v refers to
+func (f *pdfFile) streamOf(v any) ([]byte, pdfDict) {
+	ref, ok := v.(pdfRef)
+	if !ok {
+		return nil, nil
+	}
+	obj, ok := f.objects[ref.num]
+	if !ok || obj.stream == nil {
+		return nil, nil
+	}
+	dict, _ := obj.value.(pdfDict)
+	if data, ok := f.streams[ref.num]; ok {
+		return data, dict
+	}
+	data, err := f.decode(dict, obj.stream)
+	if err != nil {
+		data = nil
+	}
+	f.streams[ref.num] = data
+	return data, dict
+}
+
+// decode applies the stream's filters
+func (f *pdfFile) decode(dict pdfDict, data []byte) ([]byte, error) {
+	if f.decoded > maxDecoded {
+		return nil, errTooMuchData
+	}
+	defer func() { f.decoded += len(data) }()
+
+	var filters []any
+	switch v := f.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{v}
+	case pdfArray:
+		filters = v
+	}
+
+	for _, filter := range filters {
+		name, _ := f.resolve(filter).(pdfName)
+		var err error
+		switch name {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data)
+		case "ASCIIHexDecode", "AHx":
+			data, err = asciiHexDecode(data)
+		case "ASCII85Decode", "A85":
+			data, err = ascii85Decode(data)
+		default:
+			return nil, fmt.Errorf("%w: filter %s", ErrUnsupported, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	// Truncated streams are common, keep whatever could be decompressed
+	out, err := io.ReadAll(io.LimitReader(zr, maxStreamSize))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func asciiHexDecode(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if isHexDigit(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	return hex.DecodeString(string(digits))
+}
+
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// pages returns the page dictionaries in document order, each with its inherited resources
+func (f *pdfFile) pages() []pdfDict {
+	var root pdfDict
+	for _, obj := range f.objects {
+		if d, ok := obj.value.(pdfDict); ok && d["Type"] == pdfName("Catalog") {
+			root = d
+			break
+		}
+	}
+
+	var pages []pdfDict
+	seen := map[pdfRef]bool{}
+	var walk func(node any, resources any, depth int)
+	walk = func(node any, resources any, depth int) {
+		if depth > 32 {
+			return
+		}
+		if ref, ok := node.(pdfRef); ok {
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+		}
+		d := f.dict(node)
+		if d == nil {
+			return
+		}
+		if r, ok := d["Resources"]; ok {
+			resources = r
+		}
+		if kids, ok := f.resolve(d["Kids"]).(pdfArray); ok {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		page := pdfDict{"Contents": d["Contents"], "Resources": resources}
+		pages = append(pages, page)
+	}
+	if root != nil {
+		walk(root["Pages"], nil, 0)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	// Without a usable page tree, fall back to every page object in object number order
+	nums := make([]int, 0, len(f.objects))
+	for num := range f.objects {
+		nums = append(nums, num)
+	}
+	slices.Sort(nums)
+	for _, num := range nums {
+		if d, ok := f.objects[num].value.(pdfDict); ok && d["Type"] == pdfName("Page") {
+			pages = append(pages, d)
+		}
+	}
+	return pages
+}
+
+func (f *pdfFile) pageText(sb *strings.Builder, page pdfDict) {
+	var content []byte
+	switch v := f.resolve(page["Contents"]).(type) {
+	case pdfArray:
+		for _, part := range v {
+			data, _ := f.streamOf(part)
+			content = append(content, data...)
+			content = append(content, '\n')
+		}
+	default:
+		content, _ = f.streamOf(page["Contents"])
+	}
+	f.contentText(sb, content, f.dict(page["Resources"]), 0)
+}
+
+// contentText interprets the text operators of a content stream
+func (f *pdfFile) contentText(sb *strings.Builder, content []byte, resources pdfDict, depth int) {
+	f.scanned += len(content)
+	if f.scanned > maxScanned {
+		return
+	}
+	fonts := f.dict(resources["Font"])
+	xobjects := f.dict(resources["XObject"])
+
+	var font *pdfFont
+	var operands []any
+	lastY, haveY := 0.0, false
+
+	newline := func() {
+		if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteByte('\n')
+		}
+	}
+	space := func() {
+		s := sb.String()
+		if len(s) > 0 && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+			sb.WriteByte(' ')
+		}
+	}
+	show := func(s pdfString) {
+		if sb.Len() <= MaxTextLength {
+			sb.WriteString(font.decode(s))
+		}
+	}
+	moveTo := func(y float64) {
+		if haveY && y != lastY {
+			newline()
+		} else {
+			space()
+		}
+		lastY, haveY = y, true
+	}
+
+	lx := &pdfLexer{data: content}
+	for {
+		tok, err := lx.value()
+		if err != nil {
+			return
+		}
+		f.operations++
+		if f.operations > maxOperations {
+			return
+		}
+		op, ok := tok.(pdfKeyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch op {
+		case "BT":
+			haveY = false
+		case "ET":
+			space()
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					font = f.font(fonts[name])
+				}
+			}
+		case "Tj":
+			if s, ok := last(operands).(pdfString); ok {
+				show(s)
+			}
+		case "'", "\"":
+			newline()
+			if s, ok := last(operands).(pdfString); ok {
+				show(s)
+			}
+		case "TJ":
+			arr, _ := last(operands).(pdfArray)
+			for _, item := range arr {
+				switch v := item.(type) {
+				case pdfString:
+					show(v)
+				case float64:
+					// Large negative adjustments separate words
+					if v < -200 {
+						space()
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, ok := operands[len(operands)-1].(float64); ok {
+					if ty != 0 {
+						newline()
+					} else {
+						space()
+					}
+				}
+			}
+		case "T*":
+			newline()
+		case "Tm":
+			if len(operands) >= 6 {
+				if y, ok := operands[len(operands)-1].(float64); ok {
+					moveTo(y)
+				}
+			}
+		case "Do":
+			if depth >= maxFormDepth {
+				break
+			}
+			if name, ok := last(operands).(pdfName); ok {
+				data, dict := f.streamOf(xobjects[name])
+				if dict != nil && dict["Subtype"] == pdfName("Form") {
+					formResources := f.dict(dict["Resources"])
+					if formResources == nil {
+						formResources = resources
+					}
+					f.contentText(sb, data, formResources, depth+1)
+				}
+			}
+		case "ID":
+			lx.skipInlineImage()
+		}
+		operands = operands[:0]
+		if sb.Len() > MaxTextLength {
+			return
+		}
+	}
+}
+
+func last(values []any) any {
+	if len(values) == 0 {
+		return nil
+	}
+	return values[len(values)-1]
+}
+
+// pdfFont decodes the strings shown with a font into text
+type pdfFont struct {
+	cmap *toUnicode
+	// twoByte is set for composite fonts, whose codes are two bytes long
+	twoByte bool
+}
+
+func (f *pdfFile) font(v any) *pdfFont {
+	ref, isRef := v.(pdfRef)
+	if isRef {
+		if font, ok := f.fonts[ref]; ok {
+			return font
+		}
+	}
+
+	font := &pdfFont{}
+	if dict := f.dict(v); dict != nil {
+		font.twoByte = dict["Subtype"] == pdfName("Type0")
+		font.cmap = f.toUnicode(dict["ToUnicode"])
+	}
+	if isRef {
+		f.fonts[ref] = font
+	}
+	return font
+}
+
+// toUnicode returns the parsed ToUnicode map v refers to. Maps are cached, fonts given directly
+// in a page's resources are looked up every time they are selected.
+func (f *pdfFile) toUnicode(v any) *toUnicode {
+	ref, ok := v.(pdfRef)
+	if !ok {
+		return nil
+	}
+	if cm, ok := f.cmaps[ref]; ok {
+		return cm
+	}
+	var cm *toUnicode
+	if data, _ := f.streamOf(ref); data != nil {
+		cm = parseToUnicode(data)
+	}
+	f.cmaps[ref] = cm
+	return cm
+}
+
+func (font *pdfFont) decode(s pdfString) string {
+	if font == nil {
+		return latin1(s)
+	}
+	if font.cmap != nil {
+		return font.cmap.decode(s, font.twoByte)
+	}
+	if font.twoByte {
+		// Without a ToUnicode map the glyph IDs of a composite font cannot be mapped to text
+		return ""
+	}
+	return latin1(s)
+}
+
+func latin1(s []byte) string {
+	runes := make([]rune, 0, len(s))
+	for _, b := range s {
+		if b >= 0x20 || b == '\t' {
+			runes = append(runes, rune(b))
+		}
+	}
+	return string(runes)
+}
+
+// toUnicode is a parsed ToUnicode CMap
+type toUnicode struct {
+	codeLen int
+	chars   map[uint32]string
+	ranges  []cmapRange
+}
+
+type cmapRange struct {
+	lo, hi uint32
+	dst    []uint16
+	list   []string
+}
+
+func parseToUnicode(data []byte) *toUnicode {
+	cm := &toUnicode{chars: map[uint32]string{}}
+	lx := &pdfLexer{data: data}
+	var operands []any
+	section := ""
+	for {
+		tok, err := lx.value()
+		if err != nil {
+			break
+		}
+		kw, ok := tok.(pdfKeyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch kw {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			// Drop the entry count preceding the section
+			section = string(kw)
+			operands = operands[:0]
+		case "endcodespacerange":
+			if len(operands) >= 1 {
+				if lo, ok := operands[0].(pdfString); ok {
+					cm.codeLen = len(lo)
+				}
+			}
+			section = ""
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					cm.chars[codeValue(src)] = utf16BE(dst)
+				}
+			}
+			section = ""
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				r := cmapRange{lo: codeValue(lo), hi: codeValue(hi)}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					r.dst = utf16Units(dst)
+				case pdfArray:
+					for _, d := range dst {
+						if s, ok := d.(pdfString); ok {
+							r.list = append(r.list, utf16BE(s))
+						}
+					}
+				}
+				cm.ranges = append(cm.ranges, r)
+			}
+			section = ""
+		}
+		if section == "" {
+			operands = operands[:0]
+		}
+	}
+	// Sorted so a code's range can be found by binary search
+	slices.SortStableFunc(cm.ranges, func(a, b cmapRange) int { return cmp.Compare(a.lo, b.lo) })
+	return cm
+}
+
+func (cm *toUnicode) decode(s pdfString, twoByte bool) string {
+	n := cm.codeLen
+	if n == 0 {
+		n = 1
+		if twoByte {
+			n = 2
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i+n <= len(s) && sb.Len() <= MaxTextLength; i += n {
+		code := codeValue(s[i : i+n])
+		if text, ok := cm.chars[code]; ok {
+			sb.WriteString(text)
+			continue
+		}
+		// The last range starting at or before the code
+		j := sort.Search(len(cm.ranges), func(j int) bool { return cm.ranges[j].lo > code }) - 1
+		if j < 0 || code > cm.ranges[j].hi {
+			continue
+		}
+		r := cm.ranges[j]
+		offset := code - r.lo
+		if r.list != nil {
+			if int(offset) < len(r.list) {
+				sb.WriteString(r.list[offset])
+			}
+		} else if len(r.dst) > 0 {
+			units := append([]uint16(nil), r.dst...)
+			units[len(units)-1] += uint16(offset)
+			sb.WriteString(string(utf16.Decode(units)))
+		}
+	}
+	return sb.String()
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func utf16Units(b []byte) []uint16 {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return units
+}
+
+func utf16BE(b []byte) string {
+	return string(utf16.Decode(utf16Units(b)))
+}
+
+// pdfLexer reads PDF values and keywords
+type pdfLexer struct {
+	data []byte
+	pos  int
+	// depth is the number of arrays and dictionaries being read
+	depth int
+}
+
+var (
+	errEndOfData = errors.New("end of data")
+	errTooDeep   = errors.New("too deeply nested")
+)
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func (lx *pdfLexer) skipSpace() {
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		if c == '%' {
+			for lx.pos < len(lx.data) && lx.data[lx.pos] != '\n' && lx.data[lx.pos] != '\r' {
+				lx.pos++
+			}
+			continue
+		}
+		if !isPDFSpace(c) {
+			return
+		}
+		lx.pos++
+	}
+}
+
+// next reads a single token: a number, name, string, keyword or one of the delimiters [ ] << >>
+func (lx *pdfLexer) next() (any, error) {
+	lx.skipSpace()
+	if lx.pos >= len(lx.data) {
+		return nil, errEndOfData
+	}
+
+	c := lx.data[lx.pos]
+	switch {
+	case c == '/':
+		return lx.name(), nil
+	case c == '(':
+		return lx.literalString(), nil
+	case c == '<' && lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == '<':
+		lx.pos += 2
+		return pdfKeyword("<<"), nil
+	case c == '>' && lx.pos+1 < len(lx.data) && lx.data[lx.pos+1] == '>':
+		lx.pos += 2
+		return pdfKeyword(">>"), nil
+	case c == '<':
+		return lx.hexString(), nil
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		lx.pos++
+		return pdfKeyword(string(c)), nil
+	}
+
+	start := lx.pos
+	for lx.pos < len(lx.data) && !isPDFSpace(lx.data[lx.pos]) && !isPDFDelimiter(lx.data[lx.pos]) {
+		lx.pos++
+	}
+	if lx.pos == start {
+		// A stray delimiter such as ')' or '>'
+		lx.pos++
+		return pdfKeyword(string(c)), nil
+	}
+	word := string(lx.data[start:lx.pos])
+	if isPDFNumber(word) {
+		if n, err := strconv.ParseFloat(word, 64); err == nil {
+			return n, nil
+		}
+	}
+	return pdfKeyword(word), nil
+}
+
+// isPDFNumber reports whether word is written like a PDF number: digits with an optional
+// sign and decimal point, so neither exponents nor "Inf" and "NaN" are taken for numbers
+func isPDFNumber(word string) bool {
+	digits := false
+	for i, c := range []byte(word) {
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case (c == '+' || c == '-') && i == 0, c == '.':
+		default:
+			return false
+		}
+	}
+	return digits
+}
+
+func (lx *pdfLexer) peekKeyword() (pdfKeyword, bool) {
+	pos := lx.pos
+	tok, err := lx.next()
+	lx.pos = pos
+	kw, ok := tok.(pdfKeyword)
+	return kw, ok && err == nil
+}
+
+// value reads a complete value, assembling arrays, dictionaries and "n g R" references
+func (lx *pdfLexer) value() (any, error) {
+	tok, err := lx.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok == pdfKeyword("[") || tok == pdfKeyword("<<") {
+		if lx.depth >= maxNesting {
+			return nil, errTooDeep
+		}
+		lx.depth++
+		defer func() { lx.depth-- }()
+	}
+
+	switch tok {
+	case pdfKeyword("["):
+		arr := pdfArray{}
+		for {
+			if kw, ok := lx.peekKeyword(); ok && kw == "]" {
+				lx.next()
+				return arr, nil
+			}
+			v, err := lx.value()
+			if err != nil {
+				return arr, err
+			}
+			arr = append(arr, v)
+		}
+	case pdfKeyword("<<"):
+		dict := pdfDict{}
+		for {
+			if kw, ok := lx.peekKeyword(); ok && kw == ">>" {
+				lx.next()
+				return dict, nil
+			}
+			key, err := lx.value()
+			if err != nil {
+				return dict, err
+			}
+			v, err := lx.value()
+			if err != nil {
+				return dict, err
+			}
+			if name, ok := key.(pdfName); ok {
+				dict[name] = v
+			}
+		}
+	}
+
+	// An integer may start an "n g R" reference
+	if num, ok := pdfInt(tok, math.MaxInt32); ok {
+		pos := lx.pos
+		gen, err1 := lx.next()
+		r, err2 := lx.next()
+		if g, ok := pdfInt(gen, math.MaxInt32); ok && err1 == nil && err2 == nil && r == pdfKeyword("R") {
+			return pdfRef{num: num, gen: g}, nil
+		}
+		lx.pos = pos
+	}
+	return tok, nil
+}
+
+func (lx *pdfLexer) name() pdfName {
+	lx.pos++ // skip '/'
+	var sb strings.Builder
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		if isPDFSpace(c) || isPDFDelimiter(c) {
+			break
+		}
+		if c == '#' && lx.pos+2 < len(lx.data) && isHexDigit(lx.data[lx.pos+1]) && isHexDigit(lx.data[lx.pos+2]) {
+			b, _ := hex.DecodeString(string(lx.data[lx.pos+1 : lx.pos+3]))
+			sb.Write(b)
+			lx.pos += 3
+			continue
+		}
+		sb.WriteByte(c)
+		lx.pos++
+	}
+	return pdfName(sb.String())
+}
+
+func (lx *pdfLexer) literalString() pdfString {
+	lx.pos++ // skip '('
+	var out []byte
+	depth := 1
+	for lx.pos < len(lx.data) {
+		c := lx.data[lx.pos]
+		lx.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if lx.pos >= len(lx.data) {
+				return out
+			}
+			e := lx.data[lx.pos]
+			lx.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				// Line continuation
+				if lx.pos < len(lx.data) && lx.data[lx.pos] == '\n' {
+					lx.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && lx.pos < len(lx.data) && lx.data[lx.pos] >= '0' && lx.data[lx.pos] <= '7'; i++ {
+						v = v*8 + int(lx.data[lx.pos]-'0')
+						lx.pos++
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (lx *pdfLexer) hexString() pdfString {
+	lx.pos++ // skip '<'
+	end := bytes.IndexByte(lx.data[lx.pos:], '>')
+	if end < 0 {
+		end = len(lx.data) - lx.pos
+	}
+	raw := lx.data[lx.pos : lx.pos+end]
+	lx.pos += end + 1
+	b, _ := asciiHexDecode(raw)
+	return b
+}
+
+// streamData returns the raw bytes of the stream starting at the current position. endstreams
+// lists the offsets of every "endstream" in the data.
+func (lx *pdfLexer) streamData(dict pdfDict, endstreams []int) []byte {
+	if lx.pos < len(lx.data) && lx.data[lx.pos] == '\r' {
+		lx.pos++
+	}
+	if lx.pos < len(lx.data) && lx.data[lx.pos] == '\n' {
+		lx.pos++
+	}
+	start := lx.pos
+
+	// Trust /Length only when it is direct and lands right before "endstream"
+	if n, ok := pdfInt(dict["Length"], len(lx.data)-start); ok {
+		end := start + n
+		rest := bytes.TrimLeft(lx.data[end:min(end+32, len(lx.data))], "\r\n\t ")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			lx.pos = end
+			return lx.data[start:end]
+		}
+	}
+
+	i, _ := slices.BinarySearch(endstreams, start)
+	if i == len(endstreams) {
+		lx.pos = len(lx.data)
+		return lx.data[start:]
+	}
+	end := endstreams[i]
+	lx.pos = end
+	return bytes.TrimRight(lx.data[start:end], "\r\n")
+}
+
+// skipInlineImage skips the binary data of an inline image up to its EI operator
+func (lx *pdfLexer) skipInlineImage() {
+	for i := lx.pos; i+2 < len(lx.data); i++ {
+		if lx.data[i] == 'E' && lx.data[i+1] == 'I' && isPDFSpace(lx.data[i-1]) && (i+2 == len(lx.data) || isPDFSpace(lx.data[i+2])) {
+			lx.pos = i + 2
+			return
+		}
+	}
+	lx.pos = len(lx.data)
+}
@@ -0,0 +1,285 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildPDF lays out objects numbered from 1, followed by a trailer pointing at object 1
+func buildPDF(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+func pdfStream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	zw := zlib.NewWriter(&b)
+	zw.Write(data)
+	zw.Close()
+	return b.Bytes()
+}
+
+// onePage returns a PDF whose single page shows content with font /F1
+func onePage(content string) []byte {
+	return buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		pdfStream("", []byte(content)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+}
+
+func TestPDFText(t *testing.T) {
+	tests := []struct {
+		name string
+		pdf  []byte
+		want string
+	}{
+		{
+			name: "text lines",
+			pdf:  onePage("BT /F1 12 Tf 72 720 Td (Software Engineer) Tj 0 -14 Td (Acme Inc.) Tj ET"),
+			want: "Software Engineer\nAcme Inc.",
+		},
+		{
+			name: "escapes in literal strings",
+			pdf:  onePage(`BT /F1 12 Tf (Caf\351 \(Berlin\)) Tj ET`),
+			want: "Café (Berlin)",
+		},
+		{
+			name: "word spacing in TJ",
+			pdf:  onePage("BT /F1 12 Tf [(Remote) -300 (friendly) 20 (!)] TJ ET"),
+			want: "Remote friendly!",
+		},
+		{
+			name: "text matrix moves to a new line",
+			pdf:  onePage("BT /F1 12 Tf 1 0 0 1 72 700 Tm (Salary) Tj 1 0 0 1 72 680 Tm (90k) Tj ET"),
+			want: "Salary\n90k",
+		},
+		{
+			name: "flate compressed content",
+			pdf: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+				pdfStream("/Filter /FlateDecode", deflate([]byte("BT (Compressed text) Tj ET"))),
+			),
+			want: "Compressed text",
+		},
+		{
+			name: "objects inside an object stream",
+			pdf: func() []byte {
+				first := "<< /Type /Pages /Kids [6 0 R] /Count 1 >> "
+				objs := first + "<< /Type /Page /Parent 5 0 R /Contents 3 0 R >>"
+				header := fmt.Sprintf("5 0 6 %d ", len(first))
+				return buildPDF(
+					"<< /Type /Catalog /Pages 5 0 R >>",
+					pdfStream(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", len(header)), deflate([]byte(header+objs))),
+					pdfStream("", []byte("BT (From an object stream) Tj ET")),
+				)
+			}(),
+			want: "From an object stream",
+		},
+		{
+			name: "composite font with ToUnicode map",
+			pdf: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+				pdfStream("", []byte("BT /F1 12 Tf <000100020003> Tj <0010> Tj ET")),
+				"<< /Type /Font /Subtype /Type0 /ToUnicode 6 0 R >>",
+				pdfStream("", []byte(`begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+1 beginbfchar <0001> <004A> endbfchar
+1 beginbfrange <0002> <0003> <006F> endbfrange
+1 beginbfrange <0010> <0010> [<00DF>] endbfrange
+endcmap`)),
+			),
+			want: "Jopß",
+		},
+		{
+			name: "form XObject",
+			pdf: buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /XObject << /X1 5 0 R >> >> >>",
+				pdfStream("", []byte("/X1 Do")),
+				pdfStream("/Type /XObject /Subtype /Form", []byte("BT (Inside a form) Tj ET")),
+			),
+			want: "Inside a form",
+		},
+		{
+			name: "page objects without a page tree",
+			pdf: buildPDF(
+				"<< /Type /Page /Contents 2 0 R >>",
+				pdfStream("", []byte("BT (Orphaned page) Tj ET")),
+			),
+			want: "Orphaned page",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Text("application/pdf", tt.pdf)
+			if err != nil {
+				t.Fatalf("Text: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPDFTextErrors(t *testing.T) {
+	if _, err := pdfText([]byte("hello")); err == nil {
+		t.Error("expected an error for a file that is not a PDF")
+	}
+
+	encrypted := buildPDF("<< /Type /Catalog >>", "<< /Filter /Standard >>")
+	encrypted = bytes.Replace(encrypted, []byte("<< /Root 1 0 R >>"), []byte("<< /Root 1 0 R /Encrypt 2 0 R >>"), 1)
+	encrypted = append(encrypted, []byte("3 0 obj\n<< /Root 1 0 R /Encrypt 2 0 R >>\nendobj\n")...)
+	if _, err := pdfText(encrypted); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("encrypted PDF: error = %v, want %v", err, ErrUnsupported)
+	}
+}
+
+// malformedPDFs are damaged or hostile files the reader must survive
+var malformedPDFs = map[string][]byte{
+	"negative First":      []byte("%PDF-1.7\n1 0 obj << /Type /ObjStm /N 1 /First -5 /Length 3 >> stream\nabc\nendstream endobj"),
+	"First past the end":  []byte("%PDF-1.7\n1 0 obj << /Type /ObjStm /N 1 /First 500 /Length 3 >> stream\nabc\nendstream endobj"),
+	"huge First":          []byte("%PDF-1.7\n1 0 obj << /Type /ObjStm /N 1 /First 1e300 /Length 3 >> stream\nabc\nendstream endobj"),
+	"negative offset":     []byte("%PDF-1.7\n1 0 obj << /Type /ObjStm /N 1 /First 6 /Length 9 >> stream\n2 -60 12\nendstream endobj"),
+	"offset past the end": []byte("%PDF-1.7\n1 0 obj << /Type /ObjStm /N 1 /First 6 /Length 9 >> stream\n2 900 12\nendstream endobj"),
+	"huge offset":         []byte("%PDF-1.7\n1 0 obj << /Type /ObjStm /N 1 /First 12 /Length 15 >> stream\n2 99999999999999999999 12\nendstream endobj"),
+	"huge Length":         []byte("%PDF-1.7\n1 0 obj << /Length 99999999999999999999 >> stream\nabc\nendstream endobj"),
+	"negative Length":     []byte("%PDF-1.7\n1 0 obj << /Length -3 >> stream\nabc\nendstream endobj"),
+	"infinite Length":     []byte("%PDF-1.7\n1 0 obj << /Length +Inf >> stream\nabc\nendstream endobj"),
+	"huge reference":      []byte("%PDF-1.7\n1 0 obj << /Type /Catalog /Pages 9223372036854775808 0 R >> endobj"),
+	"unterminated stream": []byte("%PDF-1.7\n1 0 obj << /Length 10 >> stream\nab"),
+	"unterminated string": []byte("%PDF-1.7\n1 0 obj (abc\\"),
+	"unterminated hex":    []byte("%PDF-1.7\n1 0 obj <41424"),
+	"lone inline image":   onePage("BI /W 1 ID"),
+	"page tree cycle": buildPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [2 0 R 3 0 R] >>",
+		"<< /Type /Pages /Kids [1 0 R 2 0 R] >>",
+	),
+	"bad filters": buildPDF(
+		"<< /Type /Page /Contents [2 0 R 3 0 R 4 0 R] >>",
+		pdfStream("/Filter /FlateDecode", []byte("not zlib")),
+		pdfStream("/Filter [/ASCIIHexDecode /ASCII85Decode]", []byte("zz>")),
+		pdfStream("/Filter /JBIG2Decode", []byte("x")),
+	),
+	"bad cmap": buildPDF(
+		"<< /Type /Page /Contents 2 0 R /Resources << /Font << /F1 3 0 R >> >> >>",
+		pdfStream("", []byte("BT /F1 Tf <0001> Tj /F1 1 Tf <00010203> Tj ET")),
+		"<< /Subtype /Type0 /ToUnicode 4 0 R >>",
+		pdfStream("", []byte("beginbfrange <0001> <FFFF> <FFFF> <01> endbfrange beginbfchar <01> endbfchar")),
+	),
+}
+
+func TestPDFTextMalformed(t *testing.T) {
+	for name, data := range malformedPDFs {
+		t.Run(name, func(t *testing.T) {
+			// Only surviving matters, there is usually no text to find
+			pdfText(data)
+		})
+	}
+}
+
+// Inputs that used to take very long or exhaust the stack, each must be read quickly
+func TestPDFTextPathological(t *testing.T) {
+	tests := map[string][]byte{
+		// Every object runs to the end of the file
+		"unterminated objects": []byte("%PDF-1.7\n" + strings.Repeat("1 0 obj [ ", 200000)),
+		// Every stream runs to the end of the file
+		"unterminated streams": []byte("%PDF-1.7\n" + strings.Repeat("1 0 obj << >> stream\n", 100000)),
+		// Nesting deep enough to exhaust the stack when followed recursively
+		"deep nesting": []byte("%PDF-1.7\n1 0 obj " + strings.Repeat("[", 5<<20)),
+		// Forms drawing each other many times over
+		"form fan-out": buildPDF(
+			"<< /Type /Page /Contents 2 0 R /Resources 3 0 R >>",
+			pdfStream("", []byte(strings.Repeat("/X Do ", 2000))),
+			"<< /XObject << /X 4 0 R >> >>",
+			pdfStream("/Subtype /Form /Resources 3 0 R", []byte(strings.Repeat("/X Do ", 2000))),
+		),
+		// A font whose ToUnicode map is parsed again on every use
+		"font switching": buildPDF(
+			"<< /Type /Page /Contents 2 0 R /Resources << /Font << /F1 << /Subtype /Type0 /ToUnicode 3 0 R >> >> >> >>",
+			pdfStream("", []byte("BT "+strings.Repeat("/F1 1 Tf ", 100000)+"ET")),
+			pdfStream("", []byte("beginbfrange "+strings.Repeat("<0000> <0001> <0041> ", 20000)+"endbfrange")),
+		),
+		// A map with many ranges applied to a long string
+		"many cmap ranges": buildPDF(
+			"<< /Type /Page /Contents 2 0 R /Resources << /Font << /F1 3 0 R >> >> >>",
+			pdfStream("", []byte("BT /F1 1 Tf <"+strings.Repeat("FFFF", 200000)+"> Tj ET")),
+			"<< /Subtype /Type0 /ToUnicode 4 0 R >>",
+			pdfStream("", []byte("beginbfrange "+strings.Repeat("<0000> <0001> <0041> ", 50000)+"endbfrange")),
+		),
+		// One code mapped to a long string, shown many times
+		"text amplification": buildPDF(
+			"<< /Type /Page /Contents 2 0 R /Resources << /Font << /F1 3 0 R >> >> >>",
+			pdfStream("", []byte("BT /F1 1 Tf [<"+strings.Repeat("01", 100000)+">] TJ ET")),
+			"<< /ToUnicode 4 0 R >>",
+			pdfStream("", []byte("beginbfchar <01> <"+strings.Repeat("0041", 50000)+"> endbfchar")),
+		),
+		// Many pages sharing one stream that inflates to a lot of data
+		"inflation": func() []byte {
+			kids := strings.Repeat("<< /Type /Page /Contents 3 0 R >> ", 5000)
+			return buildPDF(
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids ["+kids+"] >>",
+				pdfStream("/Filter /FlateDecode", deflate(bytes.Repeat([]byte(" "), 32<<20))),
+			)
+		}(),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			pdfText(data)
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("took %s", elapsed)
+			}
+		})
+	}
+}
+
+func TestPDFTextLimitsOutput(t *testing.T) {
+	pdf := onePage("BT " + strings.Repeat("(0123456789012345678901234567890123456789) Tj ", 50000) + "ET")
+	text, err := Text("application/pdf", pdf)
+	if err != nil {
+		t.Fatalf("Text: %v", err)
+	}
+	if len(text) > MaxTextLength {
+		t.Errorf("got %d bytes, want at most %d", len(text), MaxTextLength)
+	}
+}
+
+func FuzzPDFText(f *testing.F) {
+	f.Add(onePage("BT /F1 12 Tf 72 720 Td (Hello) Tj ET"))
+	for _, data := range malformedPDFs {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		text, err := pdfText(data)
+		if err != nil && text != "" {
+			t.Errorf("returned text %q alongside error %v", text, err)
+		}
+	})
+}
@@ -0,0 +1,78 @@
+// Package htmlscan splits HTML into text and tags. It is forgiving rather than a full parser:
+// just enough to pull the text and structure out of documents.
+package htmlscan
+
+import "strings"
+
+// Scan walks an HTML fragment or document, passing every run of text, still escaped, to text
+// and every tag to tag. Comments are dropped, and so is the content of the skipped elements
+// up to their closing tag.
+func Scan(s string, skipped map[string]bool, text func(string), tag func(name string, closing bool, attrs string)) {
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			text(s)
+			return
+		}
+		text(s[:lt])
+		s = s[lt:]
+
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				return
+			}
+			s = s[end+3:]
+			continue
+		}
+
+		gt := tagEnd(s)
+		if gt < 0 {
+			return
+		}
+		name, closing, attrs := ParseTag(s[1:gt])
+		s = s[gt+1:]
+
+		if !closing && skipped[name] {
+			end := strings.Index(strings.ToLower(s), "</"+name)
+			if end < 0 {
+				return
+			}
+			s = s[end:]
+			continue
+		}
+		tag(name, closing, attrs)
+	}
+}
+
+// tagEnd returns the index of the '>' closing the tag at the start of s, skipping quoted attribute values
+func tagEnd(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// ParseTag splits the inside of a tag into its lower-cased name and the unparsed attributes
+func ParseTag(tag string) (name string, closing bool, attrs string) {
+	tag = strings.TrimSpace(tag)
+	if strings.HasPrefix(tag, "/") {
+		closing = true
+		tag = tag[1:]
+	}
+	end := strings.IndexAny(tag, " \t\r\n/")
+	if end < 0 {
+		return strings.ToLower(tag), closing, ""
+	}
+	return strings.ToLower(tag[:end]), closing, tag[end:]
+}
@@ -0,0 +1,112 @@
+// Package inbox files incoming email from a local maildir or mbox with the applications it
+// is about. Fetching the mail (IMAP, POP3, forwarding) is left to tools like fetchmail,
+// getmail or the mail server itself.
+package inbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/extract"
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+// Parse reads an RFC 822 message
+func Parse(raw []byte) (service.InboundEmail, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return service.InboundEmail{}, fmt.Errorf("%w: not an email: %v", service.ErrInvalidInput, err)
+	}
+	from, err := mail.ParseAddress(extract.DecodeHeader(m.Header.Get("From")))
+	if err != nil {
+		// Keep what there is, the message can still be applied by hand
+		from = &mail.Address{Address: strings.TrimSpace(m.Header.Get("From"))}
+	}
+	text, err := extract.MessageText(m)
+	if err != nil {
+		return service.InboundEmail{}, fmt.Errorf("%w: reading the body: %v", service.ErrInvalidInput, err)
+	}
+	date, _ := m.Header.Date()
+
+	return service.InboundEmail{
+		MessageID:   strings.Trim(strings.TrimSpace(m.Header.Get("Message-Id")), "<>"),
+		FromName:    from.Name,
+		FromAddress: from.Address,
+		Subject:     strings.TrimSpace(extract.DecodeHeader(m.Header.Get("Subject"))),
+		Date:        date,
+		Text:        text,
+		Raw:         raw,
+	}, nil
+}
+
+// Source is a mailbox new messages are read from
+type Source interface {
+	// Next calls file with every message that arrived since the last call, the message is
+	// only considered read if file succeeds
+	Next(file func(raw []byte) error) error
+}
+
+// Open returns the source at path, a maildir if it is a directory and an mbox file otherwise.
+// Messages larger than maxSize are skipped.
+func Open(path string, maxSize int64, logger *slog.Logger) (Source, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return newMaildir(path, maxSize, logger)
+	}
+	return &mbox{path: path, maxSize: maxSize, logger: logger}, nil
+}
+
+// Watcher files the messages that arrive in a source
+type Watcher struct {
+	svc    *service.JobApplicationService
+	source Source
+	logger *slog.Logger
+}
+
+// NewWatcher returns a watcher that files the messages of source
+func NewWatcher(svc *service.JobApplicationService, source Source, logger *slog.Logger) *Watcher {
+	return &Watcher{svc: svc, source: source, logger: logger}
+}
+
+// file parses and files one message. Messages that cannot be parsed are logged and skipped,
+// other failures leave the message to be tried again.
+func (w *Watcher) file(raw []byte) error {
+	e, err := Parse(raw)
+	if err != nil {
+		w.logger.Warn("Skipping unreadable email", "error", err)
+		return nil
+	}
+	if _, _, err := w.svc.IngestEmail(e); err != nil {
+		return fmt.Errorf("filing %q: %w", e.Subject, err)
+	}
+	return nil
+}
+
+// Run checks the source for new messages every interval until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	w.logger.Info("Inbox watcher started", "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := w.source.Next(w.file); err != nil {
+			w.logger.Error("Failed to read inbox", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			w.logger.Info("Inbox watcher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
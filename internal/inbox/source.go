@@ -0,0 +1,140 @@
+package inbox
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maildir reads the messages delivered to the new directory of a maildir and moves them to
+// cur, marked as seen, once they are filed
+type maildir struct {
+	path    string
+	maxSize int64
+	logger  *slog.Logger
+}
+
+func newMaildir(path string, maxSize int64, logger *slog.Logger) (*maildir, error) {
+	for _, dir := range []string{"new", "cur"} {
+		if info, err := os.Stat(filepath.Join(path, dir)); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a maildir: it has no %s directory", path, dir)
+		}
+	}
+	return &maildir{path: path, maxSize: maxSize, logger: logger}, nil
+}
+
+func (m *maildir) Next(file func(raw []byte) error) error {
+	entries, err := os.ReadDir(filepath.Join(m.path, "new"))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		// Names starting with a dot are still being delivered
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		src := filepath.Join(m.path, "new", entry.Name())
+		raw, err := readLimited(src, m.maxSize)
+		if err != nil {
+			return err
+		}
+		if raw == nil {
+			m.logger.Warn("Skipping email larger than the attachment limit", "file", src)
+		} else if err := file(raw); err != nil {
+			return err
+		}
+
+		name, _, _ := strings.Cut(entry.Name(), ":")
+		if err := os.Rename(src, filepath.Join(m.path, "cur", name+":2,S")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLimited reads a file, returning nil if it is larger than maxSize
+func readLimited(path string, maxSize int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	raw, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil || int64(len(raw)) > maxSize {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// mbox reads the messages appended to an mbox file. It remembers how far it has read while
+// the server runs, after a restart the whole file is read again and messages that were filed
+// before are recognized by their Message-ID.
+type mbox struct {
+	path    string
+	maxSize int64
+	logger  *slog.Logger
+	offset  int64
+}
+
+// fromLine starts every message of an mbox
+var fromLine = regexp.MustCompile(`(?m)^From `)
+
+// quotedFrom is a line starting with "From " in a message body, escaped with ">" (mboxrd)
+var quotedFrom = regexp.MustCompile(`(?m)^>(>*From )`)
+
+func (m *mbox) Next(file func(raw []byte) error) error {
+	f, err := os.Open(m.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < m.offset {
+		// The file was truncated or replaced, e.g. after the mail was moved elsewhere
+		m.offset = 0
+	}
+	if _, err := f.Seek(m.offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	base := m.offset
+
+	starts := fromLine.FindAllIndex(data, -1)
+	for i, start := range starts {
+		end := len(data)
+		if i+1 < len(starts) {
+			end = starts[i+1][0]
+		} else if !bytes.HasSuffix(data, []byte("\n\n")) && !bytes.HasSuffix(data, []byte("\n\r\n")) {
+			// The last message may still be being written, it ends with a blank line
+			break
+		}
+
+		msg := data[start[0]:end]
+		// Drop the From line itself and the blank line that separates messages
+		if nl := bytes.IndexByte(msg, '\n'); nl >= 0 {
+			msg = msg[nl+1:]
+		}
+		msg = bytes.TrimSuffix(msg, []byte("\n"))
+		msg = quotedFrom.ReplaceAll(msg, []byte("$1"))
+
+		if int64(len(msg)) > m.maxSize {
+			m.logger.Warn("Skipping email larger than the attachment limit", "file", m.path, "offset", base+int64(start[0]))
+		} else if err := file(msg); err != nil {
+			return err
+		}
+		m.offset = base + int64(end)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package inbox
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newTestMbox(t *testing.T, content string) *mbox {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "inbox.mbox")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &mbox{path: path, maxSize: 1000, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+}
+
+func appendMbox(t *testing.T, m *mbox, content string) {
+	t.Helper()
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// next returns the messages Next passes on
+func next(t *testing.T, m *mbox) []string {
+	t.Helper()
+	var got []string
+	err := m.Next(func(raw []byte) error {
+		got = append(got, string(raw))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	return got
+}
+
+func wantMessages(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Errorf("messages %q, want %q", got, want)
+	}
+}
+
+const (
+	mboxFirst  = "From: jobs@acme.com\nSubject: Thanks for applying\n\nWe received your application.\n"
+	mboxSecond = "From: hr@globex.com\nSubject: Interview\n\nHow about Tuesday?\n>From what we saw, you fit well.\n>>From here on\n"
+	mboxThird  = "From: hr@initech.com\nSubject: Update\n\nNo news yet.\n"
+)
+
+func TestMboxSplitsMessages(t *testing.T) {
+	m := newTestMbox(t,
+		"From jobs@acme.com Mon Oct 12 09:00:00 2026\n"+mboxFirst+"\n"+
+			"From hr@globex.com Tue Oct 13 10:00:00 2026\n"+mboxSecond+"\n")
+
+	wantMessages(t, next(t, m), mboxFirst,
+		"From: hr@globex.com\nSubject: Interview\n\nHow about Tuesday?\nFrom what we saw, you fit well.\n>From here on\n")
+	wantMessages(t, next(t, m))
+
+	// Only messages appended since are read, and only once they are complete
+	appendMbox(t, m, "From hr@initech.com Wed Oct 14 11:00:00 2026\n"+mboxThird)
+	wantMessages(t, next(t, m))
+	appendMbox(t, m, "\n")
+	wantMessages(t, next(t, m), mboxThird)
+}
+
+func TestMboxReadsAgainAfterTruncation(t *testing.T) {
+	m := newTestMbox(t, "From jobs@acme.com Mon Oct 12 09:00:00 2026\n"+mboxFirst+"\n"+
+		"From hr@globex.com Tue Oct 13 10:00:00 2026\n"+mboxSecond+"\n")
+	next(t, m)
+
+	// The mail was moved elsewhere and a new, shorter mbox started
+	if err := os.WriteFile(m.path, []byte("From hr@initech.com Wed Oct 14 11:00:00 2026\n"+mboxThird+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wantMessages(t, next(t, m), mboxThird)
+}
+
+func TestMboxSkipsLargeMessages(t *testing.T) {
+	m := newTestMbox(t, "From jobs@acme.com Mon Oct 12 09:00:00 2026\n"+mboxFirst+"\n"+
+		"From hr@globex.com Tue Oct 13 10:00:00 2026\n"+mboxSecond+"\n")
+	m.maxSize = int64(len(mboxFirst))
+	wantMessages(t, next(t, m), mboxFirst)
+}
+
+// A message that cannot be filed is read again by the next call, with the ones after it
+func TestMboxRetriesFailedMessages(t *testing.T) {
+	m := newTestMbox(t, "From jobs@acme.com Mon Oct 12 09:00:00 2026\n"+mboxFirst+"\n"+
+		"From hr@globex.com Tue Oct 13 10:00:00 2026\n"+mboxThird+"\n")
+
+	var got []string
+	err := m.Next(func(raw []byte) error {
+		if string(raw) == mboxThird {
+			return errors.New("database is locked")
+		}
+		got = append(got, string(raw))
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Next succeeded")
+	}
+	wantMessages(t, got, mboxFirst)
+	wantMessages(t, next(t, m), mboxThird)
+}
@@ -0,0 +1,251 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual compares two JSON documents regardless of key order and formatting
+func jsonEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("result is not JSON: %v (%s)", err, got)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("bad expectation %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{
+			name:  "add member",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"add","path":"/b","value":2}]`,
+			want:  `{"a":1,"b":2}`,
+		},
+		{
+			name:  "add replaces existing member",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"add","path":"/a","value":[1]}]`,
+			want:  `{"a":[1]}`,
+		},
+		{
+			name:  "add inserts into array",
+			doc:   `{"a":[1,3]}`,
+			patch: `[{"op":"add","path":"/a/1","value":2}]`,
+			want:  `{"a":[1,2,3]}`,
+		},
+		{
+			name:  "add appends with dash",
+			doc:   `{"a":[1,2]}`,
+			patch: `[{"op":"add","path":"/a/-","value":3}]`,
+			want:  `{"a":[1,2,3]}`,
+		},
+		{
+			name:  "add at array length",
+			doc:   `{"a":[1]}`,
+			patch: `[{"op":"add","path":"/a/1","value":2}]`,
+			want:  `{"a":[1,2]}`,
+		},
+		{
+			name:  "add replaces whole document",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"add","path":"","value":{"b":2}}]`,
+			want:  `{"b":2}`,
+		},
+		{
+			name:  "remove member",
+			doc:   `{"a":1,"b":2}`,
+			patch: `[{"op":"remove","path":"/a"}]`,
+			want:  `{"b":2}`,
+		},
+		{
+			name:  "remove array element",
+			doc:   `{"a":[1,2,3]}`,
+			patch: `[{"op":"remove","path":"/a/1"}]`,
+			want:  `{"a":[1,3]}`,
+		},
+		{
+			name:  "remove from nested array",
+			doc:   `{"a":[[1,2],[3]]}`,
+			patch: `[{"op":"remove","path":"/a/0/0"}]`,
+			want:  `{"a":[[2],[3]]}`,
+		},
+		{
+			name:  "replace member",
+			doc:   `{"a":1}`,
+			patch: `[{"op":"replace","path":"/a","value":"x"}]`,
+			want:  `{"a":"x"}`,
+		},
+		{
+			name:  "replace array element",
+			doc:   `{"a":[1,2,3]}`,
+			patch: `[{"op":"replace","path":"/a/1","value":9}]`,
+			want:  `{"a":[1,9,3]}`,
+		},
+		{
+			name:  "move member",
+			doc:   `{"a":{"b":1},"c":{}}`,
+			patch: `[{"op":"move","from":"/a/b","path":"/c/d"}]`,
+			want:  `{"a":{},"c":{"d":1}}`,
+		},
+		{
+			name:  "move array element",
+			doc:   `{"a":[1,2,3]}`,
+			patch: `[{"op":"move","from":"/a/0","path":"/a/-"}]`,
+			want:  `{"a":[2,3,1]}`,
+		},
+		{
+			name:  "copy member",
+			doc:   `{"a":{"b":[1]}}`,
+			patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"add","path":"/c/b/-","value":2}]`,
+			want:  `{"a":{"b":[1]},"c":{"b":[1,2]}}`,
+		},
+		{
+			name:  "test passes",
+			doc:   `{"a":{"b":[1,"x"]}}`,
+			patch: `[{"op":"test","path":"/a","value":{"b":[1,"x"]}}]`,
+			want:  `{"a":{"b":[1,"x"]}}`,
+		},
+		{
+			name:  "escaped slash",
+			doc:   `{"a/b":1}`,
+			patch: `[{"op":"replace","path":"/a~1b","value":2}]`,
+			want:  `{"a/b":2}`,
+		},
+		{
+			name:  "escaped tilde",
+			doc:   `{"a~b":1}`,
+			patch: `[{"op":"remove","path":"/a~0b"}]`,
+			want:  `{}`,
+		},
+		{
+			name:  "tilde one is not unescaped twice",
+			doc:   `{"~1":1}`,
+			patch: `[{"op":"test","path":"/~01","value":1}]`,
+			want:  `{"~1":1}`,
+		},
+		{
+			name:  "operations apply in order",
+			doc:   `{"status":"applied"}`,
+			patch: `[{"op":"test","path":"/status","value":"applied"},{"op":"replace","path":"/status","value":"interview"}]`,
+			want:  `{"status":"interview"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			jsonEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  error
+	}{
+		{"test fails", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, ErrTestFailed},
+		{"test of missing path", `{"a":1}`, `[{"op":"test","path":"/b","value":1}]`, ErrInvalidPatch},
+		{"remove missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, ErrInvalidPatch},
+		{"replace missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":1}]`, ErrInvalidPatch},
+		{"index past end", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":1}]`, ErrInvalidPatch},
+		{"index with leading zero", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/01"}]`, ErrInvalidPatch},
+		{"negative index", `{"a":[1]}`, `[{"op":"remove","path":"/a/-1"}]`, ErrInvalidPatch},
+		{"dash outside add", `{"a":[1]}`, `[{"op":"remove","path":"/a/-"}]`, ErrInvalidPatch},
+		{"move into itself", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, ErrInvalidPatch},
+		{"missing value", `{"a":1}`, `[{"op":"add","path":"/b"}]`, ErrInvalidPatch},
+		{"pointer without slash", `{"a":1}`, `[{"op":"remove","path":"a"}]`, ErrInvalidPatch},
+		{"unknown op", `{"a":1}`, `[{"op":"frobnicate","path":"/a"}]`, ErrInvalidPatch},
+		{"traverse scalar", `{"a":1}`, `[{"op":"add","path":"/a/b","value":1}]`, ErrInvalidPatch},
+		{"not a list of operations", `{"a":1}`, `{"op":"remove","path":"/a"}`, ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Apply error = %v, want %v", err, tt.want)
+			}
+			if got != nil {
+				t.Errorf("Apply returned %s alongside an error", got)
+			}
+		})
+	}
+}
+
+// A patch is applied as a whole: when a later operation fails nothing is returned and the
+// document passed in is left as it was
+func TestApplyFailedTestLeavesDocumentUnchanged(t *testing.T) {
+	doc := []byte(`{"status":"applied","tags":["a"]}`)
+	original := string(doc)
+	patch := []byte(`[
+		{"op":"replace","path":"/status","value":"offer"},
+		{"op":"add","path":"/tags/-","value":"b"},
+		{"op":"test","path":"/status","value":"applied"}
+	]`)
+
+	got, err := Apply(doc, patch)
+	if !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("Apply error = %v, want %v", err, ErrTestFailed)
+	}
+	if got != nil {
+		t.Errorf("Apply returned %s alongside an error", got)
+	}
+	if string(doc) != original {
+		t.Errorf("document changed to %s", doc)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"replace member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"add member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"null deletes member", `{"a":"b","c":"d"}`, `{"a":null}`, `{"c":"d"}`},
+		{"null for missing member", `{"a":"b"}`, `{"x":null}`, `{"a":"b"}`},
+		{"arrays are replaced", `{"a":[1,2]}`, `{"a":[3]}`, `{"a":[3]}`},
+		{"nested merge", `{"a":{"b":1,"c":2}}`, `{"a":{"b":null,"d":3}}`, `{"a":{"c":2,"d":3}}`},
+		{"object replaces scalar", `{"a":1}`, `{"a":{"b":null,"c":1}}`, `{"a":{"c":1}}`},
+		{"non-object patch replaces document", `{"a":1}`, `["x"]`, `["x"]`},
+		{"empty patch", `{"a":1}`, `{}`, `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("MergePatch: %v", err)
+			}
+			jsonEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+	if _, err := MergePatch([]byte(`{"a":1}`), []byte(`{"a":`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("MergePatch error = %v, want %v", err, ErrInvalidPatch)
+	}
+}
@@ -0,0 +1,333 @@
+// Package markdown converts HTML to Markdown and sanitizes Markdown written by users, so that
+// stored text never carries raw HTML or script links into the pages that render it.
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/htmlscan"
+)
+
+// skippedElements have content that is never rendered
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "head": true, "noscript": true, "template": true, "svg": true,
+	"iframe": true, "object": true, "select": true, "textarea": true, "button": true,
+}
+
+// blockElements are rendered as paragraphs
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "dd": true, "div": true, "dl": true, "dt": true,
+	"fieldset": true, "figcaption": true, "figure": true, "footer": true, "form": true, "header": true,
+	"main": true, "nav": true, "p": true, "section": true, "table": true,
+}
+
+// converter renders HTML as Markdown one token at a time
+type converter struct {
+	sb strings.Builder
+	// lists holds the item counter of every open list, -1 for unordered lists
+	lists []int
+	// links holds the href of every open link, "" when it is dropped
+	links []string
+	quote int
+	pre   bool
+	// lineStart is true while nothing has been written on the current line
+	lineStart bool
+	// space is true when whitespace was seen since the last text written
+	space bool
+	// blank is set when a blank line is due before the next text, holding the quote depth at
+	// the end of the previous block plus one
+	blank int
+}
+
+// FromHTML converts an HTML fragment or document to Markdown. Headings, paragraphs, lists,
+// emphasis, code, quotes and links are kept; everything else is reduced to its text.
+func FromHTML(s string) string {
+	c := &converter{lineStart: true}
+	htmlscan.Scan(s, skippedElements, c.text, func(name string, closing bool, attrs string) {
+		c.tag(name, closing, parseAttrs(attrs))
+	})
+	return tidy(c.sb.String())
+}
+
+func (c *converter) text(s string) {
+	s = html.UnescapeString(s)
+	if c.pre {
+		for i, line := range strings.Split(s, "\n") {
+			if i > 0 {
+				c.newline()
+			}
+			if line != "" {
+				c.write(line)
+			}
+		}
+		return
+	}
+
+	for i, word := range strings.Fields(s) {
+		if i > 0 || (len(s) > 0 && unicode.IsSpace(rune(s[0]))) {
+			c.space = true
+		}
+		c.write(escape(word))
+	}
+	if len(s) > 0 && unicode.IsSpace(rune(s[len(s)-1])) {
+		c.space = true
+	}
+}
+
+// write appends text to the current line, starting it with the quote prefix and
+// separating it from earlier text if whitespace was seen
+func (c *converter) write(s string) {
+	if c.blank > 0 {
+		c.sb.WriteString(strings.TrimRight(strings.Repeat("> ", min(c.blank-1, c.quote)), " "))
+		c.sb.WriteByte('\n')
+		c.blank = 0
+	}
+	if c.lineStart {
+		c.sb.WriteString(strings.Repeat("> ", c.quote))
+		c.lineStart = false
+	} else if c.space {
+		c.sb.WriteByte(' ')
+	}
+	c.space = false
+	c.sb.WriteString(s)
+}
+
+// inline writes markup that sticks to the following text
+func (c *converter) inline(s string) {
+	c.write(s)
+	c.space = false
+}
+
+func (c *converter) newline() {
+	c.sb.WriteByte('\n')
+	c.lineStart = true
+	c.space = false
+}
+
+// paragraph ends the current block, separating it from the next one with a blank line
+func (c *converter) paragraph() {
+	if c.sb.Len() == 0 {
+		return
+	}
+	if !c.lineStart {
+		c.newline()
+	}
+	if c.blank == 0 {
+		c.blank = c.quote + 1
+	}
+}
+
+func (c *converter) tag(name string, closing bool, attrs map[string]string) {
+	switch {
+	case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+		c.paragraph()
+		if !closing {
+			c.write(strings.Repeat("#", int(name[1]-'0')))
+			c.space = true
+		}
+	case blockElements[name]:
+		c.paragraph()
+	case name == "br":
+		c.newline()
+	case name == "hr":
+		c.paragraph()
+		c.write("---")
+		c.paragraph()
+	case name == "tr":
+		if !c.lineStart {
+			c.newline()
+		}
+	case name == "td" || name == "th":
+		if !closing && !c.lineStart {
+			c.space = true
+			c.write("|")
+			c.space = true
+		}
+	case name == "ul" || name == "ol":
+		if closing {
+			if len(c.lists) > 0 {
+				c.lists = c.lists[:len(c.lists)-1]
+			}
+			if len(c.lists) == 0 {
+				c.paragraph()
+			}
+			return
+		}
+		if len(c.lists) == 0 {
+			c.paragraph()
+		}
+		counter := -1
+		if name == "ol" {
+			counter = 0
+		}
+		c.lists = append(c.lists, counter)
+	case name == "li":
+		if closing {
+			return
+		}
+		if !c.lineStart {
+			c.newline()
+		}
+		marker := "-"
+		if n := len(c.lists); n > 0 {
+			c.write(strings.Repeat("  ", n-1))
+			if c.lists[n-1] >= 0 {
+				c.lists[n-1]++
+				marker = strconv.Itoa(c.lists[n-1]) + "."
+			}
+		}
+		c.sb.WriteString(marker)
+		c.space = true
+	case name == "blockquote":
+		c.paragraph()
+		if closing {
+			if c.quote > 0 {
+				c.quote--
+			}
+		} else {
+			c.quote++
+		}
+	case name == "pre":
+		if closing {
+			if !c.lineStart {
+				c.newline()
+			}
+			c.pre = false
+			c.write("```")
+			c.paragraph()
+		} else {
+			c.paragraph()
+			c.pre = true
+			c.write("```")
+			c.newline()
+		}
+	case name == "code":
+		if !c.pre {
+			c.inlineMarkup("`", closing)
+		}
+	case name == "strong" || name == "b":
+		c.inlineMarkup("**", closing)
+	case name == "em" || name == "i":
+		c.inlineMarkup("*", closing)
+	case name == "a":
+		if closing {
+			if n := len(c.links); n > 0 {
+				if href := c.links[n-1]; href != "" {
+					c.sb.WriteString("](" + linkEscaper.Replace(href) + ")")
+				}
+				c.links = c.links[:n-1]
+			}
+			return
+		}
+		href := SafeURL(attrs["href"])
+		c.links = append(c.links, href)
+		if href != "" {
+			c.inline("[")
+		}
+	}
+}
+
+// inlineMarkup opens or closes an emphasis or code span. Closing markup is attached to the
+// preceding text, whitespace is moved after it.
+func (c *converter) inlineMarkup(mark string, closing bool) {
+	if closing {
+		if !c.lineStart {
+			c.sb.WriteString(mark)
+		}
+		return
+	}
+	c.inline(mark)
+}
+
+var attrPattern = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+
+// parseAttrs parses the attributes of a tag, lower-casing their names
+func parseAttrs(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	attrs := make(map[string]string)
+	for _, m := range attrPattern.FindAllStringSubmatch(s, -1) {
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+	}
+	return attrs
+}
+
+// linkEscaper keeps parentheses in a link destination from ending it early
+var linkEscaper = strings.NewReplacer("(", "%28", ")", "%29")
+
+// SafeURL returns the URL if it is an absolute http(s) or mailto link, and "" otherwise
+func SafeURL(u string) string {
+	u = strings.TrimSpace(u)
+	lower := strings.ToLower(u)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") && !strings.HasPrefix(lower, "mailto:") {
+		return ""
+	}
+	if strings.ContainsAny(u, " \t\r\n<>") {
+		return ""
+	}
+	return u
+}
+
+// markdownSpecial are escaped in text converted from HTML so it is not read as markup
+const markdownSpecial = "\\`*_[]<>"
+
+func escape(s string) string {
+	if !strings.ContainsAny(s, markdownSpecial) {
+		return s
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(markdownSpecial, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+var (
+	// htmlTagPattern matches the start of raw HTML: tags, comments and declarations
+	htmlTagPattern = regexp.MustCompile(`<([a-zA-Z/!?])`)
+	// linkPattern matches the destination of inline links and images
+	linkPattern = regexp.MustCompile(`\]\(\s*([^()\s]*(?:\([^()\s]*\)[^()\s]*)*)`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// Sanitize makes Markdown safe to store and render: raw HTML is escaped so it shows as text,
+// links other than http(s) and mailto are dropped and control characters are removed
+func Sanitize(s string) string {
+	s = htmlTagPattern.ReplaceAllString(s, `\<$1`)
+	s = linkPattern.ReplaceAllStringFunc(s, func(m string) string {
+		target := linkPattern.FindStringSubmatch(m)[1]
+		if SafeURL(target) == "" && !strings.HasPrefix(target, "#") {
+			return "](#"
+		}
+		return m
+	})
+	return tidy(s)
+}
+
+// tidy normalizes line endings, removes control characters and trailing spaces, and
+// collapses runs of blank lines
+func tidy(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	s = strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	s = strings.Join(lines, "\n")
+	return strings.Trim(blankLines.ReplaceAllString(s, "\n\n"), "\n")
+}
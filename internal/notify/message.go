@@ -0,0 +1,150 @@
+// Package notify sends follow-up reminders and digests of the job search by email and as push
+// notifications
+package notify
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// Message is a notification with a plain text and an HTML body
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+	// URL opens the tracker, push notifications link to it when it is set
+	URL string
+}
+
+// Notifier delivers messages over one channel
+type Notifier interface {
+	// Name identifies the channel, sent notifications are recorded per channel
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// Template names, each made of a <name>.txt.tmpl and a <name>.html.tmpl file. The text
+// template defines the subject as a "subject" template.
+const (
+	TemplateFollowUp = "follow_up"
+	TemplateDigest   = "digest"
+)
+
+// FollowUpData is what the follow_up templates are executed with
+type FollowUpData struct {
+	FollowUps []service.GhostedApplication
+	AfterDays int
+	// BaseURL is the address of the tracker, if known
+	BaseURL string
+}
+
+// DigestData is what the digest templates are executed with
+type DigestData struct {
+	Digest service.Digest
+	// FollowUps are the applications due for a follow-up
+	FollowUps []service.GhostedApplication
+	// Statuses lists every status in pipeline order
+	Statuses []string
+	BaseURL  string
+}
+
+func title(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// describe says what an event changed
+func describe(e service.Event) string {
+	switch e.Type {
+	case service.EventCreated:
+		return "added as " + e.Application.Status
+	case service.EventStatusChanged:
+		return e.PreviousStatus + " → " + e.Application.Status
+	case service.EventDeleted:
+		return "deleted"
+	}
+	return "updated"
+}
+
+func date(t time.Time) string {
+	return t.Format("Mon, Jan 2, 2006")
+}
+
+var funcs = map[string]any{"title": title, "describe": describe, "date": date}
+
+// Templates renders messages from the built-in templates, or from files of the same name in
+// an override directory
+type Templates struct {
+	dir string
+}
+
+// NewTemplates returns templates that prefer the files in dir over the built-in ones. dir may
+// be empty to only use the built-in templates.
+func NewTemplates(dir string) *Templates {
+	return &Templates{dir: dir}
+}
+
+func (t *Templates) read(file string) (string, error) {
+	if t.dir != "" {
+		b, err := os.ReadFile(filepath.Join(t.dir, file))
+		if err == nil {
+			return string(b), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	b, err := defaultTemplates.ReadFile("templates/" + file)
+	return string(b), err
+}
+
+// Render executes the named templates with data
+func (t *Templates) Render(name string, data any) (Message, error) {
+	text, err := t.read(name + ".txt.tmpl")
+	if err != nil {
+		return Message{}, err
+	}
+	html, err := t.read(name + ".html.tmpl")
+	if err != nil {
+		return Message{}, err
+	}
+
+	textTmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return Message{}, fmt.Errorf("parsing %s text template: %w", name, err)
+	}
+	htmlTmpl, err := htmltemplate.New(name).Funcs(funcs).Parse(html)
+	if err != nil {
+		return Message{}, fmt.Errorf("parsing %s HTML template: %w", name, err)
+	}
+
+	var subject, body, htmlBody strings.Builder
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("rendering %s subject: %w", name, err)
+	}
+	if err := textTmpl.Execute(&body, data); err != nil {
+		return Message{}, fmt.Errorf("rendering %s text: %w", name, err)
+	}
+	if err := htmlTmpl.Execute(&htmlBody, data); err != nil {
+		return Message{}, fmt.Errorf("rendering %s HTML: %w", name, err)
+	}
+	return Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(body.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+func testApplication(company, position, status, link string) *service.JobApplication {
+	return &service.JobApplication{NewJobApplication: service.NewJobApplication{
+		Company: company, Position: position, Status: status, Link: link,
+	}}
+}
+
+var testFollowUps = []service.GhostedApplication{
+	{JobApplication: *testApplication("Acme & Sons", "Engineer", service.StatusApplied, "https://jobs.example.com/1"), DaysSinceChange: 21},
+	{JobApplication: *testApplication("<Globex>", "Designer", service.StatusInterview, ""), DaysSinceChange: 30},
+}
+
+func TestRenderFollowUp(t *testing.T) {
+	msg, err := NewTemplates("").Render(TemplateFollowUp, FollowUpData{
+		FollowUps: testFollowUps,
+		AfterDays: 21,
+		BaseURL:   "https://tracker.example.com",
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	if want := "2 applications to follow up on"; msg.Subject != want {
+		t.Errorf("subject %q, want %q", msg.Subject, want)
+	}
+	wantText := `These applications haven't changed for 21 days or more. A short follow-up can get things moving, or mark them as ghosted.
+
+- Acme & Sons, Engineer (Applied, no change for 21 days)
+  https://jobs.example.com/1
+- <Globex>, Designer (Interview, no change for 30 days)
+
+Open the tracker: https://tracker.example.com
+`
+	if msg.Text != wantText {
+		t.Errorf("text:\n%s\nwant:\n%s", msg.Text, wantText)
+	}
+	for _, want := range []string{
+		`<li><a href="https://jobs.example.com/1">Acme &amp; Sons, Engineer</a> (Applied, no change for 21 days)</li>`,
+		`<li>&lt;Globex&gt;, Designer (Interview, no change for 30 days)</li>`,
+		`<a href="https://tracker.example.com">Open the tracker</a>`,
+	} {
+		if !strings.Contains(msg.HTML, want) {
+			t.Errorf("HTML lacks %q:\n%s", want, msg.HTML)
+		}
+	}
+
+	one, err := NewTemplates("").Render(TemplateFollowUp, FollowUpData{FollowUps: testFollowUps[:1], AfterDays: 21})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if want := "1 application to follow up on"; one.Subject != want {
+		t.Errorf("subject %q, want %q", one.Subject, want)
+	}
+	if strings.Contains(one.Text, "Open the tracker") || strings.Contains(one.HTML, "Open the tracker") {
+		t.Error("links to the tracker without a base URL")
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	from := time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+	digest := service.Digest{
+		Period: service.DigestWeekly,
+		From:   from,
+		To:     from.AddDate(0, 0, 7),
+		Changes: []service.Event{
+			{Type: service.EventCreated, Application: testApplication("Acme & Sons", "Engineer", service.StatusApplied, "")},
+			{Type: service.EventStatusChanged, PreviousStatus: service.StatusApplied, Application: testApplication("<Globex>", "Designer", service.StatusInterview, "")},
+			{Type: service.EventDeleted, Application: testApplication("Initech", "Analyst", service.StatusRejected, "")},
+		},
+		Created:       1,
+		StatusChanges: 1,
+		Deleted:       1,
+		ByStatus:      map[string]int{service.StatusApplied: 4, service.StatusInterview: 2, service.StatusOffer: 0, service.StatusRejected: 3, service.StatusGhosted: 1},
+	}
+
+	msg, err := NewTemplates("").Render(TemplateDigest, DigestData{
+		Digest:    digest,
+		FollowUps: testFollowUps[1:],
+		Statuses:  service.ValidStatuses,
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	if want := "Job search weekly digest: 1 new, 1 status change"; msg.Subject != want {
+		t.Errorf("subject %q, want %q", msg.Subject, want)
+	}
+	wantText := `Your job search from Mon, Oct 12, 2026 to Sun, Oct 18, 2026:
+
+1 new application, 1 status change, 1 deleted.
+
+- Acme & Sons, Engineer: added as applied
+- <Globex>, Designer: applied → interview
+- Initech, Analyst: deleted
+
+On the board now: Applied 4. Interview 2. Offer 0. Rejected 3. Ghosted 1.
+
+To follow up on:
+- <Globex>, Designer (no change for 30 days)
+`
+	if msg.Text != wantText {
+		t.Errorf("text:\n%s\nwant:\n%s", msg.Text, wantText)
+	}
+	for _, want := range []string{
+		`<li>Acme &amp; Sons, Engineer: added as applied</li>`,
+		`<li>&lt;Globex&gt;, Designer: applied → interview</li>`,
+		`Applied <strong>4</strong>.`,
+		`<li>&lt;Globex&gt;, Designer (no change for 30 days)</li>`,
+	} {
+		if !strings.Contains(msg.HTML, want) {
+			t.Errorf("HTML lacks %q:\n%s", want, msg.HTML)
+		}
+	}
+
+	quiet, err := NewTemplates("").Render(TemplateDigest, DigestData{
+		Digest:   service.Digest{Period: service.DigestDaily, From: from, To: from.AddDate(0, 0, 1), ByStatus: map[string]int{}},
+		Statuses: service.ValidStatuses,
+	})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if want := "Job search daily digest: 0 new, 0 status changes"; quiet.Subject != want {
+		t.Errorf("subject %q, want %q", quiet.Subject, want)
+	}
+	if !strings.Contains(quiet.Text, "Nothing changed.") || !strings.Contains(quiet.HTML, "<p>Nothing changed.</p>") {
+		t.Errorf("empty digest does not say nothing changed:\n%s\n%s", quiet.Text, quiet.HTML)
+	}
+}
+
+func TestRenderOverride(t *testing.T) {
+	dir := t.TempDir()
+	override := `{{define "subject"}}Follow up: {{len .FollowUps}}{{end}}{{range .FollowUps}}{{.Company}};{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, TemplateFollowUp+".txt.tmpl"), []byte(override), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := NewTemplates(dir).Render(TemplateFollowUp, FollowUpData{FollowUps: testFollowUps, AfterDays: 21})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if msg.Subject != "Follow up: 2" || msg.Text != "Acme & Sons;<Globex>;\n" {
+		t.Errorf("override not used: subject %q, text %q", msg.Subject, msg.Text)
+	}
+	// The HTML template is not overridden and falls back to the built-in one
+	if !strings.Contains(msg.HTML, "Acme &amp; Sons, Engineer") {
+		t.Errorf("built-in HTML template not used:\n%s", msg.HTML)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, TemplateDigest+".txt.tmpl"), []byte(`{{define "subject"}}{{.Nope}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTemplates(dir).Render(TemplateDigest, DigestData{}); err == nil {
+		t.Error("broken override rendered")
+	}
+}
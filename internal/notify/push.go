@@ -0,0 +1,176 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// pushTimeout limits how long a push server may take to accept a notification
+const pushTimeout = 10 * time.Second
+
+// maxPushSize is the longest notification body sent, ntfy turns longer ones into attachments
+const maxPushSize = 4000
+
+var pushClient = &http.Client{Timeout: pushTimeout}
+
+// pushURL checks that raw is an http or https URL
+func pushURL(name, raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s configuration: url must be an http or https URL", name)
+	}
+	return u, nil
+}
+
+// truncate shortens s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n-len("…")]
+	for !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s + "…"
+}
+
+// post sends a push notification request, treating any status but 2xx as a failure
+func post(ctx context.Context, req *http.Request) error {
+	resp, err := pushClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s responded with %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// NtfyConfig is where ntfy notifications are published
+type NtfyConfig struct {
+	// URL is the topic to publish to, like https://ntfy.sh/my-job-search
+	URL string
+	// Token is an access token for topics that require one
+	Token string
+	// Priority is from 1 (min) to 5 (max), 0 uses the server's default
+	Priority int
+}
+
+// Ntfy publishes messages to an ntfy topic
+type Ntfy struct {
+	config NtfyConfig
+}
+
+// NewNtfy returns an ntfy notifier for a validated configuration
+func NewNtfy(config NtfyConfig) (*Ntfy, error) {
+	u, err := pushURL("ntfy", config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return nil, errors.New("invalid ntfy configuration: url must include the topic")
+	}
+	if config.Priority < 0 || config.Priority > 5 {
+		return nil, errors.New("invalid ntfy configuration: priority must be between 1 and 5")
+	}
+	return &Ntfy{config: config}, nil
+}
+
+// Name returns "ntfy"
+func (n *Ntfy) Name() string {
+	return "ntfy"
+}
+
+// Send publishes the subject and text of a message
+func (n *Ntfy) Send(ctx context.Context, msg Message) error {
+	req, err := http.NewRequest(http.MethodPost, n.config.URL, strings.NewReader(truncate(msg.Text, maxPushSize)))
+	if err != nil {
+		return err
+	}
+	// ntfy decodes RFC 2047 encoded headers, which keeps non-ASCII titles intact
+	req.Header.Set("Title", mime.QEncoding.Encode("utf-8", msg.Subject))
+	req.Header.Set("Tags", "briefcase")
+	if n.config.Priority > 0 {
+		req.Header.Set("Priority", strconv.Itoa(n.config.Priority))
+	}
+	if msg.URL != "" {
+		req.Header.Set("Click", msg.URL)
+	}
+	if n.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.config.Token)
+	}
+	return post(ctx, req)
+}
+
+// GotifyConfig is where Gotify notifications are sent
+type GotifyConfig struct {
+	// URL is the address of the Gotify server
+	URL string
+	// Token is the token of the application the messages are sent as
+	Token string
+	// Priority is from 0 to 10, 0 uses the application's default
+	Priority int
+}
+
+// Gotify sends messages to a Gotify server
+type Gotify struct {
+	config   GotifyConfig
+	endpoint string
+}
+
+// NewGotify returns a Gotify notifier for a validated configuration
+func NewGotify(config GotifyConfig) (*Gotify, error) {
+	u, err := pushURL("Gotify", config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if config.Token == "" {
+		return nil, errors.New("invalid Gotify configuration: an application token is required")
+	}
+	if config.Priority < 0 || config.Priority > 10 {
+		return nil, errors.New("invalid Gotify configuration: priority must be between 0 and 10")
+	}
+	return &Gotify{config: config, endpoint: u.JoinPath("message").String()}, nil
+}
+
+// Name returns "gotify"
+func (g *Gotify) Name() string {
+	return "gotify"
+}
+
+// Send posts the subject and text of a message
+func (g *Gotify) Send(ctx context.Context, msg Message) error {
+	extras := map[string]any{"client::display": map[string]string{"contentType": "text/plain"}}
+	if msg.URL != "" {
+		extras["client::notification"] = map[string]any{"click": map[string]string{"url": msg.URL}}
+	}
+	payload := map[string]any{"title": msg.Subject, "message": truncate(msg.Text, maxPushSize), "extras": extras}
+	if g.config.Priority > 0 {
+		payload["priority"] = g.config.Priority
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, g.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gotify-Key", g.config.Token)
+	return post(ctx, req)
+}
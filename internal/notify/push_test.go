@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// pushRequest is a request received by a push server stand-in
+type pushRequest struct {
+	method, path string
+	header       http.Header
+	body         string
+}
+
+// newPushServer records the requests it gets and answers them with status and body
+func newPushServer(t *testing.T, status int, body string) (*httptest.Server, *[]pushRequest) {
+	t.Helper()
+	var received []pushRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = append(received, pushRequest{method: r.Method, path: r.URL.Path, header: r.Header.Clone(), body: string(b)})
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &received
+}
+
+// longPushMessage has a body over maxPushSize made of multi-byte characters
+var longPushMessage = Message{
+	Subject: "3 applications to follow up on – Überblick",
+	Text:    strings.Repeat("Acme, Ingénieur\n", maxPushSize/8),
+	URL:     "https://tracker.example.com",
+}
+
+// wantTruncated checks that body is the start of text cut to maxPushSize bytes
+func wantTruncated(t *testing.T, body, text string) {
+	t.Helper()
+	if len(body) > maxPushSize || !utf8.ValidString(body) || !strings.HasSuffix(body, "…") {
+		t.Errorf("body of %d bytes is not truncated to %d: ...%q", len(body), maxPushSize, body[max(len(body)-20, 0):])
+	}
+	if !strings.HasPrefix(text, strings.TrimSuffix(body, "…")) || len(body) < maxPushSize-8 {
+		t.Errorf("body of %d bytes is not the start of the text", len(body))
+	}
+}
+
+func TestNtfySend(t *testing.T) {
+	srv, received := newPushServer(t, http.StatusOK, `{"id":"x"}`)
+	n, err := NewNtfy(NtfyConfig{URL: srv.URL + "/my-job-search", Token: "tk_secret", Priority: 4})
+	if err != nil {
+		t.Fatalf("NewNtfy: %v", err)
+	}
+	if err := n.Send(context.Background(), longPushMessage); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if len(*received) != 1 {
+		t.Fatalf("%d requests, want 1", len(*received))
+	}
+	req := (*received)[0]
+	if req.method != http.MethodPost || req.path != "/my-job-search" {
+		t.Errorf("request %s %s", req.method, req.path)
+	}
+	title, err := new(mime.WordDecoder).DecodeHeader(req.header.Get("Title"))
+	if err != nil || title != longPushMessage.Subject {
+		t.Errorf("Title %q decodes to %q (%v)", req.header.Get("Title"), title, err)
+	}
+	for name, want := range map[string]string{
+		"Authorization": "Bearer tk_secret",
+		"Priority":      "4",
+		"Click":         "https://tracker.example.com",
+		"Tags":          "briefcase",
+	} {
+		if got := req.header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	wantTruncated(t, req.body, longPushMessage.Text)
+}
+
+func TestNtfySendDefaults(t *testing.T) {
+	srv, received := newPushServer(t, http.StatusOK, "")
+	n, err := NewNtfy(NtfyConfig{URL: srv.URL + "/topic"})
+	if err != nil {
+		t.Fatalf("NewNtfy: %v", err)
+	}
+	msg := Message{Subject: "Digest", Text: "Nothing changed.\n"}
+	if err := n.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	req := (*received)[0]
+	for _, name := range []string{"Authorization", "Priority", "Click"} {
+		if got := req.header.Get(name); got != "" {
+			t.Errorf("%s = %q, want none", name, got)
+		}
+	}
+	if req.header.Get("Title") != "Digest" || req.body != msg.Text {
+		t.Errorf("Title %q, body %q", req.header.Get("Title"), req.body)
+	}
+}
+
+func TestGotifySend(t *testing.T) {
+	srv, received := newPushServer(t, http.StatusOK, `{"id":1}`)
+	g, err := NewGotify(GotifyConfig{URL: srv.URL + "/gotify/", Token: "app-token", Priority: 7})
+	if err != nil {
+		t.Fatalf("NewGotify: %v", err)
+	}
+	if err := g.Send(context.Background(), longPushMessage); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if len(*received) != 1 {
+		t.Fatalf("%d requests, want 1", len(*received))
+	}
+	req := (*received)[0]
+	if req.method != http.MethodPost || req.path != "/gotify/message" {
+		t.Errorf("request %s %s", req.method, req.path)
+	}
+	if got := req.header.Get("X-Gotify-Key"); got != "app-token" {
+		t.Errorf("X-Gotify-Key = %q", got)
+	}
+	if got := req.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+
+	var payload struct {
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+		Extras   struct {
+			Display struct {
+				ContentType string `json:"contentType"`
+			} `json:"client::display"`
+			Notification struct {
+				Click struct {
+					URL string `json:"url"`
+				} `json:"click"`
+			} `json:"client::notification"`
+		} `json:"extras"`
+	}
+	if err := json.Unmarshal([]byte(req.body), &payload); err != nil {
+		t.Fatalf("body %q: %v", req.body, err)
+	}
+	if payload.Title != longPushMessage.Subject || payload.Priority != 7 {
+		t.Errorf("title %q, priority %d", payload.Title, payload.Priority)
+	}
+	if payload.Extras.Display.ContentType != "text/plain" || payload.Extras.Notification.Click.URL != longPushMessage.URL {
+		t.Errorf("extras %+v", payload.Extras)
+	}
+	wantTruncated(t, payload.Message, longPushMessage.Text)
+}
+
+func TestGotifySendDefaultPriority(t *testing.T) {
+	srv, received := newPushServer(t, http.StatusOK, "")
+	g, err := NewGotify(GotifyConfig{URL: srv.URL, Token: "app-token"})
+	if err != nil {
+		t.Fatalf("NewGotify: %v", err)
+	}
+	if err := g.Send(context.Background(), Message{Subject: "Digest", Text: "Nothing changed.\n"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal([]byte((*received)[0].body), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload["priority"]; ok {
+		t.Errorf("priority sent: %v", payload)
+	}
+	if extras := payload["extras"].(map[string]any); extras["client::notification"] != nil {
+		t.Errorf("click URL sent without one: %v", extras)
+	}
+}
+
+func TestPushErrorStatus(t *testing.T) {
+	srv, _ := newPushServer(t, http.StatusForbidden, `{"error":"forbidden"}`+"\n")
+	ntfy, err := NewNtfy(NtfyConfig{URL: srv.URL + "/topic"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotify, err := NewGotify(GotifyConfig{URL: srv.URL, Token: "wrong"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range []Notifier{ntfy, gotify} {
+		err := n.Send(context.Background(), Message{Subject: "Digest", Text: "Nothing changed.\n"})
+		if err == nil || !strings.Contains(err.Error(), "403 Forbidden") || !strings.HasSuffix(err.Error(), `{"error":"forbidden"}`) {
+			t.Errorf("%s: error = %v, want the status and the response", n.Name(), err)
+		}
+	}
+}
+
+func TestPushConfigValidation(t *testing.T) {
+	ntfy := []NtfyConfig{
+		{URL: ""},
+		{URL: "ftp://ntfy.sh/topic"},
+		{URL: "https://ntfy.sh/"},
+		{URL: "https://ntfy.sh/topic", Priority: 6},
+	}
+	for _, c := range ntfy {
+		if _, err := NewNtfy(c); err == nil {
+			t.Errorf("NewNtfy(%+v) accepted", c)
+		}
+	}
+	gotify := []GotifyConfig{
+		{URL: "gotify.local", Token: "t"},
+		{URL: "https://gotify.local"},
+		{URL: "https://gotify.local", Token: "t", Priority: 11},
+	}
+	for _, c := range gotify {
+		if _, err := NewGotify(c); err == nil {
+			t.Errorf("NewGotify(%+v) accepted", c)
+		}
+	}
+}
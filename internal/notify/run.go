@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+// sendAttempts is how many times a notification is tried before it is left for the next
+// interval, waiting sendRetryDelay (doubling) in between
+const (
+	sendAttempts   = 3
+	sendRetryDelay = 5 * time.Second
+)
+
+// Config is what is sent and when
+type Config struct {
+	// FollowUpAfterDays is how long an open application has to go without changes before a
+	// follow-up reminder is sent, 0 disables the reminders
+	FollowUpAfterDays int
+	// Digest is service.DigestDaily, service.DigestWeekly or empty to not send digests
+	Digest string
+	// BaseURL links the notifications to the tracker, if set
+	BaseURL string
+	// Interval is how often due notifications are checked for
+	Interval time.Duration
+}
+
+// Runner sends the notifications that are due over every channel, and queues follow-up
+// reminders for webhooks. What was sent is recorded per channel, so a channel that fails
+// catches up without repeating the others.
+type Runner struct {
+	svc       *service.JobApplicationService
+	notifiers []Notifier
+	templates *Templates
+	config    Config
+	logger    *slog.Logger
+}
+
+// NewRunner returns a runner that renders its messages with templates and sends them with notifiers
+func NewRunner(svc *service.JobApplicationService, notifiers []Notifier, templates *Templates, config Config, logger *slog.Logger) *Runner {
+	return &Runner{svc: svc, notifiers: notifiers, templates: templates, config: config, logger: logger}
+}
+
+// send delivers a message, retrying failures a few times in case they are brief
+func (r *Runner) send(ctx context.Context, n Notifier, msg Message) error {
+	msg.URL = r.config.BaseURL
+	delay := sendRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := n.Send(ctx, msg)
+		if err == nil || attempt == sendAttempts {
+			return err
+		}
+		r.logger.Warn("Failed to send notification, retrying", "channel", n.Name(), "attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// sendFollowUps sends a reminder listing the applications that went quiet since the last one
+func (r *Runner) sendFollowUps(ctx context.Context, n Notifier) error {
+	due, err := r.svc.DueFollowUps(n.Name(), r.config.FollowUpAfterDays)
+	if err != nil || len(due) == 0 {
+		return err
+	}
+	msg, err := r.templates.Render(TemplateFollowUp, FollowUpData{FollowUps: due, AfterDays: r.config.FollowUpAfterDays, BaseURL: r.config.BaseURL})
+	if err != nil {
+		return err
+	}
+	if err := r.send(ctx, n, msg); err != nil {
+		return err
+	}
+	r.logger.Info("Sent follow-up reminder", "channel", n.Name(), "applications", len(due))
+	return r.svc.MarkFollowUpsSent(n.Name(), due)
+}
+
+// sendDigest sends the digest of the last complete period, unless it was already sent
+func (r *Runner) sendDigest(ctx context.Context, n Notifier, now time.Time) error {
+	from, to, err := service.DigestPeriod(r.config.Digest, now)
+	if err != nil {
+		return err
+	}
+	key := r.config.Digest + "@" + from.Format(time.DateOnly)
+	if sent, err := r.svc.Notified(n.Name(), service.NotificationDigest, key); err != nil || sent {
+		return err
+	}
+
+	digest, err := r.svc.GetDigest(r.config.Digest, from, to)
+	if err != nil {
+		return err
+	}
+	data := DigestData{Digest: digest, Statuses: service.ValidStatuses, BaseURL: r.config.BaseURL}
+	if r.config.FollowUpAfterDays > 0 {
+		if data.FollowUps, err = r.svc.GetGhostedApplications(r.config.FollowUpAfterDays); err != nil {
+			return err
+		}
+	}
+	msg, err := r.templates.Render(TemplateDigest, data)
+	if err != nil {
+		return err
+	}
+	if err := r.send(ctx, n, msg); err != nil {
+		return err
+	}
+	r.logger.Info("Sent digest", "channel", n.Name(), "period", r.config.Digest, "from", from.Format(time.DateOnly), "changes", len(digest.Changes))
+	return r.svc.MarkNotified(n.Name(), service.NotificationDigest, key)
+}
+
+// Run sends the due notifications every interval until ctx is cancelled. A notification that
+// fails to send is not recorded as sent, so it is tried again at the next interval.
+func (r *Runner) Run(ctx context.Context) {
+	channels := make([]string, len(r.notifiers))
+	for i, n := range r.notifiers {
+		channels[i] = n.Name()
+	}
+	r.logger.Info("Notifier started", "channels", channels, "interval", r.config.Interval.String(), "followUpAfterDays", r.config.FollowUpAfterDays, "digest", r.config.Digest)
+
+	ticker := time.NewTicker(r.config.Interval)
+	defer ticker.Stop()
+	for {
+		if r.config.FollowUpAfterDays > 0 {
+			if queued, err := r.svc.QueueDueReminders(r.config.FollowUpAfterDays); err != nil {
+				r.logger.Error("Failed to queue follow-up reminder webhooks", "error", err)
+			} else if queued > 0 {
+				r.logger.Info("Queued follow-up reminder webhooks", "applications", queued)
+			}
+		}
+		for _, n := range r.notifiers {
+			if r.config.FollowUpAfterDays > 0 {
+				if err := r.sendFollowUps(ctx, n); err != nil && ctx.Err() == nil {
+					r.logger.Error("Failed to send follow-up reminder", "channel", n.Name(), "error", err)
+				}
+			}
+			if r.config.Digest != "" {
+				if err := r.sendDigest(ctx, n, time.Now()); err != nil && ctx.Err() == nil {
+					r.logger.Error("Failed to send digest", "channel", n.Name(), "error", err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Notifier stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
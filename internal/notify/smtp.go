@@ -0,0 +1,214 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Connection security of an SMTP server
+const (
+	// SecurityStartTLS upgrades a plain connection, usually on port 587, and fails if the
+	// server does not offer STARTTLS
+	SecurityStartTLS = "starttls"
+	// SecurityTLS connects over TLS from the start, usually on port 465
+	SecurityTLS = "tls"
+	// SecurityNone sends in the clear, only meant for a relay on the local machine or network
+	SecurityNone = "none"
+)
+
+// smtpTimeout limits how long sending a single email may take
+const smtpTimeout = 30 * time.Second
+
+// SMTPConfig is how emails are sent
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Security string
+	// Username and Password are used for PLAIN authentication when a username is set
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Validate checks the configuration
+func (c SMTPConfig) Validate() error {
+	var problems []string
+	if c.Host == "" {
+		problems = append(problems, "host is required")
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		problems = append(problems, "port must be between 1 and 65535")
+	}
+	if c.Security != SecurityStartTLS && c.Security != SecurityTLS && c.Security != SecurityNone {
+		problems = append(problems, fmt.Sprintf("security must be %s, %s or %s", SecurityStartTLS, SecurityTLS, SecurityNone))
+	}
+	if _, err := mail.ParseAddress(c.From); err != nil {
+		problems = append(problems, "from must be an email address")
+	}
+	if len(c.To) == 0 {
+		problems = append(problems, "at least one recipient is required")
+	}
+	for _, to := range c.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			problems = append(problems, fmt.Sprintf("recipient %q is not an email address", to))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid SMTP configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Mailer sends messages by email
+type Mailer struct {
+	config SMTPConfig
+	// rootCAs verify the server's certificate, nil uses the system's
+	rootCAs *x509.CertPool
+}
+
+// NewMailer returns a mailer for a validated configuration
+func NewMailer(config SMTPConfig) (*Mailer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Mailer{config: config}, nil
+}
+
+// Name returns "email"
+func (m *Mailer) Name() string {
+	return "email"
+}
+
+// Send delivers a message to every configured recipient
+func (m *Mailer) Send(ctx context.Context, msg Message) error {
+	c := m.config
+	body, err := m.compose(msg)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	addr := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	tlsConfig := &tls.Config{ServerName: c.Host, RootCAs: m.rootCAs}
+
+	var conn net.Conn
+	if c.Security == SecurityTLS {
+		conn, err = (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, c.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if c.Security == SecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starting TLS: %w", err)
+		}
+	}
+	if c.Username != "" {
+		// PlainAuth refuses to send the password over a connection that is not encrypted,
+		// unless the server is on the local machine
+		if err := client.Auth(smtp.PlainAuth("", c.Username, c.Password, c.Host)); err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	from, _ := mail.ParseAddress(c.From)
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, to := range c.To {
+		addr, _ := mail.ParseAddress(to)
+		if err := client.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("recipient %s: %w", addr.Address, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// compose builds a multipart/alternative email with the text and HTML bodies
+func (m *Mailer) compose(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	from, _ := mail.ParseAddress(m.config.From)
+	id := make([]byte, 12)
+	rand.Read(id)
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", from.String())
+	header("To", strings.Join(m.config.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(id)+"@"+domain+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", `multipart/alternative; boundary="`+parts.Boundary()+`"`)
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		// Quoted-printable needs CRLF line endings to keep them as they are
+		if _, err := qp.Write([]byte(strings.ReplaceAll(part.body, "\n", "\r\n"))); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,357 @@
+package notify
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a certificate for the loopback addresses and a pool that trusts it
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake smtp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv4(127, 0, 0, 2)},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// receivedMail is a message accepted by fakeSMTP
+type receivedMail struct {
+	// auth is the argument of the AUTH command, if the client authenticated
+	auth      string
+	encrypted bool
+	from      string
+	to        []string
+	data      string
+}
+
+// fakeSMTP is an SMTP server that accepts every message. It speaks TLS from the start when
+// implicitTLS is set and otherwise offers STARTTLS when startTLS is set.
+type fakeSMTP struct {
+	t           *testing.T
+	addr        string
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	startTLS    bool
+
+	mu       sync.Mutex
+	mails    []receivedMail
+	commands []string
+}
+
+func newFakeSMTP(t *testing.T, host string, cert tls.Certificate, implicitTLS, startTLS bool) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", host, err)
+	}
+	s := &fakeSMTP{
+		t:           t,
+		addr:        ln.Addr().String(),
+		tlsConfig:   &tls.Config{Certificates: []tls.Certificate{cert}},
+		implicitTLS: implicitTLS,
+		startTLS:    startTLS,
+	}
+	if implicitTLS {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
+
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		ln.Close()
+		wg.Wait()
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.serve(conn)
+			}()
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	tp := textproto.NewConn(conn)
+	encrypted := s.implicitTLS
+	var m receivedMail
+
+	tp.PrintfLine("220 fake ESMTP ready")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+		s.mu.Lock()
+		s.commands = append(s.commands, verb)
+		s.mu.Unlock()
+
+		switch verb {
+		case "EHLO":
+			tp.PrintfLine("250-fake greets %s", arg)
+			if s.startTLS && !encrypted {
+				tp.PrintfLine("250-STARTTLS")
+			}
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "STARTTLS":
+			tp.PrintfLine("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, encrypted = tlsConn, true
+			tp = textproto.NewConn(conn)
+		case "AUTH":
+			m.auth = arg
+			tp.PrintfLine("235 authenticated")
+		case "MAIL":
+			m.from, m.encrypted = arg, encrypted
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			m.to = append(m.to, arg)
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(data)
+			s.mu.Lock()
+			s.mails = append(s.mails, m)
+			s.mu.Unlock()
+			m = receivedMail{auth: m.auth}
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *fakeSMTP) received() ([]receivedMail, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mails, s.commands
+}
+
+// testMailer returns a mailer for the fake server that trusts its certificate
+func testMailer(t *testing.T, s *fakeSMTP, security, username string, pool *x509.CertPool) *Mailer {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(s.addr)
+	p, _ := strconv.Atoi(port)
+	m, err := NewMailer(SMTPConfig{
+		Host:     host,
+		Port:     p,
+		Security: security,
+		Username: username,
+		Password: "hunter2",
+		From:     "Tracker <tracker@example.com>",
+		To:       []string{"me@example.com", "Partner <partner@example.com>"},
+	})
+	if err != nil {
+		t.Fatalf("NewMailer: %v", err)
+	}
+	m.rootCAs = pool
+	return m
+}
+
+var testMessage = Message{
+	Subject: "2 applications to follow up on – Übersicht",
+	Text:    "Acme, Engineer\nGlobex, Designer\n",
+	HTML:    "<p>Acme, Engineer</p>",
+}
+
+// readParts decodes the text and HTML bodies of a sent message
+func readParts(t *testing.T, data string) (*mail.Message, map[string]string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("read message: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type %q", msg.Header.Get("Content-Type"))
+	}
+
+	parts := map[string]string{}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		if enc := p.Header.Get("Content-Transfer-Encoding"); enc != "quoted-printable" {
+			t.Errorf("Content-Transfer-Encoding %q", enc)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(p))
+		if err != nil {
+			t.Fatalf("decode part: %v", err)
+		}
+		mediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts[mediaType] = string(body)
+	}
+	return msg, parts
+}
+
+func TestMailerSend(t *testing.T) {
+	cert, pool := testCertificate(t)
+	tests := []struct {
+		security    string
+		implicitTLS bool
+		startTLS    bool
+		username    string
+		encrypted   bool
+	}{
+		// PlainAuth allows the clear text password to a server on the local machine
+		{security: SecurityNone, username: "me", encrypted: false},
+		{security: SecurityNone, startTLS: true, encrypted: false},
+		{security: SecurityStartTLS, startTLS: true, username: "me", encrypted: true},
+		{security: SecurityTLS, implicitTLS: true, username: "me", encrypted: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.security+"/"+tt.username, func(t *testing.T) {
+			srv := newFakeSMTP(t, "127.0.0.1", cert, tt.implicitTLS, tt.startTLS)
+			m := testMailer(t, srv, tt.security, tt.username, pool)
+			if err := m.Send(context.Background(), testMessage); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			mails, _ := srv.received()
+			if len(mails) != 1 {
+				t.Fatalf("%d mails received, want 1", len(mails))
+			}
+			got := mails[0]
+			if got.encrypted != tt.encrypted {
+				t.Errorf("encrypted = %v, want %v", got.encrypted, tt.encrypted)
+			}
+			wantAuth := ""
+			if tt.username != "" {
+				wantAuth = "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00me\x00hunter2"))
+			}
+			if got.auth != wantAuth {
+				t.Errorf("AUTH %q, want %q", got.auth, wantAuth)
+			}
+			if got.from != "FROM:<tracker@example.com>" {
+				t.Errorf("MAIL %q", got.from)
+			}
+			if want := []string{"TO:<me@example.com>", "TO:<partner@example.com>"}; strings.Join(got.to, ",") != strings.Join(want, ",") {
+				t.Errorf("RCPT %q, want %q", got.to, want)
+			}
+
+			msg, parts := readParts(t, got.data)
+			subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			if err != nil || subject != testMessage.Subject {
+				t.Errorf("Subject %q (%v), want %q", subject, err, testMessage.Subject)
+			}
+			if to := msg.Header.Get("To"); to != "me@example.com, Partner <partner@example.com>" {
+				t.Errorf("To %q", to)
+			}
+			if text := strings.ReplaceAll(parts["text/plain"], "\r\n", "\n"); text != testMessage.Text {
+				t.Errorf("text part %q, want %q", text, testMessage.Text)
+			}
+			if parts["text/html"] != testMessage.HTML {
+				t.Errorf("HTML part %q, want %q", parts["text/html"], testMessage.HTML)
+			}
+		})
+	}
+}
+
+func TestMailerStartTLSRequired(t *testing.T) {
+	cert, pool := testCertificate(t)
+	srv := newFakeSMTP(t, "127.0.0.1", cert, false, false)
+	m := testMailer(t, srv, SecurityStartTLS, "me", pool)
+
+	err := m.Send(context.Background(), testMessage)
+	if err == nil || !strings.Contains(err.Error(), "does not support STARTTLS") {
+		t.Fatalf("Send error = %v, want missing STARTTLS", err)
+	}
+	if mails, commands := srv.received(); len(mails) != 0 || strings.Contains(strings.Join(commands, " "), "AUTH") {
+		t.Errorf("sent %d mails with commands %v", len(mails), commands)
+	}
+}
+
+func TestMailerRejectsUntrustedCertificate(t *testing.T) {
+	cert, _ := testCertificate(t)
+	srv := newFakeSMTP(t, "127.0.0.1", cert, true, false)
+	m := testMailer(t, srv, SecurityTLS, "me", nil)
+
+	if err := m.Send(context.Background(), testMessage); err == nil {
+		t.Fatal("Send trusted a self-signed certificate")
+	}
+}
+
+// The password is never sent in the clear to a server that is not on the local machine. Any
+// loopback address other than 127.0.0.1 stands in for a remote host.
+func TestMailerRefusesPlainAuthUnencrypted(t *testing.T) {
+	cert, pool := testCertificate(t)
+	srv := newFakeSMTP(t, "127.0.0.2", cert, false, true)
+	m := testMailer(t, srv, SecurityNone, "me", pool)
+
+	err := m.Send(context.Background(), testMessage)
+	if err == nil || !strings.Contains(err.Error(), "authenticating") {
+		t.Fatalf("Send error = %v, want an authentication error", err)
+	}
+	if mails, commands := srv.received(); len(mails) != 0 || strings.Contains(strings.Join(commands, " "), "AUTH") {
+		t.Errorf("sent %d mails with commands %v", len(mails), commands)
+	}
+}
@@ -0,0 +1,235 @@
+// Package pdf writes simple PDF documents of text, lines and filled rectangles using the
+// standard Helvetica fonts, which every PDF reader provides, so nothing needs to be embedded.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Page sizes in points (1/72 inch)
+var (
+	A4     = Size{595.28, 841.89}
+	Letter = Size{612, 792}
+)
+
+// Size is the width and height of a page in points
+type Size struct {
+	Width, Height float64
+}
+
+// Font is one of the standard fonts
+type Font int
+
+const (
+	Helvetica Font = iota
+	HelveticaBold
+)
+
+var fontNames = [...]string{Helvetica: "Helvetica", HelveticaBold: "Helvetica-Bold"}
+
+// Document is a PDF document being built page by page
+type Document struct {
+	Title     string
+	CreatedAt time.Time
+	size      Size
+	pages     []*Page
+}
+
+// Page is a page of a document. Coordinates are in points from the top left corner.
+type Page struct {
+	height  float64
+	content bytes.Buffer
+}
+
+// New starts a document whose pages have the given size
+func New(size Size) *Document {
+	return &Document{size: size, CreatedAt: time.Now()}
+}
+
+// Size returns the page size of the document
+func (d *Document) Size() Size {
+	return d.size
+}
+
+// AddPage appends an empty page
+func (d *Document) AddPage() *Page {
+	p := &Page{height: d.size.Height}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Pages returns the pages added so far
+func (d *Document) Pages() []*Page {
+	return d.pages
+}
+
+// Text draws s with its baseline starting at x, y
+func (p *Page) Text(x, y float64, f Font, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F%d %.2f Tf %.2f %.2f Td ", f+1, size, x, p.height-y)
+	p.content.WriteString(literal(encode(s)))
+	p.content.WriteString(" Tj ET\n")
+}
+
+// Line draws a line of the given width in a shade of gray between 0 (black) and 1 (white)
+func (p *Page) Line(x1, y1, x2, y2, width, gray float64) {
+	fmt.Fprintf(&p.content, "%.3f G %.2f w %.2f %.2f m %.2f %.2f l S\n", gray, width, x1, p.height-y1, x2, p.height-y2)
+}
+
+// Rect fills a rectangle whose top left corner is at x, y in a shade of gray
+func (p *Page) Rect(x, y, w, h, gray float64) {
+	fmt.Fprintf(&p.content, "%.3f g %.2f %.2f %.2f %.2f re f 0 g\n", gray, x, p.height-y-h, w, h)
+}
+
+// TextWidth returns the width of s in points
+func TextWidth(f Font, size float64, s string) float64 {
+	units := 0
+	for _, b := range encode(s) {
+		units += charWidth(f, b)
+	}
+	return float64(units) * size / 1000
+}
+
+// Wrap breaks s into lines no wider than width, splitting at spaces where possible and within
+// words that are too long on their own
+func Wrap(f Font, size float64, s string, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if TextWidth(f, size, candidate) <= width {
+				line = candidate
+				continue
+			}
+			if line != "" {
+				lines = append(lines, line)
+			}
+			// Break up words that don't fit a line by themselves, such as long links
+			line = ""
+			for _, r := range word {
+				if line != "" && TextWidth(f, size, line+string(r)) > width {
+					lines = append(lines, line)
+					line = ""
+				}
+				line += string(r)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// encode converts s to the WinAnsi encoding of the standard fonts, replacing characters it
+// doesn't have with '?'
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			b = append(b, ' ')
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b = append(b, byte(r))
+		default:
+			if c, ok := winAnsi[r]; ok {
+				b = append(b, c)
+			} else {
+				b = append(b, '?')
+			}
+		}
+	}
+	return b
+}
+
+// winAnsi maps the characters WinAnsi places in 0x80-0x9f
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b,
+	'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// literal writes encoded text as a PDF string
+func literal(b []byte) string {
+	var s strings.Builder
+	s.WriteByte('(')
+	for _, c := range b {
+		if c == '(' || c == ')' || c == '\\' {
+			s.WriteByte('\\')
+		}
+		s.WriteByte(c)
+	}
+	s.WriteByte(')')
+	return s.String()
+}
+
+// textString encodes document metadata as UTF-16 so it may use any character
+func textString(s string) string {
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// Bytes serializes the document
+func (d *Document) Bytes() ([]byte, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	// Objects are numbered from 1 in the order they are written
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// 1: catalog, 2: page tree, 3 and 4: fonts, 5: info, then a page and its contents for every page
+	const firstPage = 6
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	for _, name := range fontNames {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+	}
+	object(fmt.Sprintf("<< /Title %s /Producer (ctrl-alt-me) /CreationDate (D:%s) >>",
+		textString(d.Title), d.CreatedAt.UTC().Format("20060102150405Z")))
+
+	for i, p := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			d.size.Width, d.size.Height, firstPage+2*i+1))
+
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		if _, err := zw.Write(p.content.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
@@ -0,0 +1,222 @@
+// Package report lays out printable tabular reports as HTML or PDF documents
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/pdf"
+)
+
+// Column is a column of a report table. Weight is its share of the page width relative to the
+// other columns.
+type Column struct {
+	Label  string
+	Weight float64
+}
+
+// Document is a titled table with free text above and below it
+type Document struct {
+	Title string
+	// Subtitle is shown under the title, e.g. the period the report covers
+	Subtitle string
+	Header   string
+	Footer   string
+	Columns  []Column
+	Rows     [][]string
+	// Empty is shown instead of the table when there are no rows
+	Empty string
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"paragraphs": func(s string) []string {
+		if strings.TrimSpace(s) == "" {
+			return nil
+		}
+		return strings.Split(s, "\n\n")
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+@page { margin: 18mm; }
+body { font-family: Helvetica, Arial, sans-serif; font-size: 10pt; color: #222; margin: 2em auto; max-width: 60em; }
+@media print { body { margin: 0; max-width: none; } }
+h1 { font-size: 18pt; margin: 0 0 .2em; }
+.subtitle { color: #555; margin: 0 0 1.5em; }
+p { white-space: pre-line; }
+table { border-collapse: collapse; width: 100%; margin: 1em 0; }
+th, td { text-align: left; vertical-align: top; padding: .35em .5em; border-bottom: 1px solid #ccc; overflow-wrap: anywhere; }
+th { background: #eee; border-bottom: 1px solid #888; }
+thead { display: table-header-group; }
+tr { break-inside: avoid; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{with .Subtitle}}<p class="subtitle">{{.}}</p>{{end}}
+{{range paragraphs .Header}}<p>{{.}}</p>
+{{end}}
+{{- if .Rows}}
+<table>
+<colgroup>{{range .Columns}}<col style="width: {{.Weight}}%">{{end}}</colgroup>
+<thead><tr>{{range .Columns}}<th>{{.Label}}</th>{{end}}</tr></thead>
+<tbody>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+{{else}}
+<p>{{.Empty}}</p>
+{{end}}
+{{- range paragraphs .Footer}}<p>{{.}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+// percentages scales the column weights to add up to 100
+func (d Document) percentages() []Column {
+	total := 0.0
+	for _, c := range d.Columns {
+		total += c.Weight
+	}
+	columns := make([]Column, len(d.Columns))
+	for i, c := range d.Columns {
+		columns[i] = Column{Label: c.Label, Weight: float64(int(c.Weight/total*1000)) / 10}
+	}
+	return columns
+}
+
+// HTML renders the report as a standalone HTML page meant for printing
+func (d Document) HTML() ([]byte, error) {
+	d.Columns = d.percentages()
+	var buf bytes.Buffer
+	if err := htmlTemplate.Execute(&buf, d); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// PDF layout, in points
+const (
+	margin       = 50.0
+	titleSize    = 18.0
+	textSize     = 10.0
+	tableSize    = 9.0
+	lineHeight   = 1.3
+	cellPadding  = 4.0
+	footnoteSize = 8.0
+)
+
+// pdfWriter keeps track of the current page and position while laying out a PDF
+type pdfWriter struct {
+	doc  *pdf.Document
+	page *pdf.Page
+	y    float64
+}
+
+func (w *pdfWriter) newPage() {
+	w.page = w.doc.AddPage()
+	w.y = margin
+}
+
+// fits starts a new page unless h more points fit on the current one
+func (w *pdfWriter) fits(h float64) bool {
+	if w.y+h <= w.doc.Size().Height-margin {
+		return true
+	}
+	w.newPage()
+	return false
+}
+
+// paragraphs writes wrapped text across the page width
+func (w *pdfWriter) paragraphs(s string, f pdf.Font, size float64) {
+	if strings.TrimSpace(s) == "" {
+		return
+	}
+	width := w.doc.Size().Width - 2*margin
+	for _, line := range pdf.Wrap(f, size, s, width) {
+		w.fits(size * lineHeight)
+		w.y += size * lineHeight
+		w.page.Text(margin, w.y-size*0.25, f, size, line)
+	}
+	w.y += size
+}
+
+// cells wraps every cell of a row to its column and returns the lines with the row's height
+func cells(values []string, widths []float64, f pdf.Font) ([][]string, float64) {
+	lines := make([][]string, len(values))
+	height := 0.0
+	for i, v := range values {
+		lines[i] = pdf.Wrap(f, tableSize, v, widths[i]-2*cellPadding)
+		height = max(height, float64(len(lines[i]))*tableSize*lineHeight+2*cellPadding)
+	}
+	return lines, height
+}
+
+// row writes a table row at the current position
+func (w *pdfWriter) row(values []string, widths []float64, f pdf.Font, shaded bool) {
+	lines, height := cells(values, widths, f)
+	tableWidth := w.doc.Size().Width - 2*margin
+	if shaded {
+		w.page.Rect(margin, w.y, tableWidth, height, 0.92)
+	}
+	x := margin
+	for i := range lines {
+		for j, line := range lines[i] {
+			w.page.Text(x+cellPadding, w.y+cellPadding+float64(j+1)*tableSize*lineHeight-tableSize*0.3, f, tableSize, line)
+		}
+		x += widths[i]
+	}
+	w.y += height
+	w.page.Line(margin, w.y, margin+tableWidth, w.y, 0.5, 0.6)
+}
+
+// PDF renders the report as a PDF document of the given page size, repeating the table header
+// on every page and numbering the pages
+func (d Document) PDF(size pdf.Size) ([]byte, error) {
+	w := &pdfWriter{doc: pdf.New(size)}
+	w.doc.Title = d.Title
+	w.newPage()
+
+	w.paragraphs(d.Title, pdf.HelveticaBold, titleSize)
+	w.y -= titleSize / 2
+	w.paragraphs(d.Subtitle, pdf.Helvetica, textSize)
+	w.paragraphs(d.Header, pdf.Helvetica, textSize)
+
+	if len(d.Rows) == 0 {
+		w.paragraphs(d.Empty, pdf.Helvetica, textSize)
+	} else {
+		tableWidth := size.Width - 2*margin
+		widths := make([]float64, len(d.Columns))
+		labels := make([]string, len(d.Columns))
+		for i, c := range d.percentages() {
+			widths[i] = tableWidth * c.Weight / 100
+			labels[i] = c.Label
+		}
+		_, headerHeight := cells(labels, widths, pdf.HelveticaBold)
+		for i, r := range d.Rows {
+			_, height := cells(r, widths, pdf.Helvetica)
+			if i == 0 || !w.fits(height) {
+				// Keep the header together with the first row below it on every page
+				w.fits(headerHeight + height)
+				w.row(labels, widths, pdf.HelveticaBold, true)
+			}
+			w.row(r, widths, pdf.Helvetica, false)
+		}
+		w.y += textSize
+	}
+
+	w.paragraphs(d.Footer, pdf.Helvetica, textSize)
+
+	pages := w.doc.Pages()
+	for i, p := range pages {
+		label := fmt.Sprintf("Page %d of %d", i+1, len(pages))
+		p.Text(size.Width-margin-pdf.TextWidth(pdf.Helvetica, footnoteSize, label), size.Height-margin/2, pdf.Helvetica, footnoteSize, label)
+	}
+	return w.doc.Bytes()
+}
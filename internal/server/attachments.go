@@ -0,0 +1,154 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+// multipartOverhead is allowed on top of the attachment size limit for the multipart framing
+// and form fields of an upload
+const multipartOverhead = 1 << 20
+
+// parseUpload parses a multipart upload and returns its "file" field, writing an error
+// response if the request is too large or malformed
+func parseUpload(w http.ResponseWriter, r *http.Request, jobAppSvc *service.JobApplicationService, logger *slog.Logger) (multipart.File, *multipart.FileHeader, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, jobAppSvc.MaxAttachmentSize()+multipartOverhead)
+	if err := r.ParseMultipartForm(multipartOverhead); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+				fmt.Sprintf("Uploads may be at most %d bytes", jobAppSvc.MaxAttachmentSize()))
+			return nil, nil, false
+		}
+		logger.Debug("Failed to parse multipart form", "error", err)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to parse multipart form")
+		return nil, nil, false
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		r.MultipartForm.RemoveAll()
+		logger.Debug("Failed to get file from form", "error", err)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to get file from form")
+		return nil, nil, false
+	}
+	return file, header, true
+}
+
+// serveFile writes stored content as a download, supporting conditional and range requests
+func serveFile(w http.ResponseWriter, r *http.Request, filename, contentType, hash string, content io.ReadSeeker) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Stored content never changes, so its hash is a strong validator
+	w.Header().Set("ETag", `"`+hash+`"`)
+	http.ServeContent(w, r, filename, time.Time{}, content)
+}
+
+func handleUploadAttachment(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received upload attachment request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			file, header, ok := parseUpload(w, r, jobAppSvc, logger)
+			if !ok {
+				return
+			}
+			defer r.MultipartForm.RemoveAll()
+			defer file.Close()
+
+			a, created, err := jobAppSvc.AddAttachment(id, r.FormValue("kind"), header.Filename, file)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to store attachment")
+				return
+			}
+
+			w.Header().Set("Location", fmt.Sprintf("/api/job-applications/%d/attachments/%d", id, a.ID))
+			status := http.StatusOK
+			if created {
+				status = http.StatusCreated
+			}
+			writeJSON(w, r, logger, status, a)
+		})
+}
+
+func handleGetAttachments(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get attachments request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			attachments, err := jobAppSvc.GetAttachments(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get attachments")
+				return
+			}
+
+			writeCacheableJSON(w, r, logger, attachments, "")
+		})
+}
+
+func handleDownloadAttachment(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received download attachment request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+			attachmentID, ok := parsePathID(w, r, "attachmentID")
+			if !ok {
+				return
+			}
+
+			a, f, err := jobAppSvc.OpenAttachment(id, attachmentID)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to open attachment")
+				return
+			}
+			defer f.Close()
+
+			serveFile(w, r, a.Filename, a.ContentType, a.SHA256, f)
+		})
+}
+
+func handleDeleteAttachment(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received delete attachment request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+			attachmentID, ok := parsePathID(w, r, "attachmentID")
+			if !ok {
+				return
+			}
+
+			if err := jobAppSvc.DeleteAttachment(id, attachmentID); err != nil {
+				writeServiceError(w, r, logger, err, "Failed to delete attachment")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
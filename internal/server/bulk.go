@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+type bulkRequest struct {
+	Operations []service.BulkOperation `json:"operations"`
+	// Atomic makes the batch all-or-nothing
+	Atomic bool `json:"atomic"`
+}
+
+type bulkItemResult struct {
+	Index       int                     `json:"index"`
+	Op          string                  `json:"op"`
+	ID          int64                   `json:"id"`
+	Status      string                  `json:"status"` // ok, error, rolled_back or skipped
+	HTTPStatus  int                     `json:"http_status"`
+	Application *service.JobApplication `json:"application,omitempty"`
+	Error       *ErrorBody              `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	Committed bool             `json:"committed"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []bulkItemResult `json:"results"`
+}
+
+func handleBulkJobApplications(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received bulk applications request", "method", r.Method, "url", r.URL.String())
+
+			var req bulkRequest
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&req)
+			if err != nil {
+				logger.Debug("Failed to decode request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+				return
+			}
+
+			results, committed, err := jobAppSvc.WithActor(actor(r)).ApplyBulk(req.Operations, req.Atomic)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to apply bulk operations")
+				return
+			}
+
+			resp := bulkResponse{Committed: committed, Results: make([]bulkItemResult, len(results))}
+			for i, res := range results {
+				item := bulkItemResult{Index: res.Index, Op: res.Op, ID: res.ID, Status: "ok", HTTPStatus: http.StatusOK, Application: res.Application}
+				switch {
+				case res.Err != nil:
+					status, body := serviceErrorBody(res.Err, "Failed to apply operation")
+					body.RequestID = requestIDFromContext(r.Context())
+					if status >= http.StatusInternalServerError {
+						logger.Error("Failed to apply bulk operation", "index", res.Index, "op", res.Op, "id", res.ID, "error", res.Err)
+					}
+					item.Status, item.HTTPStatus, item.Error = "error", status, &body
+					item.Application = nil
+					resp.Failed++
+				case res.Skipped:
+					// An earlier operation of the atomic batch failed before this one was tried
+					item.Status, item.HTTPStatus = "skipped", http.StatusFailedDependency
+				case !committed:
+					// The operation worked but was undone with the rest of an atomic batch
+					item.Status, item.HTTPStatus = "rolled_back", http.StatusFailedDependency
+					item.Application = nil
+				default:
+					resp.Succeeded++
+				}
+				resp.Results[i] = item
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, resp)
+		})
+}
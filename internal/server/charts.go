@@ -0,0 +1,167 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/chart"
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+// statusColors gives every status the same color in all charts
+var statusColors = map[string]string{
+	service.StatusApplied:   "#4f7cac",
+	service.StatusInterview: "#e0a526",
+	service.StatusOffer:     "#3c9d5d",
+	service.StatusRejected:  "#c8553d",
+	service.StatusGhosted:   "#8d8d8d",
+}
+
+// chartBuilders build the charts served under /api/charts from the same aggregates as the stats endpoints
+var chartBuilders = map[string]func(svc *service.JobApplicationService, r service.DateRange) (chart.BarChart, error){
+	"funnel": funnelChart,
+	"status": statusChart,
+	"weekly": weeklyChart,
+}
+
+// rangeSubtitle describes a date range for a chart subtitle
+func rangeSubtitle(r service.DateRange) string {
+	switch {
+	case r.From != "" && r.To != "":
+		return r.From + " – " + r.To
+	case r.From != "":
+		return "Since " + r.From
+	case r.To != "":
+		return "Until " + r.To
+	}
+	return "All applications"
+}
+
+func funnelChart(svc *service.JobApplicationService, r service.DateRange) (chart.BarChart, error) {
+	report, err := svc.GetFunnel(r, "")
+	if err != nil {
+		return chart.BarChart{}, err
+	}
+
+	c := chart.BarChart{Title: "Job search funnel", Subtitle: rangeSubtitle(report.DateRange), Horizontal: true}
+	for _, st := range report.Total.Stages {
+		c.Bars = append(c.Bars, chart.Bar{
+			Label: strings.ToUpper(st.Stage[:1]) + st.Stage[1:],
+			Value: float64(st.Count),
+			Note:  chart.Percent(float64(st.Count) / float64(report.Total.Applications)),
+			Color: statusColors[st.Stage],
+		})
+	}
+	if report.Total.Applications == 0 {
+		c.Bars = nil
+	}
+	return c, nil
+}
+
+func statusChart(svc *service.JobApplicationService, r service.DateRange) (chart.BarChart, error) {
+	report, err := svc.GetFunnel(r, "")
+	if err != nil {
+		return chart.BarChart{}, err
+	}
+
+	c := chart.BarChart{Title: "Applications by status", Subtitle: rangeSubtitle(report.DateRange), Horizontal: true}
+	if report.Total.Applications == 0 {
+		return c, nil
+	}
+	for _, status := range service.ValidStatuses {
+		n := report.Total.ByStatus[status]
+		c.Bars = append(c.Bars, chart.Bar{
+			Label: strings.ToUpper(status[:1]) + status[1:],
+			Value: float64(n),
+			Note:  chart.Percent(float64(n) / float64(report.Total.Applications)),
+			Color: statusColors[status],
+		})
+	}
+	return c, nil
+}
+
+func weeklyChart(svc *service.JobApplicationService, r service.DateRange) (chart.BarChart, error) {
+	report, err := svc.GetActivity(r)
+	if err != nil {
+		return chart.BarChart{}, err
+	}
+
+	c := chart.BarChart{Title: "Applications per week", Subtitle: rangeSubtitle(report.DateRange)}
+	for _, week := range report.Weeks {
+		label := week.WeekStart
+		if t, err := time.Parse(time.DateOnly, week.WeekStart); err == nil {
+			label = t.Format("Jan 2")
+		}
+		c.Bars = append(c.Bars, chart.Bar{Label: label, Value: float64(week.Applications)})
+	}
+	return c, nil
+}
+
+// chartSize reads the optional width or height query parameter
+func chartSize(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < chart.MinSize || n > chart.MaxSize {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("%s must be between %d and %d", name, chart.MinSize, chart.MaxSize))
+		return 0, false
+	}
+	return n, true
+}
+
+// handleGetChart serves /api/charts/{chart}, where chart is one of the chartBuilders with a .svg
+// or .png extension. from and to limit the chart to a date range, width and height set its size.
+func handleGetChart(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get chart request", "method", r.Method, "url", r.URL.String())
+
+			file := r.PathValue("chart")
+			format := path.Ext(file)
+			build, ok := chartBuilders[strings.TrimSuffix(file, format)]
+			if !ok || (format != ".svg" && format != ".png") {
+				writeError(w, r, http.StatusNotFound, CodeNotFound, "Unknown chart "+file)
+				return
+			}
+
+			width, ok := chartSize(w, r, "width")
+			if !ok {
+				return
+			}
+			height, ok := chartSize(w, r, "height")
+			if !ok {
+				return
+			}
+
+			c, err := build(jobAppSvc, dateRange(r))
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to build chart")
+				return
+			}
+			c.Width, c.Height = width, height
+
+			var body []byte
+			contentType := "image/svg+xml"
+			if format == ".svg" {
+				body = c.SVG()
+			} else {
+				contentType = "image/png"
+				if body, err = c.PNG(); err != nil {
+					writeServiceError(w, r, logger, err, "Failed to render chart")
+					return
+				}
+			}
+
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(body)
+		})
+}
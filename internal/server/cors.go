@@ -1,25 +1,198 @@
 package server
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 )
 
-// corsMiddleware adds CORS headers to allow cross-origin requests from the frontend
-func corsMiddleware(next http.Handler, frontendHost, frontendPort string) http.Handler {
+const (
+	corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowedHeaders = "Content-Type, Authorization, If-Match, If-None-Match, X-Request-ID, X-Client-ID, Last-Event-ID"
+	corsExposedHeaders = "ETag, Location, X-Request-ID"
+	corsMaxAge         = "3600"
+)
+
+// CORSConfig describes which cross-origin callers may use the API
+type CORSConfig struct {
+	// AllowedOrigins lists origins such as "http://raspberrypi.local:5173". A host may start
+	// with "*." to allow any subdomain ("https://*.example.com"), and "*" allows every origin.
+	AllowedOrigins []string
+	// AllowCredentials lets browsers send cookies and Authorization headers cross-origin
+	AllowCredentials bool
+}
+
+// Validate rejects configurations that would let any site make credentialed requests
+func (c CORSConfig) Validate() error {
+	if !c.AllowCredentials {
+		return nil
+	}
+	for _, o := range c.AllowedOrigins {
+		if strings.TrimSpace(o) == "*" {
+			return errors.New(`credentials cannot be allowed for the "*" origin, list the origins instead`)
+		}
+	}
+	return nil
+}
+
+// originPattern is a parsed entry of CORSConfig.AllowedOrigins
+type originPattern struct {
+	any      bool
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+}
+
+func parseOriginPattern(s string) (originPattern, bool) {
+	s = strings.TrimSpace(s)
+	if s == "*" {
+		return originPattern{any: true}, true
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return originPattern{}, false
+	}
+
+	p := originPattern{
+		scheme: strings.ToLower(u.Scheme),
+		host:   strings.ToLower(u.Hostname()),
+		port:   originPort(u),
+	}
+	if rest, ok := strings.CutPrefix(p.host, "*."); ok {
+		p.host = rest
+		p.wildcard = true
+	}
+	return p, true
+}
+
+func (p originPattern) matches(origin *url.URL) bool {
+	if p.any {
+		return true
+	}
+	if strings.ToLower(origin.Scheme) != p.scheme || originPort(origin) != p.port {
+		return false
+	}
+
+	host := strings.ToLower(origin.Hostname())
+	if p.wildcard {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// originPort returns the port of an origin, filling in the scheme's default so that
+// "https://example.com:443" and "https://example.com" are the same origin
+func originPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// corsMiddleware adds CORS headers for requests coming from one of the allowed origins
+// and answers preflight requests. Credentials are never allowed for origins that only
+// match "*", even if the config was not validated.
+func corsMiddleware(mux *http.ServeMux, config CORSConfig, logger *slog.Logger) http.Handler {
+	var patterns []originPattern
+	for _, o := range config.AllowedOrigins {
+		p, ok := parseOriginPattern(o)
+		if !ok {
+			logger.Warn("Ignoring invalid CORS origin", "origin", o)
+			continue
+		}
+		patterns = append(patterns, p)
+	}
+
+	// match reports whether origin is allowed and whether it matched an entry other than "*"
+	match := func(origin string) (allowed, listed bool) {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return false, false
+		}
+		for _, p := range patterns {
+			if p.matches(u) {
+				allowed = true
+				if !p.any {
+					return true, true
+				}
+			}
+		}
+		return allowed, false
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// TODO: Add a diff env variable for known frontend hosts
-		w.Header().Set("Access-Control-Allow-Origin", "http://"+frontendHost+":"+frontendPort) // TODO: Support HTTPS
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Max-Age", "3600")
-
-		// Handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// The response depends on the Origin header, so caches must key on it
+		w.Header().Add("Vary", "Origin")
+
+		if origin == "" {
+			mux.ServeHTTP(w, r)
 			return
 		}
 
-		// Continue with the next handler
-		next.ServeHTTP(w, r)
+		allowed, listed := match(origin)
+		if !allowed {
+			if preflight {
+				logger.Warn("Rejected CORS preflight from disallowed origin", "origin", origin, "path", r.URL.Path)
+				writeError(w, r, http.StatusForbidden, CodeOriginNotAllowed, "Origin not allowed")
+				return
+			}
+			// Without CORS headers the browser will refuse to expose the response
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if config.AllowCredentials && listed {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// Only answer preflights for routes that exist with the requested method
+		if !routeExists(mux, r, r.Header.Get("Access-Control-Request-Method")) {
+			logger.Debug("Rejected CORS preflight for unknown route", "origin", origin, "path", r.URL.Path)
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "No such endpoint")
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+		w.WriteHeader(http.StatusNoContent)
 	})
 }
+
+// routeExists reports whether an API route is registered for the path and method.
+// Anything outside /api/ is served by the SPA handler and therefore always exists.
+func routeExists(mux *http.ServeMux, r *http.Request, method string) bool {
+	probe := r.Clone(r.Context())
+	probe.Method = strings.ToUpper(method)
+
+	_, pattern := mux.Handler(probe)
+	if pattern == "" {
+		return false
+	}
+	if strings.HasPrefix(r.URL.Path, "/api/") && pattern == "/" {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+func handleUploadDocument(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received upload document request", "method", r.Method, "url", r.URL.String())
+
+			file, header, ok := parseUpload(w, r, jobAppSvc, logger)
+			if !ok {
+				return
+			}
+			defer r.MultipartForm.RemoveAll()
+			defer file.Close()
+
+			d, created, err := jobAppSvc.AddDocument(r.FormValue("name"), r.FormValue("kind"), header.Filename, file)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to store document")
+				return
+			}
+
+			w.Header().Set("Location", fmt.Sprintf("/api/documents/%d", d.ID))
+			status := http.StatusOK
+			if created {
+				status = http.StatusCreated
+			}
+			writeJSON(w, r, logger, status, d)
+		})
+}
+
+func handleGetDocuments(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get documents request", "method", r.Method, "url", r.URL.String())
+
+			documents, err := jobAppSvc.GetDocuments(r.URL.Query().Get("name"))
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get documents")
+				return
+			}
+
+			writeCacheableJSON(w, r, logger, documents, "")
+		})
+}
+
+func handleGetDocumentByID(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get document by ID request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			d, err := jobAppSvc.GetDocumentByID(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get document")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, d)
+		})
+}
+
+func handleDownloadDocument(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received download document request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			d, f, err := jobAppSvc.OpenDocument(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to open document")
+				return
+			}
+			defer f.Close()
+
+			serveFile(w, r, d.Filename, d.ContentType, d.SHA256, f)
+		})
+}
+
+func handleDeleteDocument(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received delete document request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			if err := jobAppSvc.DeleteDocument(id); err != nil {
+				writeServiceError(w, r, logger, err, "Failed to delete document")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
+
+func handleGetApplicationDocuments(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get application documents request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			documents, err := jobAppSvc.GetApplicationDocuments(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get application documents")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, documents)
+		})
+}
+
+// linkDocumentRequest is the body of a request linking a document version to an application
+type linkDocumentRequest struct {
+	DocumentID int64 `json:"document_id"`
+}
+
+func handleLinkDocument(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received link document request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			var req linkDocumentRequest
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&req); err != nil || req.DocumentID <= 0 {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Request body must contain a positive document_id")
+				return
+			}
+
+			d, err := jobAppSvc.LinkDocument(id, req.DocumentID)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to link document")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, d)
+		})
+}
+
+func handleUnlinkDocument(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received unlink document request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+			documentID, ok := parsePathID(w, r, "documentID")
+			if !ok {
+				return
+			}
+
+			if err := jobAppSvc.UnlinkDocument(id, documentID); err != nil {
+				writeServiceError(w, r, logger, err, "Failed to unlink document")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
+
+func handleGetDocumentReport(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received document report request", "method", r.Method, "url", r.URL.String())
+
+			report, err := jobAppSvc.GetDocumentReport(r.URL.Query().Get("kind"))
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to build document report")
+				return
+			}
+
+			writeCacheableJSON(w, r, logger, report, "")
+		})
+}
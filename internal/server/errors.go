@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+// Error codes returned in the "code" field of an error response
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeInvalidID            = "invalid_id"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeValidationFailed     = "validation_failed"
+	CodeOriginNotAllowed     = "origin_not_allowed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeInternal             = "internal_error"
+)
+
+// ErrorResponse is the envelope used for every API error
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code      string               `json:"code"`
+	Message   string               `json:"message"`
+	Details   []service.FieldError `json:"details,omitempty"`
+	RequestID string               `json:"request_id,omitempty"`
+}
+
+// writeError writes an error envelope with the given status, code and message
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeErrorBody(w, status, ErrorBody{
+		Code:      code,
+		Message:   message,
+		RequestID: requestIDFromContext(r.Context()),
+	})
+}
+
+// writeServiceError maps an error returned by the service layer to a status code and
+// error envelope. message is used for unexpected errors, which are reported as 500s.
+func writeServiceError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, err error, message string) {
+	status, body := serviceErrorBody(err, message)
+	body.RequestID = requestIDFromContext(r.Context())
+
+	if status >= http.StatusInternalServerError {
+		logger.Error(message, "error", err, "requestID", body.RequestID)
+	} else {
+		logger.Debug(message, "error", err, "status", status, "requestID", body.RequestID)
+	}
+	writeErrorBody(w, status, body)
+}
+
+// serviceErrorBody returns the status code and error body for an error from the service layer
+func serviceErrorBody(err error, message string) (int, ErrorBody) {
+	var validationErr *service.ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		return http.StatusUnprocessableEntity, ErrorBody{Code: CodeValidationFailed, Message: "Validation failed", Details: validationErr.Fields}
+	case errors.Is(err, service.ErrInvalidInput):
+		return http.StatusBadRequest, ErrorBody{Code: CodeInvalidRequest, Message: err.Error()}
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound, ErrorBody{Code: CodeNotFound, Message: err.Error()}
+	case errors.Is(err, service.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed, ErrorBody{Code: CodePreconditionFailed, Message: err.Error()}
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict, ErrorBody{Code: CodeConflict, Message: err.Error()}
+	case errors.Is(err, service.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge, ErrorBody{Code: CodePayloadTooLarge, Message: err.Error()}
+	case errors.Is(err, service.ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType, ErrorBody{Code: CodeUnsupportedMediaType, Message: err.Error()}
+	default:
+		return http.StatusInternalServerError, ErrorBody{Code: CodeInternal, Message: message}
+	}
+}
+
+func writeErrorBody(w http.ResponseWriter, status int, body ErrorBody) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{Error: body})
+}
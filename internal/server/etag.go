@@ -0,0 +1,123 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+// applicationETag returns the strong ETag of an application, derived from its ID and version
+func applicationETag(app service.JobApplication) string {
+	return fmt.Sprintf(`"%d-%d"`, app.ID, app.Version)
+}
+
+// contentETag returns a strong ETag derived from a response body
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// parseETags splits an If-Match or If-None-Match header into its entity tags.
+// Weak tags keep their W/ prefix.
+func parseETags(header string) []string {
+	var tags []string
+	for _, t := range strings.Split(header, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// noneMatch reports whether the If-None-Match header allows a full response for etag.
+// Comparison is weak, as RFC 9110 requires for If-None-Match.
+func noneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return true
+	}
+	for _, t := range parseETags(header) {
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return false
+		}
+	}
+	return true
+}
+
+// ifMatchVersions returns the application versions listed in the If-Match header.
+// any is true when the header is absent or "*". A header that lists no usable strong ETag for
+// this application yields an empty, non-nil slice which can never match.
+func ifMatchVersions(r *http.Request, id int64) (versions []int64, any bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return nil, true
+	}
+
+	versions = []int64{}
+	prefix := `"` + strconv.FormatInt(id, 10) + "-"
+	for _, t := range parseETags(header) {
+		// If-Match requires strong comparison, so weak tags never match
+		if !strings.HasPrefix(t, prefix) || !strings.HasSuffix(t, `"`) {
+			continue
+		}
+		v, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(t, prefix), `"`), 10, 64)
+		if err == nil && v > 0 {
+			versions = append(versions, v)
+		}
+	}
+	return versions, false
+}
+
+// expectedVersion resolves the If-Match header to the single version a write must match,
+// 0 when any version is acceptable. When several ETags are listed the current version is
+// looked up and used if it is one of them. It writes a 412 response and returns false when
+// the precondition cannot be met.
+func expectedVersion(w http.ResponseWriter, r *http.Request, jobAppSvc *service.JobApplicationService, id int64) (int64, bool) {
+	versions, any := ifMatchVersions(r, id)
+	switch {
+	case any:
+		return 0, true
+	case len(versions) == 1:
+		return versions[0], true
+	case len(versions) > 1:
+		current, err := jobAppSvc.GetJobApplicationByID(id)
+		if err == nil && slices.Contains(versions, current.Version) {
+			return current.Version, true
+		}
+	}
+
+	writeError(w, r, http.StatusPreconditionFailed, CodePreconditionFailed, "If-Match does not match the current version")
+	return 0, false
+}
+
+// writeCacheableJSON writes v with a 200 status and the given ETag, or one derived from the
+// body when etag is empty, answering 304 Not Modified when If-None-Match already matches
+func writeCacheableJSON(w http.ResponseWriter, r *http.Request, logger *slog.Logger, v any, etag string) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("Failed to marshal response", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode response")
+		return
+	}
+
+	if etag == "" {
+		etag = contentETag(body)
+	}
+	w.Header().Set("ETag", etag)
+	if !noneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+const (
+	// eventHeartbeatInterval keeps idle streams from being closed by proxies
+	eventHeartbeatInterval = 25 * time.Second
+	// eventWriteTimeout limits how long writing to a stream may take, so streams of clients
+	// that went away are noticed
+	eventWriteTimeout = 10 * time.Second
+	// eventRetry is how long clients wait before reconnecting, in milliseconds
+	eventRetry = 3000
+)
+
+// EventReset is sent when the events a client missed are not known anymore, so it has to
+// reload what it shows
+const EventReset = "reset"
+
+// handleEvents streams the changes of applications as Server-Sent Events. Clients resume with
+// the Last-Event-ID header, which EventSource sends when it reconnects, or the last_event_id
+// query parameter.
+func handleEvents(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received events request", "method", r.Method, "url", r.URL.String())
+
+			lastEventID := r.Header.Get("Last-Event-ID")
+			if lastEventID == "" {
+				lastEventID = r.URL.Query().Get("last_event_id")
+			}
+
+			// The stream outlives the server's write timeout, every write gets its own deadline instead
+			rc := http.NewResponseController(w)
+			if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+				logger.Error("Failed to clear write deadline for event stream", "error", err)
+				writeError(w, r, http.StatusInternalServerError, CodeInternal, "Streaming is not supported")
+				return
+			}
+
+			sub := jobAppSvc.SubscribeEvents(lastEventID)
+			defer sub.Close()
+
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			// Keeps nginx from buffering the stream
+			w.Header().Set("X-Accel-Buffering", "no")
+			w.WriteHeader(http.StatusOK)
+
+			send := func(format string, args ...any) bool {
+				rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+				if _, err := fmt.Fprintf(w, format, args...); err != nil {
+					return false
+				}
+				return rc.Flush() == nil
+			}
+			sendEvent := func(e service.StreamEvent) bool {
+				data, err := json.Marshal(e.Event)
+				if err != nil {
+					logger.Error("Failed to encode event", "error", err)
+					return true
+				}
+				return send("id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			}
+
+			if !send("retry: %d\n\n", eventRetry) {
+				return
+			}
+			if !sub.Resumed {
+				if !send("event: %s\ndata: {}\n\n", EventReset) {
+					return
+				}
+			}
+			for _, e := range sub.Missed {
+				if !sendEvent(e) {
+					return
+				}
+			}
+
+			heartbeat := time.NewTicker(eventHeartbeatInterval)
+			defer heartbeat.Stop()
+			for {
+				select {
+				case <-r.Context().Done():
+					return
+				case e, ok := <-sub.Events:
+					if !ok {
+						return
+					}
+					if !sendEvent(e) {
+						return
+					}
+				case <-heartbeat.C:
+					if !send(": heartbeat\n\n") {
+						return
+					}
+				}
+			}
+		})
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+func handleGetGoals(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get goals request", "method", r.Method, "url", r.URL.String())
+
+			goals, err := jobAppSvc.GetGoals()
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get goals")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, goals)
+		})
+}
+
+func handleSetGoal(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received set goal request", "method", r.Method, "url", r.URL.String())
+
+			var req struct {
+				WeeklyTarget int `json:"weekly_target"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&req); err != nil {
+				logger.Debug("Failed to decode request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+				return
+			}
+
+			goal, err := jobAppSvc.SetGoal(r.PathValue("metric"), req.WeeklyTarget)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to set goal")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, goal)
+		})
+}
+
+func handleDeleteGoal(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received delete goal request", "method", r.Method, "url", r.URL.String())
+
+			if err := jobAppSvc.DeleteGoal(r.PathValue("metric")); err != nil {
+				writeServiceError(w, r, logger, err, "Failed to delete goal")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
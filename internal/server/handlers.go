@@ -3,15 +3,19 @@ package server
 import (
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log/slog"
+	"mime"
 	"net/http"
 	"path"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/rafrdz/ctrl-alt-me/internal/jsonpatch"
 	"github.com/rafrdz/ctrl-alt-me/internal/service"
 )
 
@@ -23,6 +27,38 @@ func handlePing(logger *slog.Logger) http.Handler {
 		})
 }
 
+// maxJSONBodySize limits the size of JSON request bodies
+const maxJSONBodySize = 1 << 20
+
+// writeJSON marshals v and writes it with the given status code
+func writeJSON(w http.ResponseWriter, r *http.Request, logger *slog.Logger, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		logger.Error("Failed to marshal response", "error", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode response")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// parseID reads the {id} path value, writing a 400 response if it is not a positive integer
+func parseID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	return parsePathID(w, r, "id")
+}
+
+// parsePathID reads a numeric path value, writing a 400 response if it is not a positive integer
+func parsePathID(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue(name), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidID, "ID must be a positive integer")
+		return 0, false
+	}
+	return id, true
+}
+
 func handleCreateJobApplication(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
@@ -30,115 +66,163 @@ func handleCreateJobApplication(jobAppSvc *service.JobApplicationService, logger
 
 			var na service.NewJobApplication
 
-			err := json.NewDecoder(r.Body).Decode(&na)
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&na)
 			if err != nil {
-				logger.Error("Failed to decode request body", "error", err)
-				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				logger.Debug("Failed to decode request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
 				return
 			}
 
-			a, err := jobAppSvc.CreateJobApplication(na)
+			a, err := jobAppSvc.WithActor(actor(r)).CreateJobApplication(na)
 			if err != nil {
-				logger.Error("Failed to create job application", "error", err)
-				http.Error(w, "Failed to create job application", http.StatusInternalServerError)
+				writeServiceError(w, r, logger, err, "Failed to create job application")
 				return
 			}
 
-			aJSON, err := json.Marshal(a)
+			w.Header().Set("ETag", applicationETag(a))
+			w.Header().Set("Location", fmt.Sprintf("/api/job-applications/%d", a.ID))
+			writeJSON(w, r, logger, http.StatusCreated, a)
+		})
+}
+
+func handleGetJobApplications(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get applications request", "method", r.Method, "url", r.URL.String())
+
+			apps, err := jobAppSvc.GetJobApplications(listOptions(r))
 			if err != nil {
-				logger.Error("Failed to marshal job application", "error", err)
-				http.Error(w, "Failed to create job application", http.StatusInternalServerError)
+				writeServiceError(w, r, logger, err, "Failed to get job applications")
 				return
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusCreated)
-			w.Write(aJSON)
+			writeCacheableJSON(w, r, logger, apps, "")
 		})
 }
 
-func handleGetJobApplications(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+// listOptions reads the list filters from the query string. Tags may be given as repeated
+// ?tag= parameters or as one comma-separated list.
+func listOptions(r *http.Request) service.ListOptions {
+	query := r.URL.Query()
+	var tags []string
+	for _, t := range query["tag"] {
+		tags = append(tags, service.SplitTags(t)...)
+	}
+	return service.ListOptions{
+		Archived: query.Get("archived"),
+		Tags:     tags,
+		TagMatch: query.Get("tag_match"),
+	}
+}
+
+func handleGetJobApplicationByID(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger.Debug("Received get applications request", "method", r.Method, "url", r.URL.String())
+			logger.Debug("Received get application by ID request", "method", r.Method, "url", r.URL.String())
 
-			apps, err := jobAppSvc.GetJobApplications()
-			if err != nil {
-				logger.Error("Failed to get job applications", "error", err)
-				http.Error(w, "Failed to get job applications", http.StatusInternalServerError)
+			id, ok := parseID(w, r)
+			if !ok {
 				return
 			}
 
-			appsJSON, err := json.Marshal(apps)
+			a, err := jobAppSvc.GetJobApplicationByID(id)
 			if err != nil {
-				logger.Error("Failed to marshal job applications", "error", err)
-				http.Error(w, "Failed to get job applications", http.StatusInternalServerError)
+				writeServiceError(w, r, logger, err, "Failed to get job application")
 				return
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write(appsJSON)
+			writeCacheableJSON(w, r, logger, a, applicationETag(a))
 		})
 }
 
-func handleGetJobApplicationByID(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+func handleUpdateJobApplication(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger.Debug("Received get application by ID request", "method", r.Method, "url", r.URL.String())
+			logger.Debug("Received update application request", "method", r.Method, "url", r.URL.String())
 
-			id := r.PathValue("id")
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
 
-			a, err := jobAppSvc.GetJobApplicationByID(id)
+			version, ok := expectedVersion(w, r, jobAppSvc, id)
+			if !ok {
+				return
+			}
+
+			var app service.NewJobApplication
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&app)
 			if err != nil {
-				logger.Error("Failed to get job application", "error", err)
-				http.Error(w, "Failed to get job application", http.StatusInternalServerError)
+				logger.Debug("Failed to decode request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
 				return
 			}
 
-			aJSON, err := json.Marshal(a)
+			updatedApp, err := jobAppSvc.WithActor(actor(r)).UpdateJobApplication(id, version, app)
 			if err != nil {
-				logger.Error("Failed to marshal job application", "error", err)
-				http.Error(w, "Failed to get job application", http.StatusInternalServerError)
+				writeServiceError(w, r, logger, err, "Failed to update job application")
 				return
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write(aJSON)
+			w.Header().Set("ETag", applicationETag(updatedApp))
+			writeJSON(w, r, logger, http.StatusOK, updatedApp)
 		})
 }
 
-func handleUpdateJobApplication(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+// handlePatchJobApplication applies a JSON Merge Patch (application/merge-patch+json, also
+// assumed for plain application/json) or a JSON Patch (application/json-patch+json)
+func handlePatchJobApplication(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
-			logger.Debug("Received update application request", "method", r.Method, "url", r.URL.String(), "body", r.Body)
+			logger.Debug("Received patch application request", "method", r.Method, "url", r.URL.String(), "contentType", r.Header.Get("Content-Type"))
 
-			var app service.JobApplication
-			err := json.NewDecoder(r.Body).Decode(&app)
-			if err != nil {
-				logger.Error("Failed to decode request body", "error", err)
-				http.Error(w, "Invalid request body", http.StatusBadRequest)
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			version, ok := expectedVersion(w, r, jobAppSvc, id)
+			if !ok {
 				return
 			}
 
-			updatedApp, err := jobAppSvc.UpdateJobApplication(app)
+			var apply func(doc, patch []byte) ([]byte, error)
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			switch mediaType {
+			case "application/merge-patch+json", "application/json", "":
+				apply = jsonpatch.MergePatch
+			case "application/json-patch+json":
+				apply = jsonpatch.Apply
+			default:
+				w.Header().Set("Accept-Patch", "application/merge-patch+json, application/json-patch+json")
+				writeError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Unsupported patch format "+mediaType)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodySize))
 			if err != nil {
-				logger.Error("Failed to update job application", "error", err)
-				http.Error(w, "Failed to update job application", http.StatusInternalServerError)
+				logger.Debug("Failed to read request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
 				return
 			}
 
-			updatedAppJSON, err := json.Marshal(updatedApp)
+			updatedApp, err := jobAppSvc.WithActor(actor(r)).PatchJobApplication(id, version, func(doc []byte) ([]byte, error) {
+				patched, err := apply(doc, body)
+				switch {
+				case errors.Is(err, jsonpatch.ErrTestFailed):
+					return nil, fmt.Errorf("%w: %v", service.ErrConflict, err)
+				case err != nil:
+					return nil, fmt.Errorf("%w: %v", service.ErrInvalidInput, err)
+				}
+				return patched, nil
+			})
 			if err != nil {
-				logger.Error("Failed to marshal updated job application", "error", err)
-				http.Error(w, "Failed to update job application", http.StatusInternalServerError)
+				writeServiceError(w, r, logger, err, "Failed to patch job application")
 				return
 			}
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			w.Write(updatedAppJSON)
+			w.Header().Set("ETag", applicationETag(updatedApp))
+			writeJSON(w, r, logger, http.StatusOK, updatedApp)
 		})
 }
 
@@ -147,15 +231,22 @@ func handleDeleteJobApplication(jobAppSvc *service.JobApplicationService, logger
 		func(w http.ResponseWriter, r *http.Request) {
 			logger.Debug("Received delete application request", "method", r.Method, "url", r.URL.String())
 
-			id := r.PathValue("id")
-			err := jobAppSvc.DeleteJobApplication(id)
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			version, ok := expectedVersion(w, r, jobAppSvc, id)
+			if !ok {
+				return
+			}
+
+			err := jobAppSvc.WithActor(actor(r)).DeleteJobApplication(id, version)
 			if err != nil {
-				logger.Error("Failed to delete job application", "error", err)
-				http.Error(w, "Failed to delete job application", http.StatusInternalServerError)
+				writeServiceError(w, r, logger, err, "Failed to delete job application")
 				return
 			}
 
-			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusNoContent)
 		})
 }
@@ -167,24 +258,26 @@ func handleCSVUpload(jobAppSvc *service.JobApplicationService, logger *slog.Logg
 
 			err := r.ParseMultipartForm(10 << 20) // 10 MB limit
 			if err != nil {
-				logger.Error("Failed to parse multipart form", "error", err)
-				http.Error(w, "Failed to parse multipart form", http.StatusBadRequest)
+				logger.Debug("Failed to parse multipart form", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to parse multipart form")
 				return
 			}
 
 			file, _, err := r.FormFile("file")
 			if err != nil {
-				logger.Error("Failed to get file from form", "error", err)
-				http.Error(w, "Failed to get file from form", http.StatusBadRequest)
+				logger.Debug("Failed to get file from form", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to get file from form")
 				return
 			}
 			defer file.Close()
 
 			reader := csv.NewReader(file)
+			// Trailing columns are optional, the importer validates each row
+			reader.FieldsPerRecord = -1
 			records, err := reader.ReadAll()
 			if err != nil {
-				logger.Error("Failed to read CSV records", "error", err)
-				http.Error(w, "Failed to read CSV records", http.StatusBadRequest)
+				logger.Debug("Failed to read CSV records", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to read CSV records: "+err.Error())
 				return
 			}
 
@@ -196,22 +289,47 @@ func handleCSVUpload(jobAppSvc *service.JobApplicationService, logger *slog.Logg
 				}
 			}
 
-			applications, err := jobAppSvc.ImportJobApplicationsFromCSV(records)
+			applications, err := jobAppSvc.WithActor(actor(r)).ImportJobApplicationsFromCSV(records)
 			if err != nil {
-				logger.Error("Failed to import job applications", "error", err)
-				http.Error(w, "Failed to import job applications: "+err.Error(), http.StatusInternalServerError)
+				writeServiceError(w, r, logger, err, "Failed to import job applications")
 				return
 			}
 
 			logger.Info("CSV records processed successfully", "count", len(applications))
 
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
 			response := map[string]interface{}{
 				"message":  "CSV file uploaded successfully",
 				"imported": len(applications),
 			}
-			json.NewEncoder(w).Encode(response)
+			writeJSON(w, r, logger, http.StatusOK, response)
+		})
+}
+
+// handleCSVExport writes the listed applications in the format accepted by the CSV import,
+// honouring the same filters as the list endpoint
+func handleCSVExport(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received CSV export request", "method", r.Method, "url", r.URL.String())
+
+			apps, err := jobAppSvc.GetJobApplications(listOptions(r))
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to export job applications")
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="job-applications.csv"`)
+
+			writer := csv.NewWriter(w)
+			writer.Write([]string{"date", "company", "position", "link", "status", "notes", "tags"})
+			for _, a := range apps {
+				writer.Write([]string{a.CreatedAt, a.Company, a.Position, a.Link, a.Status, a.Notes, strings.Join(a.Tags, ";")})
+			}
+			writer.Flush()
+			if err := writer.Error(); err != nil {
+				logger.Error("Failed to write CSV export", "error", err)
+			}
 		})
 }
 
@@ -237,7 +355,7 @@ func handleSPA(staticFS fs.FS, logger *slog.Logger) http.Handler {
 				indexFile, indexErr := staticFS.Open("index.html")
 				if indexErr != nil {
 					logger.Error("Failed to open index.html", "error", indexErr)
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					writeError(w, r, http.StatusInternalServerError, CodeInternal, "Internal Server Error")
 					return
 				}
 				defer indexFile.Close()
@@ -248,7 +366,7 @@ func handleSPA(staticFS fs.FS, logger *slog.Logger) http.Handler {
 			}
 
 			logger.Debug("File not found", "path", r.URL.Path, "error", err)
-			http.NotFound(w, r)
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "No such endpoint")
 			return
 		}
 		defer file.Close()
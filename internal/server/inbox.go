@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/inbox"
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+func handleGetInboundMessages(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get inbound messages request", "method", r.Method, "url", r.URL.String())
+
+			limit := 0
+			if v := r.URL.Query().Get("limit"); v != "" {
+				var err error
+				if limit, err = strconv.Atoi(v); err != nil {
+					writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "limit must be an integer")
+					return
+				}
+			}
+
+			messages, err := jobAppSvc.GetInboundMessages(r.URL.Query().Get("state"), limit)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get inbound messages")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, messages)
+		})
+}
+
+// handleIngestEmail files an email posted as the raw message, for mail that is piped in
+// instead of read from the inbox
+func handleIngestEmail(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received ingest email request", "method", r.Method, "url", r.URL.String())
+
+			raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, jobAppSvc.MaxAttachmentSize()))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+						fmt.Sprintf("Emails may be at most %d bytes", jobAppSvc.MaxAttachmentSize()))
+					return
+				}
+				logger.Debug("Failed to read request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Failed to read request body")
+				return
+			}
+
+			email, err := inbox.Parse(raw)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to read email")
+				return
+			}
+			msg, created, err := jobAppSvc.IngestEmail(email)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to file email")
+				return
+			}
+
+			status := http.StatusOK
+			if created {
+				status = http.StatusCreated
+			}
+			writeJSON(w, r, logger, status, msg)
+		})
+}
+
+func handleGetInboundMessage(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get inbound message request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			msg, err := jobAppSvc.GetInboundMessage(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get inbound message")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, msg)
+		})
+}
+
+// handleApplyInboundMessage applies the status change a message suggests. The body is optional
+// and may name another application or status.
+func handleApplyInboundMessage(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received apply inbound message request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+			var in service.ApplyInboundInput
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&in)
+			if err != nil && !errors.Is(err, io.EOF) {
+				logger.Debug("Failed to decode request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+				return
+			}
+
+			msg, err := jobAppSvc.WithActor(actor(r)).ApplyInboundMessage(id, in)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to apply inbound message")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, msg)
+		})
+}
+
+func handleDismissInboundMessage(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received dismiss inbound message request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			msg, err := jobAppSvc.DismissInboundMessage(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to dismiss inbound message")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, msg)
+		})
+}
+
+func handleGetInboxRules(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get inbox rules request", "method", r.Method, "url", r.URL.String())
+
+			rules, err := jobAppSvc.GetInboxRules()
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get inbox rules")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, rules)
+		})
+}
+
+// handleSetInboxRules replaces the inbox rules with the list in the body, in the order given
+func handleSetInboxRules(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received set inbox rules request", "method", r.Method, "url", r.URL.String())
+
+			var in []service.InboxRuleInput
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&in); err != nil {
+				logger.Debug("Failed to decode request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+				return
+			}
+
+			rules, err := jobAppSvc.SetInboxRules(in)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to set inbox rules")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, rules)
+		})
+}
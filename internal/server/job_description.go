@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+// queryVersion parses an optional job description version from the query string, 0 if absent
+func queryVersion(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, name+" must be a non-negative integer")
+		return 0, false
+	}
+	return n, true
+}
+
+// accepts reports whether the client listed mediaType in its Accept header
+func accepts(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if t, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && t == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// writeText writes a plain text response of the given media type
+func writeText(w http.ResponseWriter, mediaType, text string) {
+	w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write([]byte(text))
+}
+
+// handleGetJobDescription serves the current job description of an application, or the version
+// given by the version query parameter. Clients accepting text/markdown get the Markdown alone.
+func handleGetJobDescription(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get job description request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+			version, ok := queryVersion(w, r, "version")
+			if !ok {
+				return
+			}
+
+			d, err := jobAppSvc.GetJobDescription(id, version)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get job description")
+				return
+			}
+
+			if accepts(r, "text/markdown") {
+				writeText(w, "text/markdown", d.Markdown)
+				return
+			}
+			writeJSON(w, r, logger, http.StatusOK, d)
+		})
+}
+
+// handleSetJobDescription stores a new version of an application's job description. The body
+// is either a JSON object with text or html, or the description itself sent as text/html,
+// text/markdown or text/plain.
+func handleSetJobDescription(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received set job description request", "method", r.Method, "url", r.URL.String(), "contentType", r.Header.Get("Content-Type"))
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxJSONBodySize))
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					writeError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Job description is too large")
+					return
+				}
+				logger.Debug("Failed to read request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+				return
+			}
+
+			var in service.JobDescriptionInput
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			switch mediaType {
+			case "application/json", "":
+				if err := json.Unmarshal(body, &in); err != nil {
+					logger.Debug("Failed to decode request body", "error", err)
+					writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+					return
+				}
+			case "text/html":
+				in.HTML = string(body)
+			case "text/markdown", "text/plain":
+				in.Text = string(body)
+			default:
+				writeError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "Unsupported job description format "+mediaType)
+				return
+			}
+
+			d, created, err := jobAppSvc.SetJobDescription(id, in)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to store job description")
+				return
+			}
+
+			status := http.StatusOK
+			if created {
+				status = http.StatusCreated
+			}
+			writeJSON(w, r, logger, status, d)
+		})
+}
+
+func handleGetJobDescriptionVersions(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get job description versions request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			versions, err := jobAppSvc.GetJobDescriptionVersions(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get job description versions")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, versions)
+		})
+}
+
+// handleDiffJobDescription compares two versions of a job description, by default the current
+// one with its predecessor. Clients accepting text/x-diff get the unified diff alone.
+func handleDiffJobDescription(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received diff job description request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+			from, ok := queryVersion(w, r, "from")
+			if !ok {
+				return
+			}
+			to, ok := queryVersion(w, r, "to")
+			if !ok {
+				return
+			}
+
+			d, err := jobAppSvc.DiffJobDescription(id, from, to)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to diff job description")
+				return
+			}
+
+			if accepts(r, "text/x-diff") {
+				writeText(w, "text/x-diff", d.Unified)
+				return
+			}
+			writeJSON(w, r, logger, http.StatusOK, d)
+		})
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// NewRedirectHandler returns a handler that redirects every plain HTTP request to the
+// same host and path on the HTTPS port
+func NewRedirectHandler(httpsPort string, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		logger.Debug("Redirecting to HTTPS", "from", r.URL.String(), "to", target)
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/pdf"
+	"github.com/rafrdz/ctrl-alt-me/internal/report"
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+// reportColumnWeights are the relative widths of the activity report columns
+var reportColumnWeights = map[string]float64{
+	service.ReportColumnDate:          2,
+	service.ReportColumnCompany:       3,
+	service.ReportColumnPosition:      3.5,
+	service.ReportColumnContactMethod: 2.6,
+	service.ReportColumnStatus:        1.5,
+	service.ReportColumnLink:          4,
+}
+
+var paperSizes = map[string]pdf.Size{
+	"a4":     pdf.A4,
+	"letter": pdf.Letter,
+}
+
+// reportFormat picks the format of the activity report from the format query parameter or
+// the Accept header, HTML by default
+func reportFormat(r *http.Request) (string, bool) {
+	if format := strings.ToLower(r.URL.Query().Get("format")); format != "" {
+		return format, format == "html" || format == "pdf" || format == "json"
+	}
+	switch {
+	case accepts(r, "application/pdf"):
+		return "pdf", true
+	case accepts(r, "application/json"):
+		return "json", true
+	}
+	return "html", true
+}
+
+func applicationCount(n int) string {
+	if n == 1 {
+		return "1 application"
+	}
+	return fmt.Sprintf("%d applications", n)
+}
+
+// activityDocument lays out an activity report for printing
+func activityDocument(rep service.JobSearchReport) report.Document {
+	doc := report.Document{
+		Title:    rep.Title,
+		Subtitle: fmt.Sprintf("%s to %s · %s · generated %s", rep.From, rep.To, applicationCount(len(rep.Entries)), rep.Generated),
+		Header:   rep.Header,
+		Footer:   rep.Footer,
+		Empty:    "No applications were made in this period.",
+	}
+	for _, c := range rep.Columns {
+		doc.Columns = append(doc.Columns, report.Column{Label: c.Label, Weight: reportColumnWeights[c.Key]})
+	}
+	for _, e := range rep.Entries {
+		row := make([]string, len(rep.Columns))
+		for i, c := range rep.Columns {
+			row[i] = e.Value(c.Key)
+		}
+		doc.Rows = append(doc.Rows, row)
+	}
+	return doc
+}
+
+// handleGetActivityReport serves the printable job search activity report. from and to select
+// the period, template the report template, format is html, pdf or json and paper the PDF page
+// size.
+func handleGetActivityReport(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received activity report request", "method", r.Method, "url", r.URL.String())
+
+			format, ok := reportFormat(r)
+			if !ok {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "format must be html, pdf or json")
+				return
+			}
+			paper := strings.ToLower(r.URL.Query().Get("paper"))
+			if paper == "" {
+				paper = "a4"
+			}
+			size, ok := paperSizes[paper]
+			if !ok {
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "paper must be a4 or letter")
+				return
+			}
+
+			rep, err := jobAppSvc.GetJobSearchReport(dateRange(r), r.URL.Query().Get("template"))
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to build activity report")
+				return
+			}
+			if format == "json" {
+				writeJSON(w, r, logger, http.StatusOK, rep)
+				return
+			}
+
+			doc := activityDocument(rep)
+			var body []byte
+			contentType := "text/html; charset=utf-8"
+			if format == "html" {
+				body, err = doc.HTML()
+			} else {
+				contentType = "application/pdf"
+				body, err = doc.PDF(size)
+			}
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to render activity report")
+				return
+			}
+
+			filename := fmt.Sprintf("job-search-activity-%s-to-%s.%s", rep.From, rep.To, format)
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Write(body)
+		})
+}
+
+func handleGetReportTemplates(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get report templates request", "method", r.Method, "url", r.URL.String())
+
+			templates, err := jobAppSvc.GetReportTemplates()
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get report templates")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, templates)
+		})
+}
+
+func handleGetReportTemplate(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get report template request", "method", r.Method, "url", r.URL.String())
+
+			t, err := jobAppSvc.GetReportTemplate(r.PathValue("name"))
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get report template")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, t)
+		})
+}
+
+func handleSetReportTemplate(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received set report template request", "method", r.Method, "url", r.URL.String())
+
+			var req service.ReportTemplateInput
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&req); err != nil {
+				logger.Debug("Failed to decode request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+				return
+			}
+
+			t, err := jobAppSvc.SetReportTemplate(r.PathValue("name"), req)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to save report template")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, t)
+		})
+}
+
+func handleDeleteReportTemplate(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received delete report template request", "method", r.Method, "url", r.URL.String())
+
+			if err := jobAppSvc.DeleteReportTemplate(r.PathValue("name")); err != nil {
+				writeServiceError(w, r, logger, err, "Failed to delete report template")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+func handleSearch(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received search request", "method", r.Method, "url", r.URL.String())
+
+			limit := 0
+			if s := r.URL.Query().Get("limit"); s != "" {
+				var err error
+				if limit, err = strconv.Atoi(s); err != nil {
+					writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "limit must be an integer")
+					return
+				}
+			}
+
+			results, err := jobAppSvc.Search(r.URL.Query().Get("q"), limit)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to search")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, results)
+		})
+}
+
+func handleGetAttachmentText(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get attachment text request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+			attachmentID, ok := parsePathID(w, r, "attachmentID")
+			if !ok {
+				return
+			}
+
+			text, err := jobAppSvc.GetAttachmentText(id, attachmentID)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get attachment text")
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Write([]byte(text))
+		})
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/rafrdz/ctrl-alt-me/internal/service"
 )
 
-func NewHTTPHandler(appService *service.JobApplicationService, logger *slog.Logger, frontendHost, frontendPort string) http.Handler {
+func NewHTTPHandler(appService *service.JobApplicationService, logger *slog.Logger, cors CORSConfig) http.Handler {
 	mux := http.NewServeMux()
 
 	// API routes
@@ -16,14 +16,79 @@ func NewHTTPHandler(appService *service.JobApplicationService, logger *slog.Logg
 	mux.Handle("POST /api/job-applications", handleCreateJobApplication(appService, logger))
 	mux.Handle("GET /api/job-applications/{id}", handleGetJobApplicationByID(appService, logger))
 	mux.Handle("GET /api/job-applications", handleGetJobApplications(appService, logger))
-	mux.Handle("PUT /api/job-applications", handleUpdateJobApplication(appService, logger))
+	mux.Handle("PUT /api/job-applications/{id}", handleUpdateJobApplication(appService, logger))
+	mux.Handle("PATCH /api/job-applications/{id}", handlePatchJobApplication(appService, logger))
 	mux.Handle("DELETE /api/job-applications/{id}", handleDeleteJobApplication(appService, logger))
 	mux.Handle("POST /api/job-applications/import", handleCSVUpload(appService, logger))
+	mux.Handle("GET /api/job-applications/export", handleCSVExport(appService, logger))
+	mux.Handle("POST /api/job-applications/bulk", handleBulkJobApplications(appService, logger))
+	mux.Handle("POST /api/job-applications/{id}/archive", handleArchiveJobApplication(appService, logger, true))
+	mux.Handle("POST /api/job-applications/{id}/unarchive", handleArchiveJobApplication(appService, logger, false))
+	mux.Handle("GET /api/job-applications/{id}/history", handleGetJobApplicationHistory(appService, logger))
+	mux.Handle("GET /api/job-applications/{id}/job-description", handleGetJobDescription(appService, logger))
+	mux.Handle("PUT /api/job-applications/{id}/job-description", handleSetJobDescription(appService, logger))
+	mux.Handle("GET /api/job-applications/{id}/job-description/versions", handleGetJobDescriptionVersions(appService, logger))
+	mux.Handle("GET /api/job-applications/{id}/job-description/diff", handleDiffJobDescription(appService, logger))
+	mux.Handle("POST /api/job-applications/{id}/attachments", handleUploadAttachment(appService, logger))
+	mux.Handle("GET /api/job-applications/{id}/attachments", handleGetAttachments(appService, logger))
+	mux.Handle("GET /api/job-applications/{id}/attachments/{attachmentID}", handleDownloadAttachment(appService, logger))
+	mux.Handle("DELETE /api/job-applications/{id}/attachments/{attachmentID}", handleDeleteAttachment(appService, logger))
+	mux.Handle("GET /api/job-applications/{id}/attachments/{attachmentID}/text", handleGetAttachmentText(appService, logger))
+	mux.Handle("GET /api/job-applications/{id}/documents", handleGetApplicationDocuments(appService, logger))
+	mux.Handle("POST /api/job-applications/{id}/documents", handleLinkDocument(appService, logger))
+	mux.Handle("DELETE /api/job-applications/{id}/documents/{documentID}", handleUnlinkDocument(appService, logger))
+	mux.Handle("GET /api/documents", handleGetDocuments(appService, logger))
+	mux.Handle("POST /api/documents", handleUploadDocument(appService, logger))
+	mux.Handle("GET /api/documents/{id}", handleGetDocumentByID(appService, logger))
+	mux.Handle("GET /api/documents/{id}/content", handleDownloadDocument(appService, logger))
+	mux.Handle("DELETE /api/documents/{id}", handleDeleteDocument(appService, logger))
+	mux.Handle("GET /api/reports/documents", handleGetDocumentReport(appService, logger))
+	mux.Handle("GET /api/reports/activity", handleGetActivityReport(appService, logger))
+	mux.Handle("GET /api/reports/templates", handleGetReportTemplates(appService, logger))
+	mux.Handle("GET /api/reports/templates/{name}", handleGetReportTemplate(appService, logger))
+	mux.Handle("PUT /api/reports/templates/{name}", handleSetReportTemplate(appService, logger))
+	mux.Handle("DELETE /api/reports/templates/{name}", handleDeleteReportTemplate(appService, logger))
+	mux.Handle("GET /api/stats/funnel", handleGetFunnel(appService, logger))
+	mux.Handle("GET /api/stats/response-times", handleGetResponseTimes(appService, logger))
+	mux.Handle("GET /api/stats/time-in-stage", handleGetTimeInStage(appService, logger))
+	mux.Handle("GET /api/stats/ghosted", handleGetGhosted(appService, logger))
+	mux.Handle("GET /api/stats/activity", handleGetActivity(appService, logger))
+	mux.Handle("GET /api/charts/{chart}", handleGetChart(appService, logger))
+	mux.Handle("GET /api/goals", handleGetGoals(appService, logger))
+	mux.Handle("PUT /api/goals/{metric}", handleSetGoal(appService, logger))
+	mux.Handle("DELETE /api/goals/{metric}", handleDeleteGoal(appService, logger))
+	mux.Handle("GET /api/webhooks", handleGetWebhooks(appService, logger))
+	mux.Handle("POST /api/webhooks", handleCreateWebhook(appService, logger))
+	mux.Handle("GET /api/webhooks/{id}", handleGetWebhook(appService, logger))
+	mux.Handle("PUT /api/webhooks/{id}", handleUpdateWebhook(appService, logger))
+	mux.Handle("DELETE /api/webhooks/{id}", handleDeleteWebhook(appService, logger))
+	mux.Handle("GET /api/webhooks/{id}/deliveries", handleGetWebhookDeliveries(appService, logger))
+	mux.Handle("POST /api/webhooks/{id}/test", handleTestWebhook(appService, logger))
+	mux.Handle("GET /api/inbox", handleGetInboundMessages(appService, logger))
+	mux.Handle("POST /api/inbox", handleIngestEmail(appService, logger))
+	mux.Handle("GET /api/inbox/rules", handleGetInboxRules(appService, logger))
+	mux.Handle("PUT /api/inbox/rules", handleSetInboxRules(appService, logger))
+	mux.Handle("GET /api/inbox/{id}", handleGetInboundMessage(appService, logger))
+	mux.Handle("POST /api/inbox/{id}/apply", handleApplyInboundMessage(appService, logger))
+	mux.Handle("POST /api/inbox/{id}/dismiss", handleDismissInboundMessage(appService, logger))
+	mux.Handle("GET /api/events", handleEvents(appService, logger))
+	mux.Handle("GET /api/search", handleSearch(appService, logger))
+	mux.Handle("GET /api/tags", handleGetTags(appService, logger))
+	mux.Handle("POST /api/tags", handleCreateTag(appService, logger))
+	mux.Handle("GET /api/tags/{id}", handleGetTagByID(appService, logger))
+	mux.Handle("PUT /api/tags/{id}", handleUpdateTag(appService, logger))
+	mux.Handle("DELETE /api/tags/{id}", handleDeleteTag(appService, logger))
+	mux.Handle("POST /api/undo", handleRevert(appService, logger, true))
+	mux.Handle("POST /api/redo", handleRevert(appService, logger, false))
+	mux.Handle("GET /api/trash", handleGetTrash(appService, logger))
+	mux.Handle("DELETE /api/trash", handleEmptyTrash(appService, logger))
+	mux.Handle("POST /api/trash/{id}/restore", handleRestoreJobApplication(appService, logger))
+	mux.Handle("DELETE /api/trash/{id}", handlePurgeJobApplication(appService, logger))
 
 	// Serve static files and handle SPA routing
 	staticFiles := frontend.StaticFiles()
 	mux.Handle("/", handleSPA(staticFiles, logger))
 
-	// Wrap the mux with CORS middleware
-	return corsMiddleware(mux, frontendHost, frontendPort)
+	// Wrap the mux with CORS middleware, tagging every request with an ID first
+	return requestIDMiddleware(corsMiddleware(mux, cors, logger))
 }
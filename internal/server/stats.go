@@ -0,0 +1,100 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+// dateRange reads the from and to query parameters
+func dateRange(r *http.Request) service.DateRange {
+	return service.DateRange{From: r.URL.Query().Get("from"), To: r.URL.Query().Get("to")}
+}
+
+func handleGetFunnel(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get funnel request", "method", r.Method, "url", r.URL.String())
+
+			report, err := jobAppSvc.GetFunnel(dateRange(r), r.URL.Query().Get("group_by"))
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to compute funnel")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, report)
+		})
+}
+
+func handleGetResponseTimes(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get response times request", "method", r.Method, "url", r.URL.String())
+
+			report, err := jobAppSvc.GetResponseTimes(dateRange(r))
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to compute response times")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, report)
+		})
+}
+
+func handleGetTimeInStage(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get time in stage request", "method", r.Method, "url", r.URL.String())
+
+			stages, err := jobAppSvc.GetTimeInStage(dateRange(r))
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to compute time in stage")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, stages)
+		})
+}
+
+// handleGetGhosted lists open applications without any change for the number of days given
+// by the days query parameter
+func handleGetGhosted(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get ghosted applications request", "method", r.Method, "url", r.URL.String())
+
+			days := 0
+			if v := r.URL.Query().Get("days"); v != "" {
+				var err error
+				if days, err = strconv.Atoi(v); err != nil {
+					writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "days must be an integer")
+					return
+				}
+			}
+
+			apps, err := jobAppSvc.GetGhostedApplications(days)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get ghosted applications")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, apps)
+		})
+}
+
+func handleGetActivity(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get activity request", "method", r.Method, "url", r.URL.String())
+
+			report, err := jobAppSvc.GetActivity(dateRange(r))
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to compute activity")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, report)
+		})
+}
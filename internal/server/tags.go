@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+func handleGetTags(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get tags request", "method", r.Method, "url", r.URL.String())
+
+			tags, err := jobAppSvc.GetTags()
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get tags")
+				return
+			}
+
+			writeCacheableJSON(w, r, logger, tags, "")
+		})
+}
+
+func handleGetTagByID(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get tag by ID request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			tag, err := jobAppSvc.GetTagByID(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get tag")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, tag)
+		})
+}
+
+func handleCreateTag(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received create tag request", "method", r.Method, "url", r.URL.String())
+
+			var nt service.NewTag
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&nt); err != nil {
+				logger.Debug("Failed to decode request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+				return
+			}
+
+			tag, err := jobAppSvc.CreateTag(nt)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to create tag")
+				return
+			}
+
+			w.Header().Set("Location", fmt.Sprintf("/api/tags/%d", tag.ID))
+			writeJSON(w, r, logger, http.StatusCreated, tag)
+		})
+}
+
+func handleUpdateTag(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received update tag request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			var nt service.NewTag
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&nt); err != nil {
+				logger.Debug("Failed to decode request body", "error", err)
+				writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+				return
+			}
+
+			tag, err := jobAppSvc.UpdateTag(id, nt)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to update tag")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, tag)
+		})
+}
+
+func handleDeleteTag(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received delete tag request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			if err := jobAppSvc.DeleteTag(id); err != nil {
+				writeServiceError(w, r, logger, err, "Failed to delete tag")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
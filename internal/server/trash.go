@@ -0,0 +1,111 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+func handleArchiveJobApplication(jobAppSvc *service.JobApplicationService, logger *slog.Logger, archive bool) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received archive application request", "method", r.Method, "url", r.URL.String(), "archive", archive)
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			version, ok := expectedVersion(w, r, jobAppSvc, id)
+			if !ok {
+				return
+			}
+
+			var app service.JobApplication
+			var err error
+			if archive {
+				app, err = jobAppSvc.WithActor(actor(r)).ArchiveJobApplication(id, version)
+			} else {
+				app, err = jobAppSvc.WithActor(actor(r)).UnarchiveJobApplication(id, version)
+			}
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to archive job application")
+				return
+			}
+
+			w.Header().Set("ETag", applicationETag(app))
+			writeJSON(w, r, logger, http.StatusOK, app)
+		})
+}
+
+func handleGetTrash(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get trash request", "method", r.Method, "url", r.URL.String())
+
+			apps, err := jobAppSvc.GetTrash()
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get trash")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, apps)
+		})
+}
+
+func handleRestoreJobApplication(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received restore application request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			app, err := jobAppSvc.WithActor(actor(r)).RestoreJobApplication(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to restore job application")
+				return
+			}
+
+			w.Header().Set("ETag", applicationETag(app))
+			writeJSON(w, r, logger, http.StatusOK, app)
+		})
+}
+
+func handlePurgeJobApplication(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received purge application request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			if err := jobAppSvc.PurgeJobApplication(id); err != nil {
+				writeServiceError(w, r, logger, err, "Failed to purge job application")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
+
+func handleEmptyTrash(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received empty trash request", "method", r.Method, "url", r.URL.String())
+
+			n, err := jobAppSvc.EmptyTrash()
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to empty trash")
+				return
+			}
+
+			logger.Info("Trash emptied", "count", n)
+			writeJSON(w, r, logger, http.StatusOK, map[string]int64{"purged": n})
+		})
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+const clientIDHeader = "X-Client-ID"
+
+// actor identifies the caller for change history and undo/redo. Clients should send a stable
+// X-Client-ID (e.g. one per browser), otherwise changes are attributed to the remote address.
+func actor(r *http.Request) string {
+	if id := r.Header.Get(clientIDHeader); id != "" && len(id) <= 128 {
+		return id
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type revertResponse struct {
+	Changes []service.Change `json:"changes"`
+}
+
+// handleRevert serves POST /api/undo and POST /api/redo. The optional steps query parameter
+// sets how many mutations to revert (default 1).
+func handleRevert(jobAppSvc *service.JobApplicationService, logger *slog.Logger, undo bool) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received revert request", "method", r.Method, "url", r.URL.String(), "undo", undo)
+
+			steps := 1
+			if v := r.URL.Query().Get("steps"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "steps must be an integer")
+					return
+				}
+				steps = n
+			}
+
+			svc := jobAppSvc.WithActor(actor(r))
+			var changes []service.Change
+			var err error
+			if undo {
+				changes, err = svc.Undo(steps)
+			} else {
+				changes, err = svc.Redo(steps)
+			}
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to revert changes")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, revertResponse{Changes: changes})
+		})
+}
+
+func handleGetJobApplicationHistory(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received application history request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			changes, err := jobAppSvc.GetJobApplicationHistory(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get job application history")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, changes)
+		})
+}
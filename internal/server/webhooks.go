@@ -0,0 +1,175 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/service"
+)
+
+// decodeWebhook reads a webhook from the request body, writing a 400 response if it is malformed
+func decodeWebhook(w http.ResponseWriter, r *http.Request, logger *slog.Logger) (service.WebhookInput, bool) {
+	var in service.WebhookInput
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBodySize)).Decode(&in); err != nil {
+		logger.Debug("Failed to decode request body", "error", err)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "Invalid request body")
+		return in, false
+	}
+	return in, true
+}
+
+func handleGetWebhooks(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get webhooks request", "method", r.Method, "url", r.URL.String())
+
+			webhooks, err := jobAppSvc.GetWebhooks()
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get webhooks")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, webhooks)
+		})
+}
+
+func handleCreateWebhook(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received create webhook request", "method", r.Method, "url", r.URL.String())
+
+			in, ok := decodeWebhook(w, r, logger)
+			if !ok {
+				return
+			}
+
+			hook, err := jobAppSvc.CreateWebhook(in)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to create webhook")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusCreated, hook)
+		})
+}
+
+func handleGetWebhook(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get webhook request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			hook, err := jobAppSvc.GetWebhook(id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get webhook")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, hook)
+		})
+}
+
+func handleUpdateWebhook(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received update webhook request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+			in, ok := decodeWebhook(w, r, logger)
+			if !ok {
+				return
+			}
+
+			hook, err := jobAppSvc.UpdateWebhook(id, in)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to update webhook")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, hook)
+		})
+}
+
+func handleDeleteWebhook(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received delete webhook request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			if err := jobAppSvc.DeleteWebhook(id); err != nil {
+				writeServiceError(w, r, logger, err, "Failed to delete webhook")
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		})
+}
+
+func handleGetWebhookDeliveries(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received get webhook deliveries request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+			limit := 0
+			if v := r.URL.Query().Get("limit"); v != "" {
+				var err error
+				if limit, err = strconv.Atoi(v); err != nil {
+					writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "limit must be an integer")
+					return
+				}
+			}
+
+			deliveries, err := jobAppSvc.GetWebhookDeliveries(id, limit)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to get webhook deliveries")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, deliveries)
+		})
+}
+
+// handleTestWebhook sends a ping to a webhook and responds with the logged delivery, whether
+// it succeeded or not
+func handleTestWebhook(jobAppSvc *service.JobApplicationService, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			logger.Debug("Received test webhook request", "method", r.Method, "url", r.URL.String())
+
+			id, ok := parseID(w, r)
+			if !ok {
+				return
+			}
+
+			// The delivery may take longer than the server's write timeout allows
+			if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(service.WebhookTimeout + 5*time.Second)); err != nil {
+				logger.Debug("Failed to extend write deadline", "error", err)
+			}
+
+			delivery, err := jobAppSvc.TestWebhook(r.Context(), id)
+			if err != nil {
+				writeServiceError(w, r, logger, err, "Failed to test webhook")
+				return
+			}
+
+			writeJSON(w, r, logger, http.StatusOK, delivery)
+		})
+}
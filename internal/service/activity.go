@@ -0,0 +1,293 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// Activity metrics that can be counted and given a weekly goal
+const (
+	MetricApplications  = "applications"
+	MetricStatusChanges = "status_changes"
+	MetricInterviews    = "interviews"
+)
+
+// GoalMetrics lists every metric a goal can be set for
+var GoalMetrics = []string{MetricApplications, MetricStatusChanges, MetricInterviews}
+
+// Activity report limits
+const (
+	MaxWeeklyTarget = 1000
+	// DefaultActivityWeeks is how many weeks the report covers when no start date is given
+	DefaultActivityWeeks = 12
+	// MaxActivityDays limits the number of days a single report covers
+	MaxActivityDays = 731
+)
+
+// Goal is a weekly target for an activity metric
+type Goal struct {
+	Metric       string `json:"metric"`
+	WeeklyTarget int    `json:"weekly_target"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// ActivityCounts are the activity metrics of a day or week
+type ActivityCounts struct {
+	Applications  int `json:"applications"`
+	StatusChanges int `json:"status_changes"`
+	Interviews    int `json:"interviews"`
+}
+
+func (c ActivityCounts) get(metric string) int {
+	switch metric {
+	case MetricApplications:
+		return c.Applications
+	case MetricStatusChanges:
+		return c.StatusChanges
+	case MetricInterviews:
+		return c.Interviews
+	}
+	return 0
+}
+
+func (c *ActivityCounts) add(o ActivityCounts) {
+	c.Applications += o.Applications
+	c.StatusChanges += o.StatusChanges
+	c.Interviews += o.Interviews
+}
+
+// ActivityDay is the activity of one day (UTC)
+type ActivityDay struct {
+	Date string `json:"date"`
+	ActivityCounts
+}
+
+// GoalProgress compares a week's activity with a goal
+type GoalProgress struct {
+	Metric string `json:"metric"`
+	Target int    `json:"target"`
+	Actual int    `json:"actual"`
+	// Progress is Actual as a share of Target, above 1 when the goal was exceeded
+	Progress float64 `json:"progress"`
+	Met      bool    `json:"met"`
+}
+
+// ActivityWeek is the activity of a week starting on Monday, with the progress towards every goal
+type ActivityWeek struct {
+	WeekStart string `json:"week_start"`
+	ActivityCounts
+	Goals []GoalProgress `json:"goals"`
+}
+
+// Streak is a run of consecutive days or weeks
+type Streak struct {
+	// Current is the run that includes today or this week, or ended just before them
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+}
+
+// GoalStreak is the run of weeks in which a goal was met
+type GoalStreak struct {
+	Metric string `json:"metric"`
+	Streak
+}
+
+// ActivityReport is the activity of every day and week within a date range, with streaks
+// counted over the whole history
+type ActivityReport struct {
+	DateRange
+	Days  []ActivityDay  `json:"days"`
+	Weeks []ActivityWeek `json:"weeks"`
+	// ActiveDays is the run of days with at least one new application or status change
+	ActiveDays Streak `json:"active_days"`
+	// GoalWeeks is, for every goal, the run of weeks in which it was met
+	GoalWeeks []GoalStreak `json:"goal_weeks"`
+}
+
+func scanGoal(row scanner) (Goal, error) {
+	var g Goal
+	err := row.Scan(&g.Metric, &g.WeeklyTarget, &g.UpdatedAt)
+	return g, err
+}
+
+// GetGoals lists the weekly goals that are set
+func (s *JobApplicationService) GetGoals() ([]Goal, error) {
+	rows, err := s.db.Query(database.SelectGoalsStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []Goal{}
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, g)
+	}
+	return goals, rows.Err()
+}
+
+// SetGoal sets the weekly target of a metric, replacing any earlier one
+func (s *JobApplicationService) SetGoal(metric string, weeklyTarget int) (Goal, error) {
+	metric = strings.ToLower(strings.TrimSpace(metric))
+	var v validator
+	v.oneOf("metric", metric, GoalMetrics)
+	if weeklyTarget < 1 || weeklyTarget > MaxWeeklyTarget {
+		v.add("weekly_target", "must be between 1 and %d", MaxWeeklyTarget)
+	}
+	if err := v.err(); err != nil {
+		return Goal{}, err
+	}
+
+	if _, err := s.db.Exec(database.UpsertGoalStmt, metric, weeklyTarget); err != nil {
+		return Goal{}, translateDBError(err)
+	}
+	return scanGoal(s.db.QueryRow(database.SelectGoalStmt, metric))
+}
+
+// DeleteGoal removes the weekly goal of a metric
+func (s *JobApplicationService) DeleteGoal(metric string) error {
+	res, err := s.db.Exec(database.DeleteGoalStmt, strings.ToLower(strings.TrimSpace(metric)))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("no goal is set for %q: %w", metric, ErrNotFound)
+	}
+	return nil
+}
+
+// weekStart returns the Monday of the week t falls in
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return t.AddDate(0, 0, -offset)
+}
+
+// GetActivity reports the activity of every day and week within r, by default the last
+// DefaultActivityWeeks weeks up to today, and how it compares with the goals
+func (s *JobApplicationService) GetActivity(r DateRange) (ActivityReport, error) {
+	var v validator
+	r.normalize(&v)
+	if err := v.err(); err != nil {
+		return ActivityReport{}, err
+	}
+
+	today := time.Now().UTC().Truncate(day)
+	if r.To == "" {
+		r.To = today.Format(time.DateOnly)
+	}
+	to, _ := time.Parse(time.DateOnly, r.To)
+	if r.From == "" {
+		r.From = weekStart(to).AddDate(0, 0, -7*(DefaultActivityWeeks-1)).Format(time.DateOnly)
+	}
+	from, _ := time.Parse(time.DateOnly, r.From)
+	if from.After(to) {
+		v.add("from", "must not be after to")
+	} else if to.Sub(from) >= MaxActivityDays*day {
+		v.add("to", "must be less than %d days after from", MaxActivityDays)
+	}
+	if err := v.err(); err != nil {
+		return ActivityReport{}, err
+	}
+
+	goals, err := s.GetGoals()
+	if err != nil {
+		return ActivityReport{}, err
+	}
+
+	daily := map[string]ActivityCounts{}
+	weekly := map[string]ActivityCounts{}
+	var first time.Time
+	rows, err := s.db.Query(database.ActivityStmt)
+	if err != nil {
+		return ActivityReport{}, err
+	}
+	for rows.Next() {
+		var date sql.NullString
+		var c ActivityCounts
+		if err := rows.Scan(&date, &c.Applications, &c.StatusChanges, &c.Interviews); err != nil {
+			rows.Close()
+			return ActivityReport{}, err
+		}
+		t, err := time.Parse(time.DateOnly, date.String)
+		if err != nil {
+			// Rows with unparsable timestamps cannot be placed on the timeline
+			continue
+		}
+		if first.IsZero() {
+			first = t
+		}
+		daily[date.String] = c
+		w := weekly[weekStart(t).Format(time.DateOnly)]
+		w.add(c)
+		weekly[weekStart(t).Format(time.DateOnly)] = w
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return ActivityReport{}, err
+	}
+
+	report := ActivityReport{DateRange: r, Days: []ActivityDay{}, Weeks: []ActivityWeek{}, GoalWeeks: []GoalStreak{}}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		date := d.Format(time.DateOnly)
+		report.Days = append(report.Days, ActivityDay{Date: date, ActivityCounts: daily[date]})
+	}
+	for w := weekStart(from); !w.After(to); w = w.AddDate(0, 0, 7) {
+		week := ActivityWeek{WeekStart: w.Format(time.DateOnly), ActivityCounts: weekly[w.Format(time.DateOnly)], Goals: []GoalProgress{}}
+		for _, g := range goals {
+			actual := week.get(g.Metric)
+			week.Goals = append(week.Goals, GoalProgress{
+				Metric:   g.Metric,
+				Target:   g.WeeklyTarget,
+				Actual:   actual,
+				Progress: float64(actual) / float64(g.WeeklyTarget),
+				Met:      actual >= g.WeeklyTarget,
+			})
+		}
+		report.Weeks = append(report.Weeks, week)
+	}
+
+	if first.IsZero() {
+		first = today
+	}
+	report.ActiveDays = streak(first, today, 1, func(t time.Time) bool {
+		c := daily[t.Format(time.DateOnly)]
+		return c.Applications > 0 || c.StatusChanges > 0
+	})
+	for _, g := range goals {
+		report.GoalWeeks = append(report.GoalWeeks, GoalStreak{
+			Metric: g.Metric,
+			Streak: streak(weekStart(first), weekStart(today), 7, func(t time.Time) bool {
+				return weekly[t.Format(time.DateOnly)].get(g.Metric) >= g.WeeklyTarget
+			}),
+		})
+	}
+	return report, nil
+}
+
+// streak finds the runs of periods, stepDays long, from first to last for which hit holds. The
+// last period still being under way does not break the current run.
+func streak(first, last time.Time, stepDays int, hit func(time.Time) bool) Streak {
+	var s Streak
+	run := 0
+	for t := first; !t.After(last); t = t.AddDate(0, 0, stepDays) {
+		if hit(t) {
+			run++
+			s.Longest = max(s.Longest, run)
+		} else if !t.Equal(last) {
+			run = 0
+		}
+	}
+	s.Current = run
+	return s
+}
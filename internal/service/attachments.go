@@ -0,0 +1,347 @@
+package service
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+	"github.com/rafrdz/ctrl-alt-me/internal/storage"
+)
+
+// Attachment kinds
+const (
+	AttachmentResume         = "resume"
+	AttachmentCoverLetter    = "cover_letter"
+	AttachmentOffer          = "offer"
+	AttachmentJobDescription = "job_description"
+	AttachmentEmail          = "email"
+	AttachmentOther          = "other"
+)
+
+// AttachmentKinds lists the accepted attachment kinds
+var AttachmentKinds = []string{AttachmentResume, AttachmentCoverLetter, AttachmentOffer, AttachmentJobDescription, AttachmentEmail, AttachmentOther}
+
+// MaxFilenameLength limits the length of stored attachment file names
+const MaxFilenameLength = 255
+
+// DefaultMaxAttachmentSize is the upload limit unless configured otherwise
+const DefaultMaxAttachmentSize = 10 << 20
+
+// attachmentTypes maps accepted file extensions to the type attachments are served with and
+// the types content sniffing may report for them. Office documents are ZIP or OLE containers
+// which sniffing cannot tell apart from other archives, so the extension decides there.
+var attachmentTypes = map[string]struct {
+	contentType string
+	sniffed     []string
+}{
+	".pdf":  {"application/pdf", []string{"application/pdf"}},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document", []string{"application/zip"}},
+	".odt":  {"application/vnd.oasis.opendocument.text", []string{"application/zip"}},
+	".doc":  {"application/msword", []string{"application/octet-stream"}},
+	".rtf":  {"application/rtf", []string{"text/plain"}},
+	".txt":  {"text/plain; charset=utf-8", []string{"text/plain"}},
+	".md":   {"text/markdown; charset=utf-8", []string{"text/plain"}},
+	".html": {"text/html; charset=utf-8", []string{"text/html", "text/plain"}},
+	".htm":  {"text/html; charset=utf-8", []string{"text/html", "text/plain"}},
+	".eml":  {"message/rfc822", []string{"text/plain"}},
+	".png":  {"image/png", []string{"image/png"}},
+	".jpg":  {"image/jpeg", []string{"image/jpeg"}},
+	".jpeg": {"image/jpeg", []string{"image/jpeg"}},
+}
+
+type Attachment struct {
+	ID            int64  `json:"id"`
+	ApplicationID int64  `json:"application_id"`
+	Kind          string `json:"kind"`
+	Filename      string `json:"filename"`
+	ContentType   string `json:"content_type"`
+	Size          int64  `json:"size"`
+	SHA256        string `json:"sha256"`
+	CreatedAt     string `json:"created_at"`
+	// TextStatus tells whether the text of the attachment has been extracted for search
+	TextStatus string `json:"text_status"`
+}
+
+// SetAttachmentStore sets where attachment content is kept. Attachments are unavailable without one.
+func (s *JobApplicationService) SetAttachmentStore(store *storage.Store) {
+	s.files = store
+}
+
+// MaxAttachmentSize returns the largest accepted upload in bytes
+func (s *JobApplicationService) MaxAttachmentSize() int64 {
+	if s.files == nil {
+		return 0
+	}
+	return s.files.MaxSize()
+}
+
+func (s *JobApplicationService) attachmentStore() (*storage.Store, error) {
+	if s.files == nil {
+		return nil, errors.New("attachment storage is not configured")
+	}
+	return s.files, nil
+}
+
+func scanAttachment(row scanner) (Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.ID, &a.ApplicationID, &a.Kind, &a.Filename, &a.ContentType, &a.Size, &a.SHA256, &a.CreatedAt, &a.TextStatus)
+	return a, err
+}
+
+// cleanFilename strips directories and control characters from an uploaded file name
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// detectContentType checks that the sniffed content matches the file's extension and returns
+// the type to serve it with
+func detectContentType(head []byte, filename string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+
+	t, ok := attachmentTypes[ext]
+	if !ok {
+		return "", fmt.Errorf("%w: %q files are not accepted", ErrUnsupportedType, ext)
+	}
+	for _, candidate := range t.sniffed {
+		if sniffed == candidate {
+			return t.contentType, nil
+		}
+	}
+	return "", fmt.Errorf("%w: content of %s looks like %s", ErrUnsupportedType, filename, sniffed)
+}
+
+// storeUpload checks the type of an uploaded file, stores its content and passes the stored
+// blob to record while still holding the store's lock, so the blob cannot be swept before
+// record has saved a reference to it
+func storeUpload(store *storage.Store, filename string, r io.Reader, record func(blob storage.Blob, contentType string) error) error {
+	br := bufio.NewReaderSize(r, 512)
+	head, err := br.Peek(512)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	contentType, err := detectContentType(head, filename)
+	if err != nil {
+		return err
+	}
+
+	return store.Do(func() error {
+		blob, err := store.Put(br)
+		if errors.Is(err, storage.ErrTooLarge) {
+			return fmt.Errorf("%w: uploads may be at most %d bytes", ErrTooLarge, store.MaxSize())
+		}
+		if err != nil {
+			return err
+		}
+		return record(blob, contentType)
+	})
+}
+
+// releaseBlob removes stored content once no attachment or document refers to it. It must be
+// called from within store.Do.
+func (s *JobApplicationService) releaseBlob(store *storage.Store, hash string) error {
+	var remaining int
+	if err := s.db.QueryRow(database.CountBlobReferencesStmt, hash).Scan(&remaining); err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return nil
+	}
+	return store.Remove(hash)
+}
+
+// AddAttachment stores the content of r as an attachment of an application. Uploading a file
+// the application already has returns the existing attachment with created set to false.
+func (s *JobApplicationService) AddAttachment(appID int64, kind, filename string, r io.Reader) (attachment Attachment, created bool, err error) {
+	store, err := s.attachmentStore()
+	if err != nil {
+		return Attachment{}, false, err
+	}
+
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if kind == "" {
+		kind = AttachmentOther
+	}
+	filename = cleanFilename(filename)
+
+	var v validator
+	v.oneOf("kind", kind, AttachmentKinds)
+	if v.required("filename", filename) {
+		v.maxLength("filename", filename, MaxFilenameLength)
+	}
+	if err := v.err(); err != nil {
+		return Attachment{}, false, err
+	}
+
+	if _, err := getJobApplication(s.db, appID); err != nil {
+		return Attachment{}, false, err
+	}
+
+	err = storeUpload(store, filename, r, func(blob storage.Blob, contentType string) error {
+		attachment, created, err = insertAttachment(s.db, appID, kind, filename, contentType, blob)
+		return err
+	})
+	if err != nil {
+		return Attachment{}, false, err
+	}
+
+	if created {
+		s.logger.Info("Stored attachment", "application", appID, "attachment", attachment.ID, "size", attachment.Size, "contentType", attachment.ContentType)
+		s.wakeTextExtractor()
+	}
+	return attachment, created, nil
+}
+
+// insertAttachment records a stored blob as an attachment of an application, unless the
+// application already has the same content
+func insertAttachment(q querier, appID int64, kind, filename, contentType string, blob storage.Blob) (Attachment, bool, error) {
+	a, err := scanAttachment(q.QueryRow(database.SelectAttachmentByHashStmt, appID, blob.Hash))
+	if err == nil {
+		return a, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, false, err
+	}
+
+	res, err := q.Exec(database.InsertAttachmentStmt, appID, kind, filename, contentType, blob.Size, blob.Hash)
+	if err != nil {
+		return Attachment{}, false, translateDBError(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Attachment{}, false, err
+	}
+	a, err = scanAttachment(q.QueryRow(database.SelectAttachmentStmt, appID, id))
+	return a, err == nil, err
+}
+
+// GetAttachments lists the attachments of an application, oldest first
+func (s *JobApplicationService) GetAttachments(appID int64) ([]Attachment, error) {
+	if _, err := getJobApplication(s.db, appID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(database.SelectAttachmentsStmt, appID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []Attachment{}
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+func (s *JobApplicationService) GetAttachment(appID, id int64) (Attachment, error) {
+	if _, err := getJobApplication(s.db, appID); err != nil {
+		return Attachment{}, err
+	}
+
+	a, err := scanAttachment(s.db.QueryRow(database.SelectAttachmentStmt, appID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, notFound("attachment", id)
+	}
+	return a, err
+}
+
+// OpenAttachment returns an attachment with its content, which the caller must close
+func (s *JobApplicationService) OpenAttachment(appID, id int64) (Attachment, *os.File, error) {
+	store, err := s.attachmentStore()
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+
+	a, err := s.GetAttachment(appID, id)
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+
+	f, err := store.Open(a.SHA256)
+	if err != nil {
+		return Attachment{}, nil, fmt.Errorf("opening content of attachment %d: %w", id, err)
+	}
+	return a, f, nil
+}
+
+// DeleteAttachment removes an attachment, and its content once nothing else shares it
+func (s *JobApplicationService) DeleteAttachment(appID, id int64) error {
+	store, err := s.attachmentStore()
+	if err != nil {
+		return err
+	}
+
+	a, err := s.GetAttachment(appID, id)
+	if err != nil {
+		return err
+	}
+
+	return store.Do(func() error {
+		if _, err := s.db.Exec(database.DeleteAttachmentStmt, appID, id); err != nil {
+			return err
+		}
+		return s.releaseBlob(store, a.SHA256)
+	})
+}
+
+// sweepAttachments removes stored content no attachment or document refers to any more,
+// such as the files of purged applications
+func (s *JobApplicationService) sweepAttachments() {
+	if s.files == nil {
+		return
+	}
+
+	err := s.files.Do(func() error {
+		rows, err := s.db.Query(database.SelectBlobHashesStmt)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		inUse := map[string]bool{}
+		for rows.Next() {
+			var hash string
+			if err := rows.Scan(&hash); err != nil {
+				return err
+			}
+			inUse[hash] = true
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		n, err := s.files.Sweep(func(hash string) bool { return inUse[hash] })
+		if n > 0 {
+			s.logger.Info("Removed unreferenced attachment files", "count", n)
+		}
+		return err
+	})
+	if err != nil {
+		s.logger.Error("Failed to remove unreferenced attachment files", "error", err)
+	}
+}
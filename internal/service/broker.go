@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventBufferSize is how many recent events are kept for clients that reconnect
+const EventBufferSize = 1000
+
+// subscriberBuffer is how many events may wait for a slow subscriber before it is dropped. It
+// reconnects and catches up from the recent events.
+const subscriberBuffer = 64
+
+// StreamEvent is an event as it is streamed to clients
+type StreamEvent struct {
+	// ID is what a client resumes from. It is only valid while the server runs, after a
+	// restart the client has to reload instead.
+	ID string
+	Event
+}
+
+// broker hands the events of committed changes to everyone subscribed
+type broker struct {
+	mu sync.Mutex
+	// epoch tells the event IDs of this run apart from those of earlier ones
+	epoch       string
+	last        uint64
+	recent      []StreamEvent
+	subscribers map[chan StreamEvent]struct{}
+	closed      bool
+}
+
+func newBroker() *broker {
+	return &broker{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		subscribers: map[chan StreamEvent]struct{}{},
+	}
+}
+
+func (b *broker) id(seq uint64) string {
+	return fmt.Sprintf("%s-%d", b.epoch, seq)
+}
+
+// publish sends events to every subscriber
+func (b *broker) publish(events []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range events {
+		b.last++
+		se := StreamEvent{ID: b.id(b.last), Event: e}
+		b.recent = append(b.recent, se)
+		if len(b.recent) > EventBufferSize {
+			b.recent = b.recent[len(b.recent)-EventBufferSize:]
+		}
+		for ch := range b.subscribers {
+			select {
+			case ch <- se:
+			default:
+				delete(b.subscribers, ch)
+				close(ch)
+			}
+		}
+	}
+}
+
+// since returns the recent events after lastID, or false if they are not all kept anymore
+// or lastID is from an earlier run. It must be called with b.mu held.
+func (b *broker) since(lastID string) ([]StreamEvent, bool) {
+	epoch, seqText, ok := strings.Cut(lastID, "-")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if !ok || err != nil || epoch != b.epoch || seq > b.last {
+		return nil, false
+	}
+	missed := int(b.last - seq)
+	if missed > len(b.recent) {
+		return nil, false
+	}
+	return append([]StreamEvent(nil), b.recent[len(b.recent)-missed:]...), true
+}
+
+// Subscription delivers the events of committed changes
+type Subscription struct {
+	// Events receives every event, it is closed when the subscriber falls too far behind or
+	// the server shuts down
+	Events <-chan StreamEvent
+	// Missed lists the events after the ID the subscription resumed from
+	Missed []StreamEvent
+	// Resumed is false if lastEventID was given but the events after it are not all known,
+	// in which case the client has to reload what it shows
+	Resumed bool
+
+	ch chan StreamEvent
+	b  *broker
+}
+
+// Close ends the subscription
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	if _, ok := s.b.subscribers[s.ch]; ok {
+		delete(s.b.subscribers, s.ch)
+		close(s.ch)
+	}
+}
+
+// SubscribeEvents subscribes to the events of every change committed from now on. If
+// lastEventID is not empty the events after it are returned as well, as far as they are known.
+func (s *JobApplicationService) SubscribeEvents(lastEventID string) *Subscription {
+	b := s.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan StreamEvent, subscriberBuffer)
+	sub := &Subscription{Events: ch, Resumed: true, ch: ch, b: b}
+	if lastEventID != "" {
+		sub.Missed, sub.Resumed = b.since(lastEventID)
+	}
+	if b.closed {
+		close(ch)
+	} else {
+		b.subscribers[ch] = struct{}{}
+	}
+	return sub
+}
+
+// CloseEventStreams ends every subscription, so streams do not hold up shutting down
+func (s *JobApplicationService) CloseEventStreams() {
+	b := s.events
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
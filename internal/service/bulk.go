@@ -0,0 +1,178 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// Bulk operation types
+const (
+	BulkUpdateStatus = "update_status"
+	BulkDelete       = "delete"
+	BulkArchive      = "archive"
+	BulkAddTag       = "add_tag"
+	BulkRemoveTag    = "remove_tag"
+)
+
+// bulkOps lists the supported bulk operation types
+var bulkOps = []string{BulkUpdateStatus, BulkDelete, BulkArchive, BulkAddTag, BulkRemoveTag}
+
+// MaxBulkOperations caps the number of operations in one bulk request
+const MaxBulkOperations = 500
+
+// BulkOperation is a single change applied as part of a bulk request
+type BulkOperation struct {
+	Op     string `json:"op"`
+	ID     int64  `json:"id"`
+	Status string `json:"status,omitempty"`
+	Tag    string `json:"tag,omitempty"`
+	// Version optionally makes the operation conditional on the application's current version
+	Version int64 `json:"version,omitempty"`
+}
+
+// BulkResult reports the outcome of one BulkOperation. Err is nil on success.
+type BulkResult struct {
+	Index       int
+	Op          string
+	ID          int64
+	Application *JobApplication
+	Err         error
+	// Skipped is set for the operations of an atomic batch that were not tried because an
+	// earlier one failed
+	Skipped bool
+}
+
+// ApplyBulk applies ops in order inside a single transaction. When atomic is true any failing
+// operation rolls back the whole batch; otherwise each failing operation is rolled back on its
+// own and the rest are committed. The returned bool reports whether anything was committed.
+func (s *JobApplicationService) ApplyBulk(ops []BulkOperation, atomic bool) ([]BulkResult, bool, error) {
+	if err := validateBulk(ops); err != nil {
+		return nil, false, err
+	}
+
+	// The whole batch is undone as a single step
+	m, err := s.begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer m.Rollback()
+	m.grouped()
+
+	// Every operation is reported, including those an atomic batch never gets to
+	results := make([]BulkResult, len(ops))
+	for i, op := range ops {
+		results[i] = BulkResult{Index: i, Op: op.Op, ID: op.ID, Skipped: true}
+	}
+	failed := false
+	for i, op := range ops {
+		results[i].Skipped = false
+
+		// A savepoint per operation lets a failure be undone without losing the others
+		if _, err := m.Exec(`SAVEPOINT bulk_op`); err != nil {
+			return nil, false, err
+		}
+		queued, webhooksQueued := len(m.events), m.webhooksQueued
+		app, opErr := m.applyBulkOperation(op)
+		if opErr != nil {
+			failed = true
+			results[i].Err = opErr
+			if _, err := m.Exec(`ROLLBACK TO bulk_op`); err != nil {
+				return nil, false, err
+			}
+			// The operation's changes are gone, so are their events and webhook deliveries
+			m.events, m.webhooksQueued = m.events[:queued], webhooksQueued
+		} else {
+			results[i].Application = app
+		}
+		if _, err := m.Exec(`RELEASE bulk_op`); err != nil {
+			return nil, false, err
+		}
+
+		if opErr != nil && atomic {
+			s.logger.Info("Bulk operation failed, rolling back batch", "index", i, "op", op.Op, "id", op.ID, "error", opErr)
+			return results, false, nil
+		}
+	}
+
+	if err := m.Commit(); err != nil {
+		return nil, false, err
+	}
+	s.logger.Info("Bulk operations applied", "count", len(ops), "partialFailure", failed)
+	return results, true, nil
+}
+
+func validateBulk(ops []BulkOperation) error {
+	var v validator
+	if len(ops) == 0 {
+		v.add("operations", "must contain at least one operation")
+	}
+	if len(ops) > MaxBulkOperations {
+		v.add("operations", "must contain at most %d operations", MaxBulkOperations)
+	}
+	for i, op := range ops {
+		v.prefix = fmt.Sprintf("operations[%d].", i)
+		if op.ID <= 0 {
+			v.add("id", "must be a positive integer")
+		}
+		if !slices.Contains(bulkOps, op.Op) {
+			v.oneOf("op", op.Op, bulkOps)
+			continue
+		}
+		switch op.Op {
+		case BulkUpdateStatus:
+			v.oneOf("status", op.Status, ValidStatuses)
+		case BulkAddTag, BulkRemoveTag:
+			v.tag("tag", strings.TrimSpace(op.Tag))
+		}
+	}
+	return v.err()
+}
+
+// applyBulkOperation performs a single operation, returning the resulting application
+// (nil for deletes)
+func (m *mutation) applyBulkOperation(op BulkOperation) (*JobApplication, error) {
+	switch op.Op {
+	case BulkUpdateStatus, BulkAddTag, BulkRemoveTag:
+		current, err := getJobApplication(m, op.ID)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkVersion(current, op.Version); err != nil {
+			return nil, err
+		}
+
+		app := current.NewJobApplication
+		tag := strings.TrimSpace(op.Tag)
+		switch op.Op {
+		case BulkUpdateStatus:
+			app.Status = op.Status
+		case BulkAddTag:
+			app.Tags = normalizeTags(append(app.Tags, tag))
+		case BulkRemoveTag:
+			app.Tags = slices.DeleteFunc(app.Tags, func(t string) bool { return strings.EqualFold(t, tag) })
+		}
+		if err := app.Validate(); err != nil {
+			return nil, err
+		}
+
+		updated, err := m.update(op.ID, current.Version, app)
+		if err != nil {
+			return nil, err
+		}
+		return &updated, nil
+	case BulkDelete:
+		_, err := m.transition(database.SoftDeleteStmt, ActionDeleted, op.ID, op.Version)
+		return nil, err
+	case BulkArchive:
+		archived, err := m.transition(database.ArchiveStmt, ActionArchived, op.ID, op.Version)
+		if err != nil {
+			return nil, err
+		}
+		return &archived, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidInput, op.Op)
+	}
+}
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// Change actions
+const (
+	ActionCreated    = "created"
+	ActionUpdated    = "updated"
+	ActionDeleted    = "deleted"
+	ActionArchived   = "archived"
+	ActionUnarchived = "unarchived"
+	ActionRestored   = "restored"
+	ActionUndo       = "undo"
+	ActionRedo       = "redo"
+)
+
+// Change states. Applied and undone changes form an actor's undo and redo stacks,
+// discarded changes fell off the stack and log entries (undo/redo themselves) never join it.
+const (
+	ChangeApplied   = "applied"
+	ChangeUndone    = "undone"
+	ChangeDiscarded = "discarded"
+	ChangeLog       = "log"
+)
+
+// DefaultUndoDepth is how many changes per actor can be undone unless configured otherwise
+const DefaultUndoDepth = 50
+
+// MaxUndoSteps caps how many mutations a single undo or redo call may revert
+const MaxUndoSteps = 20
+
+// Change records one mutation of an application with its state before and after
+type Change struct {
+	ID            int64           `json:"id"`
+	ApplicationID int64           `json:"application_id"`
+	Action        string          `json:"action"`
+	Actor         string          `json:"actor"`
+	Group         string          `json:"group,omitempty"`
+	Before        *JobApplication `json:"before"`
+	After         *JobApplication `json:"after"`
+	State         string          `json:"state"`
+	CreatedAt     string          `json:"created_at"`
+
+	resultVersion int64
+}
+
+// WithActor returns a copy of the service that attributes its changes to actor, whose undo
+// and redo history is kept separately from everyone else's
+func (s *JobApplicationService) WithActor(actor string) *JobApplicationService {
+	c := *s
+	c.actor = actor
+	return &c
+}
+
+// SetUndoDepth sets how many changes per actor are kept available for undo
+func (s *JobApplicationService) SetUndoDepth(depth int) {
+	s.undoDepth = depth
+}
+
+// mutation is a write transaction that records every change it makes
+type mutation struct {
+	*sql.Tx
+	svc   *JobApplicationService
+	group string
+	// webhooksQueued is set once a change queued a webhook delivery
+	webhooksQueued bool
+	// events are published to connected clients once the mutation is committed
+	events []Event
+}
+
+func (s *JobApplicationService) begin() (*mutation, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &mutation{Tx: tx, svc: s}, nil
+}
+
+// Commit commits the transaction, wakes the webhook dispatcher if deliveries were queued and
+// publishes the events of the changes
+func (m *mutation) Commit() error {
+	if err := m.Tx.Commit(); err != nil {
+		return err
+	}
+	if m.webhooksQueued {
+		m.svc.wakeWebhookDispatcher()
+	}
+	if len(m.events) > 0 {
+		m.svc.events.publish(m.events)
+	}
+	return nil
+}
+
+// grouped makes every change recorded from now on part of one group, undone and redone together
+func (m *mutation) grouped() *mutation {
+	b := make([]byte, 8)
+	rand.Read(b)
+	m.group = hex.EncodeToString(b)
+	return m
+}
+
+// record stores a revertible change made by the mutation's actor
+func (m *mutation) record(action string, before, after *JobApplication) error {
+	if _, err := m.Exec(database.DiscardRedoStmt, m.svc.actor); err != nil {
+		return err
+	}
+	if err := m.insertChange(action, ChangeApplied, before, after); err != nil {
+		return err
+	}
+	_, err := m.Exec(database.TrimHistoryStmt, m.svc.actor, m.svc.actor, m.svc.undoDepth)
+	return err
+}
+
+func (m *mutation) insertChange(action, state string, before, after *JobApplication) error {
+	var appID, version int64
+	if after != nil {
+		appID, version = after.ID, after.Version
+	} else if before != nil {
+		appID = before.ID
+	}
+
+	beforeJSON, err := snapshotJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := snapshotJSON(after)
+	if err != nil {
+		return err
+	}
+
+	if _, err = m.Exec(database.InsertChangeStmt, appID, action, m.svc.actor, m.group, beforeJSON, afterJSON, state, version); err != nil {
+		return err
+	}
+	if e, ok := changeEvent(before, after); ok {
+		m.events = append(m.events, e)
+		return m.enqueueWebhooks(e)
+	}
+	return nil
+}
+
+func snapshotJSON(app *JobApplication) (sql.NullString, error) {
+	if app == nil {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(app)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+func scanChange(row scanner) (Change, error) {
+	var c Change
+	var before, after sql.NullString
+	err := row.Scan(&c.ID, &c.ApplicationID, &c.Action, &c.Actor, &c.Group, &before, &after, &c.State, &c.resultVersion, &c.CreatedAt)
+	if err != nil {
+		return Change{}, err
+	}
+	if before.Valid {
+		c.Before = &JobApplication{}
+		if err := json.Unmarshal([]byte(before.String), c.Before); err != nil {
+			return Change{}, err
+		}
+	}
+	if after.Valid {
+		c.After = &JobApplication{}
+		if err := json.Unmarshal([]byte(after.String), c.After); err != nil {
+			return Change{}, err
+		}
+	}
+	return c, nil
+}
+
+func queryChanges(q querier, query string, args ...any) ([]Change, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []Change{}
+	for rows.Next() {
+		c, err := scanChange(rows)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// GetJobApplicationHistory lists every recorded change of an application, oldest first
+func (s *JobApplicationService) GetJobApplicationHistory(id int64) ([]Change, error) {
+	if _, err := getAnyJobApplication(s.db, id); err != nil {
+		return nil, err
+	}
+	return queryChanges(s.db, database.SelectChangesByApplicationStmt, id)
+}
+
+// getAnyJobApplication reads an application whether or not it is in the trash
+func getAnyJobApplication(q querier, id int64) (JobApplication, error) {
+	return getOneJobApplication(q, database.SelectAnyByIDStmt, id)
+}
+
+// Undo reverts the actor's most recent mutations, up to steps of them. A mutation that touched
+// several applications at once (a bulk request or an import) counts as one step. If an affected
+// application changed since, nothing is reverted and ErrConflict is returned.
+func (s *JobApplicationService) Undo(steps int) ([]Change, error) {
+	return s.revert(steps, true)
+}
+
+// Redo reapplies mutations reverted by Undo, most recently undone first. Making a new change
+// clears the redo history.
+func (s *JobApplicationService) Redo(steps int) ([]Change, error) {
+	return s.revert(steps, false)
+}
+
+func (s *JobApplicationService) revert(steps int, undo bool) ([]Change, error) {
+	if steps < 1 || steps > MaxUndoSteps {
+		var v validator
+		v.add("steps", "must be between 1 and %d", MaxUndoSteps)
+		return nil, v.err()
+	}
+
+	from, to, action, next := ChangeApplied, ChangeUndone, ActionUndo, database.SelectLatestChangeByStateStmt
+	if !undo {
+		from, to, action, next = ChangeUndone, ChangeApplied, ActionRedo, database.SelectOldestChangeByStateStmt
+	}
+
+	m, err := s.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Rollback()
+
+	var reverted []Change
+	for range steps {
+		first, err := scanChange(m.QueryRow(next, s.actor, from))
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		group := []Change{first}
+		if first.Group != "" {
+			if group, err = queryChanges(m, database.SelectChangeGroupStmt, s.actor, from, first.Group); err != nil {
+				return nil, err
+			}
+		}
+		// Undo walks back from the newest change of the group, redo forwards from the oldest
+		if undo {
+			for i, j := 0, len(group)-1; i < j; i, j = i+1, j-1 {
+				group[i], group[j] = group[j], group[i]
+			}
+		}
+
+		for _, c := range group {
+			result, err := m.revertChange(c, undo)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := m.Exec(database.UpdateChangeStateStmt, to, result.Version, c.ID); err != nil {
+				return nil, err
+			}
+			if err := m.chainResultVersion(c, undo, result.Version); err != nil {
+				return nil, err
+			}
+			c.State = to
+			c.resultVersion = result.Version
+			reverted = append(reverted, c)
+			s.logger.Info("Reverted change", "action", action, "change", c.ID, "application", c.ApplicationID, "actor", s.actor)
+		}
+	}
+
+	if len(reverted) == 0 {
+		return nil, fmt.Errorf("%w: nothing to %s", ErrNotFound, action)
+	}
+	return reverted, m.Commit()
+}
+
+// revertChange writes the state before (undo) or after (redo) the change back to the
+// application and logs the write, returning the application's new state
+func (m *mutation) revertChange(c Change, undo bool) (JobApplication, error) {
+	current, err := getAnyJobApplication(m, c.ApplicationID)
+	if errors.Is(err, ErrNotFound) {
+		return JobApplication{}, fmt.Errorf("%w: job application %d has been purged", ErrConflict, c.ApplicationID)
+	}
+	if err != nil {
+		return JobApplication{}, err
+	}
+	if current.Version != c.resultVersion {
+		return JobApplication{}, fmt.Errorf("%w: job application %d changed since (version %d, expected %d)", ErrConflict, c.ApplicationID, current.Version, c.resultVersion)
+	}
+
+	var target JobApplication
+	action := ActionRedo
+	switch {
+	case !undo:
+		target = *c.After
+	case c.Before != nil:
+		target = *c.Before
+		action = ActionUndo
+	default:
+		// Undoing a creation moves the application to the trash rather than losing it
+		target = current
+		deletedAt := sqliteNow()
+		target.DeletedAt = &deletedAt
+		action = ActionUndo
+	}
+
+	_, err = m.Exec(database.RestoreStateStmt, target.Company, target.Position, target.Link, target.Status, target.Notes,
+		sqliteTime(target.ArchivedAt), sqliteTime(target.DeletedAt), c.ApplicationID, current.Version)
+	if err != nil {
+		return JobApplication{}, translateDBError(err)
+	}
+	if err := setTags(m, c.ApplicationID, normalizeTags(target.Tags)); err != nil {
+		return JobApplication{}, err
+	}
+
+	result, err := getAnyJobApplication(m, c.ApplicationID)
+	if err != nil {
+		return JobApplication{}, err
+	}
+	if err := m.insertChange(action, ChangeLog, &current, &result); err != nil {
+		return JobApplication{}, err
+	}
+	return result, nil
+}
+
+// chainResultVersion hands the version written by reverting c on to the change of the same
+// application that is reverted after it: the previous applied change for an undo, the next
+// undone one for a redo. That change then finds the application as it expects. It is left
+// alone when another change was made in between, which keeps that one from being overwritten.
+func (m *mutation) chainResultVersion(c Change, undo bool, version int64) error {
+	stmt, state := database.SelectPreviousChangeStmt, ChangeApplied
+	if !undo {
+		stmt, state = database.SelectNextChangeStmt, ChangeUndone
+	}
+	next, err := scanChange(m.QueryRow(stmt, m.svc.actor, c.ApplicationID, state, c.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	adjacent := false
+	if undo {
+		adjacent = c.Before != nil && next.After != nil && next.After.Version == c.Before.Version
+	} else {
+		adjacent = c.After != nil && next.Before != nil && next.Before.Version == c.After.Version
+	}
+	if !adjacent {
+		return nil
+	}
+	_, err = m.Exec(database.UpdateChangeResultVersionStmt, version, next.ID)
+	return err
+}
+
+// sqliteNow returns the current time in the format CURRENT_TIMESTAMP produces
+func sqliteNow() string {
+	return time.Now().UTC().Format(time.DateTime)
+}
+
+// sqliteTime converts a timestamp read back from the database into the format
+// CURRENT_TIMESTAMP produces, so stored values keep comparing correctly
+func sqliteTime(ts *string) *string {
+	if ts == nil {
+		return nil
+	}
+	t, ok := parseTimestamp(*ts)
+	if !ok {
+		return ts
+	}
+	formatted := t.UTC().Format(time.DateTime)
+	return &formatted
+}
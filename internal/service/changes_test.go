@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// newTestService returns a service backed by a fresh database in a temporary directory
+func newTestService(t *testing.T) *JobApplicationService {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db, err := database.InitDB("test.db", logger)
+	if err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewJobApplicationService(db, logger)
+}
+
+func mustCreate(t *testing.T, svc *JobApplicationService, app NewJobApplication) JobApplication {
+	t.Helper()
+	created, err := svc.CreateJobApplication(app)
+	if err != nil {
+		t.Fatalf("CreateJobApplication: %v", err)
+	}
+	return created
+}
+
+func mustSetStatus(t *testing.T, svc *JobApplicationService, app JobApplication, status string) JobApplication {
+	t.Helper()
+	in := app.NewJobApplication
+	in.Status = status
+	updated, err := svc.UpdateJobApplication(app.ID, app.Version, in)
+	if err != nil {
+		t.Fatalf("UpdateJobApplication(%s): %v", status, err)
+	}
+	return updated
+}
+
+func wantStatus(t *testing.T, svc *JobApplicationService, id int64, status string) {
+	t.Helper()
+	app, err := getAnyJobApplication(svc.db, id)
+	if err != nil {
+		t.Fatalf("get application %d: %v", id, err)
+	}
+	if app.Status != status {
+		t.Errorf("status = %q, want %q", app.Status, status)
+	}
+}
+
+func TestUndoRedoSeveralInARow(t *testing.T) {
+	svc := newTestService(t).WithActor("client-a")
+
+	app := mustCreate(t, svc, NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusApplied})
+	app = mustSetStatus(t, svc, app, StatusInterview)
+	mustSetStatus(t, svc, app, StatusOffer)
+
+	steps := []struct {
+		undo   bool
+		steps  int
+		status string
+	}{
+		{undo: true, steps: 1, status: StatusInterview},
+		{undo: true, steps: 1, status: StatusApplied},
+		{undo: false, steps: 1, status: StatusInterview},
+		{undo: false, steps: 1, status: StatusOffer},
+		{undo: true, steps: 2, status: StatusApplied},
+		{undo: false, steps: 2, status: StatusOffer},
+		{undo: true, steps: 1, status: StatusInterview},
+		{undo: false, steps: 1, status: StatusOffer},
+	}
+	for i, step := range steps {
+		var err error
+		if step.undo {
+			_, err = svc.Undo(step.steps)
+		} else {
+			_, err = svc.Redo(step.steps)
+		}
+		if err != nil {
+			t.Fatalf("step %d (undo=%v, steps=%d): %v", i, step.undo, step.steps, err)
+		}
+		wantStatus(t, svc, app.ID, step.status)
+	}
+
+	// Undoing every change, the creation included, moves the application to the trash
+	if _, err := svc.Undo(3); err != nil {
+		t.Fatalf("undo everything: %v", err)
+	}
+	trashed, err := getAnyJobApplication(svc.db, app.ID)
+	if err != nil {
+		t.Fatalf("get application: %v", err)
+	}
+	if trashed.DeletedAt == nil {
+		t.Error("undoing the creation did not move the application to the trash")
+	}
+	if _, err := svc.Undo(1); !errors.Is(err, ErrNotFound) {
+		t.Errorf("undo with empty history: error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestUndoSeveralApplications(t *testing.T) {
+	svc := newTestService(t).WithActor("client-a")
+
+	a := mustCreate(t, svc, NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusApplied})
+	b := mustCreate(t, svc, NewJobApplication{Company: "Globex", Position: "Engineer", Status: StatusApplied})
+	a = mustSetStatus(t, svc, a, StatusInterview)
+	b = mustSetStatus(t, svc, b, StatusRejected)
+	mustSetStatus(t, svc, a, StatusOffer)
+
+	if _, err := svc.Undo(3); err != nil {
+		t.Fatalf("Undo(3): %v", err)
+	}
+	wantStatus(t, svc, a.ID, StatusApplied)
+	wantStatus(t, svc, b.ID, StatusApplied)
+
+	if _, err := svc.Redo(3); err != nil {
+		t.Fatalf("Redo(3): %v", err)
+	}
+	wantStatus(t, svc, a.ID, StatusOffer)
+	wantStatus(t, svc, b.ID, StatusRejected)
+}
+
+func TestUndoConflictsWithOtherActor(t *testing.T) {
+	svc := newTestService(t)
+	mine, theirs := svc.WithActor("client-a"), svc.WithActor("client-b")
+
+	app := mustCreate(t, mine, NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusApplied})
+	app = mustSetStatus(t, mine, app, StatusInterview)
+	app = mustSetStatus(t, theirs, app, StatusOffer)
+	mustSetStatus(t, mine, app, StatusRejected)
+
+	// The latest change can be undone, the one before it would overwrite client-b's change
+	if _, err := mine.Undo(1); err != nil {
+		t.Fatalf("first undo: %v", err)
+	}
+	wantStatus(t, svc, app.ID, StatusOffer)
+	if _, err := mine.Undo(1); !errors.Is(err, ErrConflict) {
+		t.Fatalf("second undo: error = %v, want %v", err, ErrConflict)
+	}
+	wantStatus(t, svc, app.ID, StatusOffer)
+}
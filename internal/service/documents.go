@@ -0,0 +1,322 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+	"github.com/rafrdz/ctrl-alt-me/internal/storage"
+)
+
+// MaxDocumentNameLength limits the length of document names
+const MaxDocumentNameLength = 100
+
+// Document is one version of a reusable file in the document library, such as a resume variant
+type Document struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Version     int64  `json:"version"`
+	Kind        string `json:"kind"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	CreatedAt   string `json:"created_at"`
+	// Applications is the number of applications the document was sent with
+	Applications int `json:"applications"`
+}
+
+func scanDocument(row scanner) (Document, error) {
+	var d Document
+	err := row.Scan(&d.ID, &d.Name, &d.Version, &d.Kind, &d.Filename, &d.ContentType, &d.Size, &d.SHA256, &d.CreatedAt, &d.Applications)
+	return d, err
+}
+
+func queryDocuments(q querier, query string, args ...any) ([]Document, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := []Document{}
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		documents = append(documents, d)
+	}
+	return documents, rows.Err()
+}
+
+// AddDocument stores a file as the next version of the named document. Uploading the content
+// of an existing version again returns that version with created set to false.
+func (s *JobApplicationService) AddDocument(name, kind, filename string, r io.Reader) (document Document, created bool, err error) {
+	store, err := s.attachmentStore()
+	if err != nil {
+		return Document{}, false, err
+	}
+
+	name = strings.TrimSpace(name)
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if kind == "" {
+		kind = AttachmentResume
+	}
+	filename = cleanFilename(filename)
+
+	var v validator
+	if v.required("name", name) {
+		v.maxLength("name", name, MaxDocumentNameLength)
+	}
+	v.oneOf("kind", kind, AttachmentKinds)
+	if v.required("filename", filename) {
+		v.maxLength("filename", filename, MaxFilenameLength)
+	}
+	if err := v.err(); err != nil {
+		return Document{}, false, err
+	}
+
+	err = storeUpload(store, filename, r, func(blob storage.Blob, contentType string) error {
+		document, err = scanDocument(s.db.QueryRow(database.SelectDocumentByHashStmt, name, blob.Hash))
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		res, err := s.db.Exec(database.InsertDocumentStmt, name, kind, filename, contentType, blob.Size, blob.Hash)
+		if err != nil {
+			return translateDBError(err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		created = true
+		document, err = scanDocument(s.db.QueryRow(database.SelectDocumentByIDStmt, id))
+		return err
+	})
+	if err != nil {
+		return Document{}, false, err
+	}
+
+	if created {
+		s.logger.Info("Stored document", "document", document.ID, "name", document.Name, "version", document.Version)
+	}
+	return document, created, nil
+}
+
+// GetDocuments lists the document library, newest version first within each name. A non-empty
+// name lists only the versions of that document.
+func (s *JobApplicationService) GetDocuments(name string) ([]Document, error) {
+	if name = strings.TrimSpace(name); name != "" {
+		return queryDocuments(s.db, database.SelectDocumentsByNameStmt, name)
+	}
+	return queryDocuments(s.db, database.SelectDocumentsStmt)
+}
+
+func (s *JobApplicationService) GetDocumentByID(id int64) (Document, error) {
+	d, err := scanDocument(s.db.QueryRow(database.SelectDocumentByIDStmt, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Document{}, notFound("document", id)
+	}
+	return d, err
+}
+
+// OpenDocument returns a document with its content, which the caller must close
+func (s *JobApplicationService) OpenDocument(id int64) (Document, *os.File, error) {
+	store, err := s.attachmentStore()
+	if err != nil {
+		return Document{}, nil, err
+	}
+
+	d, err := s.GetDocumentByID(id)
+	if err != nil {
+		return Document{}, nil, err
+	}
+
+	f, err := store.Open(d.SHA256)
+	if err != nil {
+		return Document{}, nil, fmt.Errorf("opening content of document %d: %w", id, err)
+	}
+	return d, f, nil
+}
+
+// DeleteDocument removes a document version that no application refers to
+func (s *JobApplicationService) DeleteDocument(id int64) error {
+	store, err := s.attachmentStore()
+	if err != nil {
+		return err
+	}
+
+	d, err := s.GetDocumentByID(id)
+	if err != nil {
+		return err
+	}
+	if d.Applications > 0 {
+		return fmt.Errorf("%w: document %d was sent with %d applications", ErrConflict, id, d.Applications)
+	}
+
+	return store.Do(func() error {
+		if _, err := s.db.Exec(database.DeleteDocumentStmt, id); err != nil {
+			return translateDBError(err)
+		}
+		return s.releaseBlob(store, d.SHA256)
+	})
+}
+
+// GetApplicationDocuments lists the document versions sent with an application
+func (s *JobApplicationService) GetApplicationDocuments(appID int64) ([]Document, error) {
+	if _, err := getJobApplication(s.db, appID); err != nil {
+		return nil, err
+	}
+	return queryDocuments(s.db, database.SelectApplicationDocumentsStmt, appID)
+}
+
+// LinkDocument records that a document version was sent with an application
+func (s *JobApplicationService) LinkDocument(appID, documentID int64) (Document, error) {
+	if _, err := getJobApplication(s.db, appID); err != nil {
+		return Document{}, err
+	}
+	if _, err := s.GetDocumentByID(documentID); err != nil {
+		return Document{}, err
+	}
+
+	if _, err := s.db.Exec(database.LinkDocumentStmt, appID, documentID); err != nil {
+		return Document{}, translateDBError(err)
+	}
+	return s.GetDocumentByID(documentID)
+}
+
+// UnlinkDocument removes the link between an application and a document version
+func (s *JobApplicationService) UnlinkDocument(appID, documentID int64) error {
+	if _, err := getJobApplication(s.db, appID); err != nil {
+		return err
+	}
+
+	res, err := s.db.Exec(database.UnlinkDocumentStmt, appID, documentID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("document %d is not linked to job application %d: %w", documentID, appID, ErrNotFound)
+	}
+	return nil
+}
+
+// DocumentOutcome summarizes how the applications a document version was sent with turned out.
+// The rates are the shares, from 0 to 1, of those applications that got a response or an
+// interview.
+type DocumentOutcome struct {
+	DocumentID    int64          `json:"document_id"`
+	Name          string         `json:"name"`
+	Version       int64          `json:"version"`
+	Kind          string         `json:"kind"`
+	Applications  int            `json:"applications"`
+	ByStatus      map[string]int `json:"by_status"`
+	Responses     int            `json:"responses"`
+	Interviews    int            `json:"interviews"`
+	ResponseRate  float64        `json:"response_rate"`
+	InterviewRate float64        `json:"interview_rate"`
+}
+
+// respondedStatuses are the outcomes in which the company got back to the applicant
+var respondedStatuses = []string{StatusInterview, StatusOffer, StatusRejected}
+
+// interviewStatuses are the outcomes that got the applicant at least an interview
+var interviewStatuses = []string{StatusInterview, StatusOffer}
+
+// GetDocumentReport compares the outcomes of the applications each document version was sent
+// with, best response rate first. A non-empty kind limits the report to documents of that kind.
+func (s *JobApplicationService) GetDocumentReport(kind string) ([]DocumentOutcome, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if kind != "" {
+		var v validator
+		v.oneOf("kind", kind, AttachmentKinds)
+		if err := v.err(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := s.db.Query(database.DocumentOutcomesStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []DocumentOutcome{}
+	index := map[int64]int{}
+	for rows.Next() {
+		var o DocumentOutcome
+		var status sql.NullString
+		var count int
+		if err := rows.Scan(&o.DocumentID, &o.Name, &o.Version, &o.Kind, &status, &count); err != nil {
+			return nil, err
+		}
+		if kind != "" && o.Kind != kind {
+			continue
+		}
+
+		i, ok := index[o.DocumentID]
+		if !ok {
+			o.ByStatus = map[string]int{}
+			for _, st := range ValidStatuses {
+				o.ByStatus[st] = 0
+			}
+			report = append(report, o)
+			i = len(report) - 1
+			index[o.DocumentID] = i
+		}
+		if !status.Valid {
+			continue
+		}
+
+		r := &report[i]
+		r.Applications += count
+		r.ByStatus[status.String] += count
+		if slices.Contains(respondedStatuses, status.String) {
+			r.Responses += count
+		}
+		if slices.Contains(interviewStatuses, status.String) {
+			r.Interviews += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range report {
+		if n := report[i].Applications; n > 0 {
+			report[i].ResponseRate = float64(report[i].Responses) / float64(n)
+			report[i].InterviewRate = float64(report[i].Interviews) / float64(n)
+		}
+	}
+	slices.SortStableFunc(report, func(a, b DocumentOutcome) int {
+		switch {
+		case a.ResponseRate != b.ResponseRate:
+			if a.ResponseRate > b.ResponseRate {
+				return -1
+			}
+			return 1
+		case a.InterviewRate != b.InterviewRate:
+			if a.InterviewRate > b.InterviewRate {
+				return -1
+			}
+			return 1
+		default:
+			return b.Applications - a.Applications
+		}
+	})
+	return report, nil
+}
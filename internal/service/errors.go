@@ -0,0 +1,69 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrNotFound is returned when the requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write clashes with the current state of a record
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidInput is returned when a request cannot be processed as given
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrPreconditionFailed is returned when a write expected a different version of a record
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrTooLarge is returned when an upload exceeds the configured size limit
+	ErrTooLarge = errors.New("too large")
+	// ErrUnsupportedType is returned when an upload is not one of the accepted file types
+	ErrUnsupportedType = errors.New("unsupported file type")
+)
+
+// FieldError describes a single invalid field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every field level violation found in a request.
+// It matches ErrInvalidInput with errors.Is.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Field + ": " + f.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+// translateDBError maps SQLite constraint violations onto the service's typed errors so
+// callers do not need to know about the driver
+func translateDBError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		return err
+	}
+
+	switch sqliteErr.ExtendedCode {
+	case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey, sqlite3.ErrConstraintForeignKey:
+		return fmt.Errorf("%w: %s", ErrConflict, sqliteErr.Error())
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidInput, sqliteErr.Error())
+	}
+}
+
+// notFound returns an ErrNotFound describing the missing record
+func notFound(kind string, id int64) error {
+	return fmt.Errorf("%s %d %w", kind, id, ErrNotFound)
+}
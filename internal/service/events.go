@@ -0,0 +1,59 @@
+package service
+
+import "time"
+
+// Event types, one for every change of an application
+const (
+	EventCreated       = "created"
+	EventUpdated       = "updated"
+	EventStatusChanged = "status_changed"
+	EventDeleted       = "deleted"
+)
+
+// EventReminderDue is sent to webhooks when an open application has gone without changes long
+// enough to follow up on it, see QueueDueReminders
+const EventReminderDue = "reminder_due"
+
+// EventTypes lists every event type
+var EventTypes = []string{EventCreated, EventUpdated, EventStatusChanged, EventDeleted, EventReminderDue}
+
+// Event describes a change of an application
+type Event struct {
+	Type       string `json:"event"`
+	OccurredAt string `json:"occurred_at"`
+	// Application is the application after the change, or as it was when it was deleted
+	Application *JobApplication `json:"application"`
+	// PreviousStatus is set for status_changed events
+	PreviousStatus string `json:"previous_status,omitempty"`
+	// DaysSinceChange is set for reminder_due events
+	DaysSinceChange float64 `json:"days_since_change,omitempty"`
+}
+
+// visible reports whether a snapshot is of an application outside the trash
+func visible(app *JobApplication) bool {
+	return app != nil && app.DeletedAt == nil
+}
+
+// changeEvent describes a change between two snapshots of an application, which undo and redo
+// record just like the original changes. Restoring an application from the trash is an update,
+// only new applications are created. It returns false if nothing visible changed.
+func changeEvent(before, after *JobApplication) (Event, bool) {
+	e := Event{OccurredAt: time.Now().UTC().Format(time.RFC3339), Application: after}
+	switch {
+	case before == nil && visible(after):
+		e.Type = EventCreated
+	case visible(before) && !visible(after):
+		e.Type = EventDeleted
+		if after == nil {
+			e.Application = before
+		}
+	case visible(after) && before.Status != after.Status:
+		e.Type = EventStatusChanged
+		e.PreviousStatus = before.Status
+	case visible(after):
+		e.Type = EventUpdated
+	default:
+		return Event{}, false
+	}
+	return e, true
+}
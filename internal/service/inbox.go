@@ -0,0 +1,644 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+	"github.com/rafrdz/ctrl-alt-me/internal/storage"
+)
+
+// InboxActor is who status changes applied by inbox rules are attributed to
+const InboxActor = "inbox"
+
+// States of an inbound message
+const (
+	// InboundUnmatched messages could not be matched to a single application
+	InboundUnmatched = "unmatched"
+	// InboundUnclassified messages were matched but no rule says what they mean
+	InboundUnclassified = "unclassified"
+	// InboundUnchanged messages suggest the status the application already has
+	InboundUnchanged = "unchanged"
+	// InboundProposed messages suggest a status change that waits for review
+	InboundProposed  = "proposed"
+	InboundApplied   = "applied"
+	InboundDismissed = "dismissed"
+)
+
+// InboundStates lists every state of an inbound message
+var InboundStates = []string{InboundUnmatched, InboundUnclassified, InboundUnchanged, InboundProposed, InboundApplied, InboundDismissed}
+
+// How an inbound message was matched to its application
+const (
+	// MatchContactEmail means the sender's address appears in the application's notes
+	MatchContactEmail = "contact_email"
+	// MatchDomain means the sender's domain is the company's or that of the job link
+	MatchDomain = "domain"
+	// MatchCompanyName means the company is named in the sender's name or the subject
+	MatchCompanyName = "company_name"
+	// MatchManual means the application was chosen when the message was applied
+	MatchManual = "manual"
+)
+
+// Inbox limits
+const (
+	MaxInboxRules          = 50
+	MaxInboxPatternLength  = 1000
+	DefaultInboundMessages = 50
+	MaxInboundMessages     = 500
+)
+
+// minCompanyNameLength keeps short company names from matching words in unrelated mail
+const minCompanyNameLength = 3
+
+// sharedDomains are mail providers and job boards, whose domain says nothing about the company
+var sharedDomains = map[string]bool{
+	"gmail": true, "googlemail": true, "outlook": true, "hotmail": true, "live": true, "yahoo": true,
+	"icloud": true, "proton": true, "protonmail": true, "aol": true, "gmx": true, "fastmail": true,
+	"linkedin": true, "indeed": true, "glassdoor": true, "ziprecruiter": true, "wellfound": true,
+	"greenhouse": true, "greenhouse-mail": true, "lever": true, "workday": true, "myworkday": true,
+	"myworkdayjobs": true, "smartrecruiters": true, "ashbyhq": true, "icims": true, "jobvite": true,
+	"bamboohr": true, "workable": true, "recruitee": true, "teamtailor": true, "personio": true,
+}
+
+// companySuffixes are left out when comparing company names with domains
+var companySuffixes = map[string]bool{
+	"inc": true, "llc": true, "ltd": true, "limited": true, "gmbh": true, "ag": true, "corp": true,
+	"corporation": true, "co": true, "company": true, "plc": true, "sa": true, "bv": true, "srl": true,
+}
+
+// InboundEmail is an email to file, as read from a mailbox
+type InboundEmail struct {
+	// MessageID identifies the message so it is only filed once, a hash of Raw is used if empty
+	MessageID   string
+	FromName    string
+	FromAddress string
+	Subject     string
+	Date        time.Time
+	// Text is the body as plain text
+	Text string
+	// Raw is the message as received, attached to the application it is matched to
+	Raw []byte
+}
+
+// InboxRuleInput is a rule as it is set
+type InboxRuleInput struct {
+	// Status is what a message matching the rule suggests for its application
+	Status string `json:"status"`
+	// Pattern is a case-insensitive regular expression looked for in the subject and body
+	Pattern string `json:"pattern"`
+	// Apply changes the status right away instead of proposing the change for review
+	Apply bool `json:"apply"`
+}
+
+// InboxRule classifies inbound messages. Rules are checked in order and the first match wins.
+type InboxRule struct {
+	ID int64 `json:"id"`
+	InboxRuleInput
+}
+
+// InboundMessage is an email that was filed, with what it was matched to and what it suggests
+type InboundMessage struct {
+	ID            int64   `json:"id"`
+	MessageID     string  `json:"message_id"`
+	From          string  `json:"from"`
+	Subject       string  `json:"subject"`
+	SentAt        *string `json:"sent_at"`
+	ApplicationID *int64  `json:"application_id"`
+	MatchedBy     string  `json:"matched_by,omitempty"`
+	RuleID        *int64  `json:"rule_id"`
+	// Status is the status the message suggests for its application
+	Status       string `json:"status,omitempty"`
+	State        string `json:"state"`
+	AttachmentID *int64 `json:"attachment_id"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// ApplyInboundInput overrides what an inbound message is applied as
+type ApplyInboundInput struct {
+	ApplicationID int64  `json:"application_id"`
+	Status        string `json:"status"`
+}
+
+func scanInboxRule(row scanner) (InboxRule, error) {
+	var r InboxRule
+	err := row.Scan(&r.ID, &r.Status, &r.Pattern, &r.Apply)
+	return r, err
+}
+
+// GetInboxRules lists the inbox rules in the order they are checked
+func (s *JobApplicationService) GetInboxRules() ([]InboxRule, error) {
+	return queryInboxRules(s.db)
+}
+
+func queryInboxRules(q querier) ([]InboxRule, error) {
+	rows, err := q.Query(database.SelectInboxRulesStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []InboxRule{}
+	for rows.Next() {
+		r, err := scanInboxRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// SetInboxRules replaces the inbox rules with in, checked in the given order
+func (s *JobApplicationService) SetInboxRules(in []InboxRuleInput) ([]InboxRule, error) {
+	var v validator
+	if len(in) > MaxInboxRules {
+		v.add("rules", "must be at most %d", MaxInboxRules)
+	}
+	for i := range in {
+		r := &in[i]
+		r.Status = strings.ToLower(strings.TrimSpace(r.Status))
+		v.prefix = fmt.Sprintf("rules[%d].", i)
+		if v.required("status", r.Status) {
+			v.oneOf("status", r.Status, ValidStatuses)
+		}
+		if v.required("pattern", r.Pattern) {
+			v.maxLength("pattern", r.Pattern, MaxInboxPatternLength)
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				v.add("pattern", "is not a valid regular expression: %v", err)
+			}
+		}
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(database.DeleteInboxRulesStmt); err != nil {
+		return nil, err
+	}
+	for i, r := range in {
+		if _, err := tx.Exec(database.InsertInboxRuleStmt, i+1, r.Status, r.Pattern, r.Apply); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetInboxRules()
+}
+
+func compileInboxPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// classify returns the first rule that matches the message, if any
+func (s *JobApplicationService) classify(q querier, e InboundEmail) (*InboxRule, error) {
+	rules, err := queryInboxRules(q)
+	if err != nil {
+		return nil, err
+	}
+	text := e.Subject + "\n" + e.Text
+	for _, r := range rules {
+		re, err := compileInboxPattern(r.Pattern)
+		if err != nil {
+			s.logger.Warn("Skipping invalid inbox rule", "rule", r.ID, "error", err)
+			continue
+		}
+		if re.MatchString(text) {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+// orgLabel returns the label of a host name that names the organization, e.g. "acme" for
+// careers.acme.co.uk
+func orgLabel(host string) string {
+	labels := strings.Split(strings.Trim(strings.ToLower(host), "."), ".")
+	if len(labels) < 2 {
+		return ""
+	}
+	i := len(labels) - 2
+	// Second-level registries like co.uk or com.au
+	if i > 0 && len(labels[i]) <= 3 && len(labels[len(labels)-1]) == 2 {
+		i--
+	}
+	return labels[i]
+}
+
+// companyWords returns the lower-cased words of a company name without its legal suffix
+func companyWords(company string) []string {
+	words := strings.FieldsFunc(strings.ToLower(company), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '&'
+	})
+	for len(words) > 1 && companySuffixes[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return words
+}
+
+// companyKeys returns the forms of a company name that are compared with domain labels: its
+// words joined with and without hyphens
+func companyKeys(company string) []string {
+	words := companyWords(company)
+	if len(words) == 0 {
+		return nil
+	}
+	return []string{strings.Join(words, ""), strings.Join(words, "-")}
+}
+
+// namesCompany reports whether text names the company as whole words, ignoring case and the
+// company's legal suffix
+func namesCompany(text, company string) bool {
+	text, phrase := strings.ToLower(text), strings.Join(companyWords(company), " ")
+	if len([]rune(phrase)) < minCompanyNameLength {
+		return false
+	}
+	for i := 0; ; {
+		j := strings.Index(text[i:], phrase)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(phrase)
+		before := start == 0 || !isWordByte(text[start-1])
+		after := end == len(text) || !isWordByte(text[end])
+		if before && after {
+			return true
+		}
+		i = start + 1
+	}
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b >= 0x80
+}
+
+// matchApplication finds the application an email is about. The most specific kind of match
+// decides, and applications that are still open are preferred when several match.
+func (s *JobApplicationService) matchApplication(q querier, e InboundEmail) (*JobApplication, string, error) {
+	apps, err := queryJobApplications(q, database.SelectAllStmt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	address := strings.ToLower(e.FromAddress)
+	sender := ""
+	if at := strings.LastIndex(address, "@"); at >= 0 {
+		sender = orgLabel(address[at+1:])
+	}
+	if sharedDomains[sender] {
+		sender = ""
+	}
+
+	matchers := []struct {
+		by    string
+		match func(app JobApplication) bool
+	}{
+		{MatchContactEmail, func(app JobApplication) bool {
+			return address != "" && strings.Contains(strings.ToLower(app.Notes), address)
+		}},
+		{MatchDomain, func(app JobApplication) bool {
+			if sender == "" {
+				return false
+			}
+			for _, key := range companyKeys(app.Company) {
+				if key == sender {
+					return true
+				}
+			}
+			if host := linkHost(app.Link); host != "" {
+				return orgLabel(host) == sender
+			}
+			return false
+		}},
+		{MatchCompanyName, func(app JobApplication) bool {
+			return namesCompany(e.FromName, app.Company) || namesCompany(e.Subject, app.Company)
+		}},
+	}
+	for _, m := range matchers {
+		var found, open []JobApplication
+		for _, app := range apps {
+			if m.match(app) {
+				found = append(found, app)
+				if app.Status == StatusApplied || app.Status == StatusInterview || app.Status == StatusOffer {
+					open = append(open, app)
+				}
+			}
+		}
+		switch {
+		case len(found) == 1:
+			return &found[0], m.by, nil
+		case len(open) == 1:
+			return &open[0], m.by, nil
+		case len(found) > 1:
+			// Ambiguous, a less specific kind of match would not do better
+			return nil, "", nil
+		}
+	}
+	return nil, "", nil
+}
+
+// linkHost returns the host of a job link, unless it is a job board's
+func linkHost(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || sharedDomains[orgLabel(u.Hostname())] {
+		return ""
+	}
+	return u.Hostname()
+}
+
+func scanInboundMessage(row scanner) (InboundMessage, error) {
+	var m InboundMessage
+	err := row.Scan(&m.ID, &m.MessageID, &m.From, &m.Subject, &m.SentAt, &m.ApplicationID, &m.MatchedBy,
+		&m.RuleID, &m.Status, &m.State, &m.AttachmentID, &m.CreatedAt)
+	return m, err
+}
+
+// GetInboundMessages lists the most recent inbound messages, newest first, optionally only
+// those in the given state
+func (s *JobApplicationService) GetInboundMessages(state string, limit int) ([]InboundMessage, error) {
+	var v validator
+	if state != "" {
+		v.oneOf("state", state, InboundStates)
+	}
+	if limit == 0 {
+		limit = DefaultInboundMessages
+	}
+	if limit < 1 || limit > MaxInboundMessages {
+		v.add("limit", "must be between 1 and %d", MaxInboundMessages)
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(database.SelectInboundMessagesStmt, state, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []InboundMessage{}
+	for rows.Next() {
+		m, err := scanInboundMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// GetInboundMessage returns an inbound message
+func (s *JobApplicationService) GetInboundMessage(id int64) (InboundMessage, error) {
+	m, err := scanInboundMessage(s.db.QueryRow(database.SelectInboundMessageStmt, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return InboundMessage{}, notFound("inbound message", id)
+	}
+	return m, err
+}
+
+// IngestEmail files an email: it is matched to an application, attached to it and classified
+// by the inbox rules. The status change it suggests is applied right away if the rule says
+// so, or proposed for review. Filing is one transaction, an email that could not be filed
+// completely is not recorded and filed again when it is retried. An email that was filed
+// before is returned with created set to false and left as it is.
+func (s *JobApplicationService) IngestEmail(e InboundEmail) (msg InboundMessage, created bool, err error) {
+	if e.MessageID == "" {
+		sum := sha256.Sum256(e.Raw)
+		e.MessageID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+
+	m, err := s.WithActor(InboxActor).begin()
+	if err != nil {
+		return InboundMessage{}, false, err
+	}
+	defer m.Rollback()
+
+	msg, err = scanInboundMessage(m.QueryRow(database.SelectInboundMessageByMessageIDStmt, e.MessageID))
+	if err == nil {
+		return msg, false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return InboundMessage{}, false, err
+	}
+
+	from := e.FromAddress
+	if e.FromName != "" {
+		from = fmt.Sprintf("%s <%s>", e.FromName, e.FromAddress)
+	}
+	var sentAt *string
+	if !e.Date.IsZero() {
+		t := e.Date.UTC().Format(time.DateTime)
+		sentAt = &t
+	}
+	res, err := m.Exec(database.InsertInboundMessageStmt, e.MessageID, from, e.Subject, sentAt, e.Raw, InboundUnmatched)
+	if err != nil {
+		return InboundMessage{}, false, translateDBError(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return InboundMessage{}, false, err
+	}
+	msg, err = scanInboundMessage(m.QueryRow(database.SelectInboundMessageStmt, id))
+	if err != nil {
+		return InboundMessage{}, false, err
+	}
+
+	app, matchedBy, err := s.matchApplication(m, e)
+	if err != nil {
+		return InboundMessage{}, false, err
+	}
+	if app == nil {
+		if err := m.Commit(); err != nil {
+			return InboundMessage{}, false, err
+		}
+		return msg, true, nil
+	}
+	msg.ApplicationID, msg.MatchedBy, msg.State = &app.ID, matchedBy, InboundUnclassified
+
+	rule, err := s.classify(m, e)
+	if err != nil {
+		return InboundMessage{}, false, err
+	}
+	if rule != nil {
+		msg.RuleID, msg.Status = &rule.ID, rule.Status
+		switch {
+		case rule.Status == app.Status:
+			msg.State = InboundUnchanged
+		case rule.Apply:
+			if err := m.setStatus(app.ID, rule.Status); err != nil {
+				return InboundMessage{}, false, err
+			}
+			msg.State = InboundApplied
+		default:
+			msg.State = InboundProposed
+		}
+	}
+
+	if err := s.fileEmail(m, &msg, e.Raw); err != nil {
+		return InboundMessage{}, false, err
+	}
+	s.logger.Info("Filed inbound email", "message", msg.ID, "application", app.ID, "matchedBy", matchedBy, "state", msg.State, "status", msg.Status)
+	return msg, true, nil
+}
+
+// fileEmail saves msg and commits m. The raw message is attached to the application msg is
+// matched to unless it already was, within the attachment store's lock so the stored file
+// cannot be swept before the attachment that refers to it is committed. Messages that cannot
+// be attached are kept with the inbound message instead, so they can be attached later.
+func (s *JobApplicationService) fileEmail(m *mutation, msg *InboundMessage, raw []byte) error {
+	commit := func() error {
+		if err := updateInboundMessage(m, *msg); err != nil {
+			return err
+		}
+		return m.Commit()
+	}
+	if msg.ApplicationID == nil || msg.AttachmentID != nil || raw == nil {
+		return commit()
+	}
+
+	store, err := s.attachmentStore()
+	if err == nil {
+		err = storeUpload(store, emailFilename(*msg), bytes.NewReader(raw), func(blob storage.Blob, contentType string) error {
+			a, _, err := insertAttachment(m, *msg.ApplicationID, AttachmentEmail, emailFilename(*msg), contentType, blob)
+			if err != nil {
+				return err
+			}
+			msg.AttachmentID = &a.ID
+			return commit()
+		})
+	}
+	if msg.AttachmentID != nil {
+		if err != nil {
+			msg.AttachmentID = nil
+			return err
+		}
+		s.wakeTextExtractor()
+		return nil
+	}
+	s.logger.Warn("Failed to attach inbound email", "message", msg.ID, "application", *msg.ApplicationID, "error", err)
+	return commit()
+}
+
+// emailFilename names the attachment of an inbound message after its subject
+func emailFilename(msg InboundMessage) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == ' ' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, msg.Subject)
+	name = strings.Join(strings.Fields(name), " ")
+	if len([]rune(name)) > 100 {
+		name = string([]rune(name)[:100])
+	}
+	if name == "" {
+		name = fmt.Sprintf("email %d", msg.ID)
+	}
+	return name + ".eml"
+}
+
+func updateInboundMessage(q querier, m InboundMessage) error {
+	_, err := q.Exec(database.UpdateInboundMessageStmt, m.ApplicationID, m.MatchedBy, m.RuleID, m.Status, m.State, m.AttachmentID, m.ID)
+	return err
+}
+
+// setStatus changes the status of an application, recording the change like any other update
+func (m *mutation) setStatus(id int64, status string) error {
+	current, err := getJobApplication(m, id)
+	if err != nil {
+		return err
+	}
+	app := current.NewJobApplication
+	app.Status = status
+	_, err = m.update(id, current.Version, app)
+	return err
+}
+
+// ApplyInboundMessage applies the status change an inbound message suggests. in may name
+// another application or status, which is needed for messages that were not matched or
+// classified. The message is attached to the application if it was not yet.
+func (s *JobApplicationService) ApplyInboundMessage(id int64, in ApplyInboundInput) (InboundMessage, error) {
+	msg, err := s.GetInboundMessage(id)
+	if err != nil {
+		return InboundMessage{}, err
+	}
+	if msg.State == InboundApplied {
+		return InboundMessage{}, fmt.Errorf("%w: inbound message %d was already applied", ErrConflict, id)
+	}
+
+	status := strings.ToLower(strings.TrimSpace(in.Status))
+	if status == "" {
+		status = msg.Status
+	}
+	appID := in.ApplicationID
+	if appID == 0 && msg.ApplicationID != nil {
+		appID = *msg.ApplicationID
+	}
+	var v validator
+	if appID == 0 {
+		v.add("application_id", "is required for a message that was not matched")
+	}
+	if status == "" {
+		v.add("status", "is required for a message that was not classified")
+	} else {
+		v.oneOf("status", status, ValidStatuses)
+	}
+	if err := v.err(); err != nil {
+		return InboundMessage{}, err
+	}
+
+	m, err := s.begin()
+	if err != nil {
+		return InboundMessage{}, err
+	}
+	defer m.Rollback()
+
+	if err := m.setStatus(appID, status); err != nil {
+		return InboundMessage{}, err
+	}
+	if msg.ApplicationID == nil || *msg.ApplicationID != appID {
+		msg.ApplicationID, msg.MatchedBy = &appID, MatchManual
+	}
+	var raw []byte
+	if msg.AttachmentID == nil {
+		if err := m.QueryRow(database.SelectInboundMessageRawStmt, id).Scan(&raw); err != nil {
+			return InboundMessage{}, err
+		}
+	}
+	msg.Status, msg.State = status, InboundApplied
+	if err := s.fileEmail(m, &msg, raw); err != nil {
+		return InboundMessage{}, err
+	}
+	return msg, nil
+}
+
+// DismissInboundMessage marks an inbound message as reviewed without changing its application
+func (s *JobApplicationService) DismissInboundMessage(id int64) (InboundMessage, error) {
+	msg, err := s.GetInboundMessage(id)
+	if err != nil {
+		return InboundMessage{}, err
+	}
+	if msg.State == InboundApplied {
+		return InboundMessage{}, fmt.Errorf("%w: inbound message %d was already applied", ErrConflict, id)
+	}
+	msg.State = InboundDismissed
+	if err := updateInboundMessage(s.db, msg); err != nil {
+		return InboundMessage{}, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/storage"
+)
+
+func TestOrgLabel(t *testing.T) {
+	for host, want := range map[string]string{
+		"acme.com":             "acme",
+		"Careers.ACME.com.":    "acme",
+		"mail.careers.acme.io": "acme",
+		"careers.acme.co.uk":   "acme",
+		"jobs.globex.com.au":   "globex",
+		"ab.de":                "ab",
+		"localhost":            "",
+		"":                     "",
+	} {
+		if got := orgLabel(host); got != want {
+			t.Errorf("orgLabel(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestMatchApplication(t *testing.T) {
+	svc := newTestService(t)
+	acme := mustCreate(t, svc, NewJobApplication{Company: "Acme Corp", Position: "Engineer", Status: StatusApplied,
+		Notes: "Recruiter: Jane Doe <jane@recruiting-partner.com>"})
+	globex := mustCreate(t, svc, NewJobApplication{Company: "Globex", Position: "Designer", Status: StatusInterview,
+		Link: "https://careers.globex-group.co.uk/jobs/42"})
+	mustCreate(t, svc, NewJobApplication{Company: "Initech", Position: "Analyst", Status: StatusRejected})
+	initech := mustCreate(t, svc, NewJobApplication{Company: "Initech", Position: "Engineer", Status: StatusApplied})
+	mustCreate(t, svc, NewJobApplication{Company: "Hooli", Position: "Engineer", Status: StatusApplied})
+	mustCreate(t, svc, NewJobApplication{Company: "Hooli", Position: "Manager", Status: StatusInterview})
+	mustCreate(t, svc, NewJobApplication{Company: "Ab", Position: "Engineer", Status: StatusApplied})
+
+	tests := []struct {
+		name string
+		e    InboundEmail
+		want *JobApplication
+		by   string
+	}{
+		{"contact in the notes", InboundEmail{FromAddress: "JANE@recruiting-partner.com", Subject: "Next steps"}, &acme, MatchContactEmail},
+		{"company domain", InboundEmail{FromAddress: "no-reply@mail.acme.com", Subject: "Your application"}, &acme, MatchDomain},
+		{"job link domain", InboundEmail{FromAddress: "talent@globex-group.co.uk", Subject: "Interview"}, &globex, MatchDomain},
+		{"contact beats domain", InboundEmail{FromAddress: "jane@recruiting-partner.com", Subject: "Globex interview"}, &acme, MatchContactEmail},
+		{"name in the subject", InboundEmail{FromAddress: "someone@gmail.com", Subject: "Interview at Globex tomorrow"}, &globex, MatchCompanyName},
+		{"name of the sender", InboundEmail{FromName: "Acme Recruiting", FromAddress: "acme.jobs@gmail.com", Subject: "Hello"}, &acme, MatchCompanyName},
+		{"open application preferred", InboundEmail{FromAddress: "hr@initech.com", Subject: "Update"}, &initech, MatchDomain},
+		{"ambiguous", InboundEmail{FromAddress: "jobs@hooli.com", Subject: "Update"}, nil, ""},
+		{"name only part of a word", InboundEmail{FromAddress: "news@example.org", Subject: "Globexcellence newsletter"}, nil, ""},
+		{"name too short", InboundEmail{FromAddress: "news@example.org", Subject: "Ab testing tips"}, nil, ""},
+		{"job board", InboundEmail{FromAddress: "jobs-noreply@linkedin.com", Subject: "New jobs for you"}, nil, ""},
+	}
+	for _, tt := range tests {
+		app, by, err := svc.matchApplication(svc.db, tt.e)
+		if err != nil {
+			t.Fatalf("%s: matchApplication: %v", tt.name, err)
+		}
+		switch {
+		case tt.want == nil && app != nil:
+			t.Errorf("%s: matched %s, %s by %s", tt.name, app.Company, app.Position, by)
+		case tt.want != nil && (app == nil || app.ID != tt.want.ID || by != tt.by):
+			t.Errorf("%s: matched %v by %q, want %d by %q", tt.name, app, by, tt.want.ID, tt.by)
+		}
+	}
+}
+
+const testEmail = "From: Acme Recruiting <jobs@acme.com>\r\nSubject: Interview invitation\r\n\r\nWe would like to invite you to an interview.\r\n"
+
+func TestIngestEmailIsFiledOnceCompletely(t *testing.T) {
+	svc := newTestService(t)
+	store, err := storage.NewStore(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.SetAttachmentStore(store)
+	app := mustCreate(t, svc, NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusApplied})
+	if _, err := svc.SetInboxRules([]InboxRuleInput{{Status: StatusInterview, Pattern: `invite you to an interview`, Apply: true}}); err != nil {
+		t.Fatalf("SetInboxRules: %v", err)
+	}
+	e := InboundEmail{MessageID: "1@acme.com", FromName: "Acme Recruiting", FromAddress: "jobs@acme.com",
+		Subject: "Interview invitation", Text: "We would like to invite you to an interview.", Raw: []byte(testEmail)}
+
+	// Changing the status fails after the message was recorded and matched
+	if _, err := svc.db.Exec(`CREATE TRIGGER fail_update BEFORE UPDATE ON job_applications BEGIN SELECT RAISE(ABORT, 'disk full'); END`); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := svc.IngestEmail(e); err == nil {
+		t.Fatal("IngestEmail succeeded")
+	}
+	if messages, err := svc.GetInboundMessages("", 0); err != nil || len(messages) != 0 {
+		t.Fatalf("after a failure: %v, %v, want nothing recorded", messages, err)
+	}
+	wantStatus(t, svc, app.ID, StatusApplied)
+
+	// Retried once the failure is gone
+	if _, err := svc.db.Exec(`DROP TRIGGER fail_update`); err != nil {
+		t.Fatal(err)
+	}
+	msg, created, err := svc.IngestEmail(e)
+	if err != nil || !created {
+		t.Fatalf("IngestEmail = %v, %v", created, err)
+	}
+	if msg.ApplicationID == nil || *msg.ApplicationID != app.ID || msg.MatchedBy != MatchDomain ||
+		msg.State != InboundApplied || msg.Status != StatusInterview || msg.AttachmentID == nil {
+		t.Errorf("filed as %+v", msg)
+	}
+	wantStatus(t, svc, app.ID, StatusInterview)
+	attachments, err := svc.GetAttachments(app.ID)
+	if err != nil || len(attachments) != 1 || attachments[0].Kind != AttachmentEmail || attachments[0].Filename != "Interview invitation.eml" {
+		t.Errorf("attachments %+v, %v", attachments, err)
+	}
+
+	again, created, err := svc.IngestEmail(e)
+	if err != nil || created || again.ID != msg.ID || again.State != InboundApplied {
+		t.Errorf("filing again = %+v, %v, %v", again, created, err)
+	}
+}
+
+// Messages that cannot be attached are still filed, and attached when they are applied. The
+// default rules propose an interview.
+func TestIngestEmailWithoutAttachmentStore(t *testing.T) {
+	svc := newTestService(t)
+	app := mustCreate(t, svc, NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusApplied})
+	e := InboundEmail{FromAddress: "jobs@acme.com", Subject: "Interview invitation", Raw: []byte(testEmail)}
+
+	msg, created, err := svc.IngestEmail(e)
+	if err != nil || !created {
+		t.Fatalf("IngestEmail = %v, %v", created, err)
+	}
+	if msg.State != InboundProposed || msg.AttachmentID != nil || msg.MessageID == "" {
+		t.Errorf("filed as %+v", msg)
+	}
+
+	store, err := storage.NewStore(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.SetAttachmentStore(store)
+	applied, err := svc.ApplyInboundMessage(msg.ID, ApplyInboundInput{Status: StatusInterview})
+	if err != nil {
+		t.Fatalf("ApplyInboundMessage: %v", err)
+	}
+	if applied.State != InboundApplied || applied.AttachmentID == nil {
+		t.Errorf("applied as %+v", applied)
+	}
+	wantStatus(t, svc, app.ID, StatusInterview)
+
+	if _, err := svc.ApplyInboundMessage(msg.ID, ApplyInboundInput{}); !errors.Is(err, ErrConflict) {
+		t.Errorf("applying twice: %v, want a conflict", err)
+	}
+}
@@ -1,21 +1,47 @@
 package service
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/rafrdz/ctrl-alt-me/internal/database"
+	"github.com/rafrdz/ctrl-alt-me/internal/storage"
 )
 
 type JobApplicationService struct {
 	db     *sql.DB
 	logger *slog.Logger
+	// actor identifies the caller whose changes are recorded, see WithActor
+	actor     string
+	undoDepth int
+	// files holds attachment content, see SetAttachmentStore
+	files *storage.Store
+	// extractWake signals the text extractor that new attachments are waiting
+	extractWake chan struct{}
+	// webhookWake signals the webhook dispatcher that deliveries were queued
+	webhookWake   chan struct{}
+	webhookClient *http.Client
+	// events streams committed changes to connected clients, see SubscribeEvents
+	events *broker
 }
 
 func NewJobApplicationService(db *sql.DB, logger *slog.Logger) *JobApplicationService {
-	return &JobApplicationService{db: db, logger: logger}
+	return &JobApplicationService{
+		db:            db,
+		logger:        logger,
+		undoDepth:     DefaultUndoDepth,
+		extractWake:   make(chan struct{}, 1),
+		webhookWake:   make(chan struct{}, 1),
+		webhookClient: &http.Client{Timeout: WebhookTimeout},
+		events:        newBroker(),
+	}
 }
 
 type NewJobApplication struct {
@@ -24,11 +50,12 @@ type NewJobApplication struct {
 	Link     string `json:"link"`
 	Status   string `json:"status"`
 	Notes    string `json:"notes"`
-}
-
-type NewJobApplicationResponse struct {
-	ID int64 `json:"id"`
-	NewJobApplication
+	// Tags are assigned by name, unknown tags are created on the fly. Updates that leave them
+	// out (nil) keep the current tags, an empty list removes them.
+	Tags []string `json:"tags"`
+	// JobDescription is stored as a new version of the application's job description when
+	// set. It is only read on writes, see GetJobDescription.
+	JobDescription *JobDescriptionInput `json:"job_description,omitempty"`
 }
 
 type JobApplication struct {
@@ -36,190 +63,436 @@ type JobApplication struct {
 	NewJobApplication
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
+	// Version is incremented on every write and used for optimistic concurrency control
+	Version int64 `json:"version"`
+	// ArchivedAt is set while the application is archived, i.e. hidden from the board
+	ArchivedAt *string `json:"archived_at,omitempty"`
+	// DeletedAt is set while the application is in the trash
+	DeletedAt *string `json:"deleted_at,omitempty"`
 }
 
-func (s *JobApplicationService) CreateJobApplication(app NewJobApplication) (NewJobApplicationResponse, error) {
-	stmt, err := s.db.Prepare(database.InsertStmt)
-	if err != nil {
-		return NewJobApplicationResponse{}, err
+// CreateJobApplication stores a new application and returns the stored row
+func (s *JobApplicationService) CreateJobApplication(app NewJobApplication) (JobApplication, error) {
+	app.normalize()
+	if err := app.Validate(); err != nil {
+		return JobApplication{}, err
 	}
-	defer stmt.Close()
 
-	res, err := stmt.Exec(app.Company, app.Position, app.Link, app.Status, app.Notes)
+	m, err := s.begin()
 	if err != nil {
-		return NewJobApplicationResponse{}, err
+		return JobApplication{}, err
 	}
+	defer m.Rollback()
 
-	id, err := res.LastInsertId()
+	res, err := m.Exec(database.InsertStmt, app.Company, app.Position, app.Link, app.Status, app.Notes)
 	if err != nil {
-		return NewJobApplicationResponse{}, err
+		return JobApplication{}, translateDBError(err)
 	}
 
-	return NewJobApplicationResponse{
-		ID:                id,
-		NewJobApplication: app,
-	}, nil
+	created, err := m.created(res, app.Tags)
+	if err != nil {
+		return JobApplication{}, err
+	}
+	if app.JobDescription != nil {
+		if _, _, err := addJobDescription(m, created.ID, *app.JobDescription); err != nil {
+			return JobApplication{}, err
+		}
+	}
+	return created, m.Commit()
 }
 
-func (s *JobApplicationService) GetJobApplicationByID(id string) (JobApplication, error) {
-	stmt, err := s.db.Prepare(database.SelectByIDStmt)
+// created tags the row inserted by res, reads it back and records its creation
+func (m *mutation) created(res sql.Result, tags []string) (JobApplication, error) {
+	id, err := res.LastInsertId()
 	if err != nil {
 		return JobApplication{}, err
 	}
-	defer stmt.Close()
+	if err := setTags(m, id, tags); err != nil {
+		return JobApplication{}, err
+	}
 
-	var app JobApplication
-	err = stmt.QueryRow(id).Scan(&app.ID, &app.Company, &app.Position, &app.Link, &app.Status, &app.Notes)
+	app, err := getJobApplication(m, id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return JobApplication{}, nil
-		}
 		return JobApplication{}, err
 	}
+	return app, m.record(ActionCreated, nil, &app)
+}
 
-	return app, nil
+func (s *JobApplicationService) GetJobApplicationByID(id int64) (JobApplication, error) {
+	return getJobApplication(s.db, id)
 }
 
-func (s *JobApplicationService) GetJobApplications() ([]JobApplication, error) {
-	stmt, err := s.db.Prepare(database.SelectAllStmt)
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanJobApplication reads a row selected with database.SelectColumns
+func scanJobApplication(row scanner) (JobApplication, error) {
+	var app JobApplication
+	err := row.Scan(&app.ID, &app.Company, &app.Position, &app.Link, &app.Status, &app.Notes, &app.CreatedAt, &app.UpdatedAt, &app.Version, &app.ArchivedAt, &app.DeletedAt)
+	return app, err
+}
+
+func getJobApplication(q querier, id int64) (JobApplication, error) {
+	return getOneJobApplication(q, database.SelectByIDStmt, id)
+}
+
+func getOneJobApplication(q querier, query string, id int64) (JobApplication, error) {
+	app, err := scanJobApplication(q.QueryRow(query, id))
 	if err != nil {
-		return nil, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return JobApplication{}, notFound("job application", id)
+		}
+		return JobApplication{}, err
 	}
-	defer stmt.Close()
 
-	rows, err := stmt.Query()
+	apps := []JobApplication{app}
+	if err := loadTags(q, apps); err != nil {
+		return JobApplication{}, err
+	}
+	return apps[0], nil
+}
+
+// queryJobApplications runs a query selecting database.SelectColumns and collects the rows
+func queryJobApplications(q querier, query string, args ...any) ([]JobApplication, error) {
+	rows, err := q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var applications []JobApplication
+	applications := []JobApplication{}
 	for rows.Next() {
-		var app JobApplication
-		err = rows.Scan(&app.ID, &app.Company, &app.Position, &app.Link, &app.Status, &app.Notes, &app.CreatedAt, &app.UpdatedAt)
+		app, err := scanJobApplication(rows)
 		if err != nil {
 			return nil, err
 		}
 		applications = append(applications, app)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
+	if err := loadTags(q, applications); err != nil {
+		return nil, err
+	}
 	return applications, nil
 }
 
-func (s *JobApplicationService) UpdateJobApplication(app JobApplication) (JobApplication, error) {
-	stmt, err := s.db.Prepare(database.UpdateStmt)
+// Values for ListOptions.Archived
+const (
+	ArchivedExclude = "exclude"
+	ArchivedInclude = "include"
+	ArchivedOnly    = "only"
+)
+
+// ListOptions filters the applications returned by GetJobApplications
+type ListOptions struct {
+	// Archived is one of ArchivedExclude (the default when empty), ArchivedInclude or ArchivedOnly
+	Archived string
+	// Tags limits the list to applications carrying these tags
+	Tags []string
+	// TagMatch is TagMatchAll (the default when empty) or TagMatchAny
+	TagMatch string
+}
+
+// GetJobApplications lists applications that are not in the trash. Archived applications are
+// hidden from the board and only returned when requested through opts.
+func (s *JobApplicationService) GetJobApplications(opts ListOptions) ([]JobApplication, error) {
+	query := database.SelectAllStmt
+	switch opts.Archived {
+	case "", ArchivedExclude:
+	case ArchivedInclude:
+		query = database.SelectWithArchivedStmt
+	case ArchivedOnly:
+		query = database.SelectArchivedStmt
+	default:
+		var v validator
+		v.oneOf("archived", opts.Archived, []string{ArchivedExclude, ArchivedInclude, ArchivedOnly})
+		return nil, v.err()
+	}
+
+	filter, args, err := tagFilter(opts)
 	if err != nil {
+		return nil, err
+	}
+	return queryJobApplications(s.db, query+filter, args...)
+}
+
+// UpdateJobApplication replaces every editable field of the application and returns the stored row.
+// If expectedVersion is not 0 the update fails with ErrPreconditionFailed unless it matches the stored version.
+func (s *JobApplicationService) UpdateJobApplication(id, expectedVersion int64, app NewJobApplication) (JobApplication, error) {
+	app.normalize()
+	if err := app.Validate(); err != nil {
 		return JobApplication{}, err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(app.Company, app.Position, app.Link, app.Status, app.Notes, app.ID)
+	m, err := s.begin()
+	if err != nil {
+		return JobApplication{}, err
+	}
+	defer m.Rollback()
+
+	updated, err := m.update(id, expectedVersion, app)
 	if err != nil {
 		return JobApplication{}, err
 	}
-	return app, nil
+	return updated, m.Commit()
 }
 
-func (s *JobApplicationService) DeleteJobApplication(id string) error {
-	stmt, err := s.db.Prepare(database.DeleteStmt)
+// PatchFunc transforms the JSON representation of an application's editable fields
+// (a NewJobApplication), e.g. by applying a JSON Merge Patch or JSON Patch document
+type PatchFunc func(doc []byte) ([]byte, error)
+
+// PatchJobApplication applies patch to the current state of the application and stores the result.
+// Fields the patch does not touch keep their current values. expectedVersion behaves as for UpdateJobApplication.
+func (s *JobApplicationService) PatchJobApplication(id, expectedVersion int64, patch PatchFunc) (JobApplication, error) {
+	m, err := s.begin()
 	if err != nil {
-		return err
+		return JobApplication{}, err
+	}
+	defer m.Rollback()
+
+	current, err := getJobApplication(m, id)
+	if err != nil {
+		return JobApplication{}, err
+	}
+	if err := checkVersion(current, expectedVersion); err != nil {
+		return JobApplication{}, err
+	}
+
+	doc, err := json.Marshal(current.NewJobApplication)
+	if err != nil {
+		return JobApplication{}, err
+	}
+	patched, err := patch(doc)
+	if err != nil {
+		return JobApplication{}, err
+	}
+
+	var app NewJobApplication
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&app); err != nil {
+		return JobApplication{}, fmt.Errorf("%w: patched document: %v", ErrInvalidInput, err)
+	}
+	// The patched document is the whole application, removing the tags from it removes them
+	if app.Tags == nil {
+		app.Tags = []string{}
+	}
+
+	app.normalize()
+	if err := app.Validate(); err != nil {
+		return JobApplication{}, err
+	}
+
+	updated, err := m.update(id, current.Version, app)
+	if err != nil {
+		return JobApplication{}, err
+	}
+	return updated, m.Commit()
+}
+
+// update writes app to the row with the given ID, records the change and returns the new state
+func (m *mutation) update(id, expectedVersion int64, app NewJobApplication) (JobApplication, error) {
+	before, err := getJobApplication(m, id)
+	if err != nil {
+		return JobApplication{}, err
+	}
+
+	res, err := m.Exec(database.UpdateStmt, app.Company, app.Position, app.Link, app.Status, app.Notes, id, expectedVersion)
+	if err != nil {
+		return JobApplication{}, translateDBError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return JobApplication{}, err
+	}
+	if n == 0 {
+		return JobApplication{}, missingOrModified(m, id, expectedVersion)
+	}
+	if app.Tags != nil {
+		if err := setTags(m, id, app.Tags); err != nil {
+			return JobApplication{}, err
+		}
+	}
+	if app.JobDescription != nil {
+		if _, _, err := addJobDescription(m, id, *app.JobDescription); err != nil {
+			return JobApplication{}, err
+		}
 	}
-	defer stmt.Close()
 
-	_, err = stmt.Exec(id)
+	after, err := getJobApplication(m, id)
 	if err != nil {
+		return JobApplication{}, err
+	}
+	return after, m.record(ActionUpdated, &before, &after)
+}
+
+// missingOrModified explains why a write matched no rows: either the application does not
+// exist or its version is no longer the expected one
+func missingOrModified(q querier, id, expectedVersion int64) error {
+	current, err := getJobApplication(q, id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(current, expectedVersion); err != nil {
 		return err
 	}
+	return fmt.Errorf("job application %d was not modified", id)
+}
+
+func checkVersion(app JobApplication, expectedVersion int64) error {
+	if expectedVersion != 0 && app.Version != expectedVersion {
+		return fmt.Errorf("%w: job application %d is at version %d, expected %d", ErrPreconditionFailed, app.ID, app.Version, expectedVersion)
+	}
 	return nil
 }
 
-func (s *JobApplicationService) ImportJobApplicationsFromCSV(records [][]string) ([]JobApplication, error) {
-	stmt, err := s.db.Prepare(database.ImportStmt)
+// DeleteJobApplication moves the application to the trash, from where it can be restored until
+// it is purged. expectedVersion behaves as for UpdateJobApplication.
+func (s *JobApplicationService) DeleteJobApplication(id, expectedVersion int64) error {
+	m, err := s.begin()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer m.Rollback()
+
+	if _, err := m.transition(database.SoftDeleteStmt, ActionDeleted, id, expectedVersion); err != nil {
+		return err
+	}
+	return m.Commit()
+}
+
+// transition runs a single row write that takes (id, expectedVersion) as its arguments,
+// such as archiving or deleting, records it and returns the application's new state.
+// A miss is explained as either not found or a version mismatch.
+func (m *mutation) transition(stmt, action string, id, expectedVersion int64) (JobApplication, error) {
+	before, err := getJobApplication(m, id)
+	if err != nil {
+		return JobApplication{}, err
+	}
+
+	res, err := m.Exec(stmt, id, expectedVersion)
+	if err != nil {
+		return JobApplication{}, translateDBError(err)
 	}
-	defer stmt.Close()
 
+	n, err := res.RowsAffected()
+	if err != nil {
+		return JobApplication{}, err
+	}
+	if n == 0 {
+		return JobApplication{}, missingOrModified(m, id, expectedVersion)
+	}
+
+	after, err := getAnyJobApplication(m, id)
+	if err != nil {
+		return JobApplication{}, err
+	}
+	return after, m.record(action, &before, &after)
+}
+
+// ImportJobApplicationsFromCSV imports records in the format date,company,position,link,status,notes,tags
+// where tags are separated by semicolons.
+// Every row is validated before anything is written, and either all rows are imported or none.
+func (s *JobApplicationService) ImportJobApplicationsFromCSV(records [][]string) ([]JobApplication, error) {
 	var applications []JobApplication
+	var v validator
 	for i, record := range records {
-		if len(record) < 4 {
-			s.logger.Warn("Skipping invalid CSV record", "row", i+1, "fields", len(record))
-			continue // Skip invalid records
+		// Skip blank lines
+		if len(record) == 0 || (len(record) == 1 && strings.TrimSpace(record[0]) == "") {
+			continue
 		}
 
-		// CSV format: date,company,position,link,status,notes
-		dateStr := record[0]
-		company := record[1]
-		position := record[2]
-		link := ""
-		status := "applied" // default status
-		notes := ""
-
-		if len(record) > 2 {
-			link = record[3]
-		}
-		if len(record) > 3 {
-			status = strings.ToLower(strings.TrimSpace(record[4]))
-		}
-		if len(record) > 4 {
-			notes = record[5]
+		v.prefix = fmt.Sprintf("row %d: ", i+1)
+		if len(record) < 3 {
+			v.add("record", "expected at least date, company and position columns, got %d", len(record))
+			continue
 		}
 
-		// Parse the date string (YYYY-MM-DD) and convert to proper timestamp
-		var createdAt string
-		if dateStr != "" {
-			parsedDate, err := time.Parse("2006-01-02", strings.TrimSpace(dateStr))
-			if err != nil {
-				s.logger.Warn("Invalid date format, using current time", "row", i+1, "date", dateStr, "error", err)
-				createdAt = time.Now().Format(time.RFC3339Nano)
-			} else {
-				// Convert to RFC3339Nano format for consistency
-				createdAt = parsedDate.Format(time.RFC3339Nano)
+		field := func(n int) string {
+			if n < len(record) {
+				return record[n]
 			}
-		} else {
-			// Use current time if no date provided
-			createdAt = time.Now().Format(time.RFC3339Nano)
-		}
-
-		validStatuses := map[string]bool{
-			"applied":   true,
-			"interview": true,
-			"offer":     true,
-			"rejected":  true,
-		}
-		if !validStatuses[status] {
-			s.logger.Warn("Invalid status, using default", "row", i+1, "status", status)
-			status = "applied"
+			return ""
 		}
 
 		app := JobApplication{
 			NewJobApplication: NewJobApplication{
-				Company:  company,
-				Position: position,
-				Link:     link,
-				Status:   status,
-				Notes:    notes,
+				Company:  field(1),
+				Position: field(2),
+				Link:     field(3),
+				Status:   field(4),
+				Notes:    field(5),
+				Tags:     SplitTags(field(6)),
 			},
-			CreatedAt: createdAt,
+			CreatedAt: strings.TrimSpace(field(0)),
+			Version:   1,
+		}
+		app.normalize()
+
+		// Missing values fall back to defaults, anything present must be valid
+		if app.Status == "" {
+			app.Status = StatusApplied
+		}
+		if app.CreatedAt == "" {
+			app.CreatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+
+		app.validate(&v)
+		if t, ok := parseTimestamp(app.CreatedAt); ok {
+			// Convert to RFC3339Nano format for consistency
+			app.CreatedAt = t.UTC().Format(time.RFC3339Nano)
 		}
 
+		applications = append(applications, app)
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	// The whole import is undone as a single step
+	m, err := s.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer m.Rollback()
+	m.grouped()
+
+	stmt, err := m.Prepare(database.ImportStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	for i := range applications {
+		app := &applications[i]
 		s.logger.Debug("Importing job application", "company", app.Company, "position", app.Position, "status", app.Status)
 
 		res, err := stmt.Exec(app.Company, app.Position, app.Link, app.Status, app.Notes, app.CreatedAt)
 		if err != nil {
 			s.logger.Error("Failed to insert job application", "error", err, "company", app.Company, "position", app.Position)
-			return nil, err
+			return nil, translateDBError(err)
 		}
 
-		id, err := res.LastInsertId()
-		if err != nil {
+		if *app, err = m.created(res, app.Tags); err != nil {
 			return nil, err
 		}
-		app.ID = id
-
-		applications = append(applications, app)
 	}
 
+	if err := m.Commit(); err != nil {
+		return nil, err
+	}
 	return applications, nil
 }
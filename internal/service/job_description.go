@@ -0,0 +1,228 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+	"github.com/rafrdz/ctrl-alt-me/internal/diff"
+	"github.com/rafrdz/ctrl-alt-me/internal/markdown"
+)
+
+// Formats a job description can be submitted in
+const (
+	DescriptionFromText = "text"
+	DescriptionFromHTML = "html"
+)
+
+// Job description limits. HTML is allowed to be larger as most of it is markup.
+const (
+	MaxJobDescriptionLength     = 100000
+	MaxJobDescriptionHTMLLength = 1000000
+)
+
+// diffContext is the number of unchanged lines shown around every change of a unified diff
+const diffContext = 3
+
+// JobDescriptionInput is a job description as submitted: either pasted text, read as Markdown,
+// or the HTML of the job posting. Exactly one of the fields must be set.
+type JobDescriptionInput struct {
+	Text string `json:"text,omitempty"`
+	HTML string `json:"html,omitempty"`
+}
+
+// JobDescription is one version of the description of the job an application is for
+type JobDescription struct {
+	ApplicationID int64  `json:"application_id"`
+	Version       int64  `json:"version"`
+	Markdown      string `json:"markdown"`
+	// Source is the format the description was submitted in, "text" or "html"
+	Source    string `json:"source"`
+	CreatedAt string `json:"created_at"`
+}
+
+// JobDescriptionDiff compares two versions of a job description line by line
+type JobDescriptionDiff struct {
+	ApplicationID int64 `json:"application_id"`
+	// From is 0 when the diff starts from an empty description
+	From  int64       `json:"from"`
+	To    int64       `json:"to"`
+	Lines []diff.Line `json:"lines"`
+	// Unified is the same diff in the unified format, showing only the changed lines and their context
+	Unified string `json:"unified"`
+}
+
+func (in JobDescriptionInput) validate(v *validator, field string) {
+	text, html := strings.TrimSpace(in.Text), strings.TrimSpace(in.HTML)
+	switch {
+	case text == "" && html == "":
+		v.add(field, "must contain text or html")
+	case text != "" && html != "":
+		v.add(field, "must contain either text or html, not both")
+	}
+	v.maxLength(field+".text", in.Text, MaxJobDescriptionLength)
+	v.maxLength(field+".html", in.HTML, MaxJobDescriptionHTMLLength)
+}
+
+// markdown converts the description to sanitized Markdown
+func (in JobDescriptionInput) markdown() (md, source string) {
+	if strings.TrimSpace(in.HTML) != "" {
+		return markdown.FromHTML(in.HTML), DescriptionFromHTML
+	}
+	return markdown.Sanitize(in.Text), DescriptionFromText
+}
+
+func scanJobDescription(row scanner) (JobDescription, error) {
+	var d JobDescription
+	err := row.Scan(&d.ApplicationID, &d.Version, &d.Markdown, &d.Source, &d.CreatedAt)
+	return d, err
+}
+
+func getJobDescription(q querier, appID, version int64) (JobDescription, error) {
+	var row *sql.Row
+	if version == 0 {
+		row = q.QueryRow(database.SelectLatestJobDescriptionStmt, appID)
+	} else {
+		row = q.QueryRow(database.SelectJobDescriptionVersionStmt, appID, version)
+	}
+
+	d, err := scanJobDescription(row)
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && version == 0:
+		return JobDescription{}, fmt.Errorf("job application %d has no job description: %w", appID, ErrNotFound)
+	case errors.Is(err, sql.ErrNoRows):
+		return JobDescription{}, fmt.Errorf("job description version %d of job application %d %w", version, appID, ErrNotFound)
+	}
+	return d, err
+}
+
+// addJobDescription stores the description as the application's next version, unless it
+// converts to the same Markdown as the current version
+func addJobDescription(q querier, appID int64, in JobDescriptionInput) (description JobDescription, created bool, err error) {
+	md, source := in.markdown()
+
+	var v validator
+	v.maxLength("job_description", md, MaxJobDescriptionLength)
+	if md == "" {
+		v.add("job_description", "contains no text")
+	}
+	if err := v.err(); err != nil {
+		return JobDescription{}, false, err
+	}
+
+	current, err := getJobDescription(q, appID, 0)
+	switch {
+	case err == nil && current.Markdown == md:
+		return current, false, nil
+	case err != nil && !errors.Is(err, ErrNotFound):
+		return JobDescription{}, false, err
+	}
+
+	if _, err := q.Exec(database.InsertJobDescriptionStmt, appID, md, source); err != nil {
+		return JobDescription{}, false, translateDBError(err)
+	}
+	description, err = getJobDescription(q, appID, 0)
+	return description, true, err
+}
+
+// SetJobDescription stores a new version of the application's job description. Submitting a
+// description identical to the current one returns the current version with created set to false.
+func (s *JobApplicationService) SetJobDescription(appID int64, in JobDescriptionInput) (description JobDescription, created bool, err error) {
+	var v validator
+	in.validate(&v, "job_description")
+	if err := v.err(); err != nil {
+		return JobDescription{}, false, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return JobDescription{}, false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := getJobApplication(tx, appID); err != nil {
+		return JobDescription{}, false, err
+	}
+	description, created, err = addJobDescription(tx, appID, in)
+	if err != nil {
+		return JobDescription{}, false, err
+	}
+	return description, created, tx.Commit()
+}
+
+// GetJobDescription returns a version of the application's job description, or the current
+// one if version is 0
+func (s *JobApplicationService) GetJobDescription(appID, version int64) (JobDescription, error) {
+	if _, err := getJobApplication(s.db, appID); err != nil {
+		return JobDescription{}, err
+	}
+	return getJobDescription(s.db, appID, version)
+}
+
+// GetJobDescriptionVersions lists every version of the application's job description, newest first
+func (s *JobApplicationService) GetJobDescriptionVersions(appID int64) ([]JobDescription, error) {
+	if _, err := getJobApplication(s.db, appID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(database.SelectJobDescriptionsStmt, appID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	descriptions := []JobDescription{}
+	for rows.Next() {
+		d, err := scanJobDescription(rows)
+		if err != nil {
+			return nil, err
+		}
+		descriptions = append(descriptions, d)
+	}
+	return descriptions, rows.Err()
+}
+
+// DiffJobDescription compares two versions of the application's job description. A to of 0
+// stands for the current version and a from of 0 for the version before to, or an empty
+// description if to is the first version.
+func (s *JobApplicationService) DiffJobDescription(appID, from, to int64) (JobDescriptionDiff, error) {
+	var v validator
+	if from < 0 {
+		v.add("from", "must not be negative")
+	}
+	if to < 0 {
+		v.add("to", "must not be negative")
+	}
+	if err := v.err(); err != nil {
+		return JobDescriptionDiff{}, err
+	}
+
+	newer, err := s.GetJobDescription(appID, to)
+	if err != nil {
+		return JobDescriptionDiff{}, err
+	}
+	if from == 0 {
+		from = newer.Version - 1
+	}
+
+	var older JobDescription
+	if from > 0 {
+		if older, err = getJobDescription(s.db, appID, from); err != nil {
+			return JobDescriptionDiff{}, err
+		}
+	}
+
+	lines := diff.Lines(diff.SplitLines(older.Markdown), diff.SplitLines(newer.Markdown))
+	if lines == nil {
+		lines = []diff.Line{}
+	}
+	return JobDescriptionDiff{
+		ApplicationID: appID,
+		From:          from,
+		To:            newer.Version,
+		Lines:         lines,
+		Unified:       diff.Unified(fmt.Sprintf("version %d", from), fmt.Sprintf("version %d", newer.Version), lines, diffContext),
+	}, nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// Kinds of notifications, recorded so each is only sent once over each channel
+const (
+	NotificationFollowUp = "follow_up"
+	NotificationDigest   = "digest"
+)
+
+// ChannelWebhook records the follow-up reminders sent to webhooks as reminder_due events,
+// next to the channels of the notifiers
+const ChannelWebhook = "webhook"
+
+// Digest periods
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Digest summarizes the changes of the pipeline within a period
+type Digest struct {
+	Period string    `json:"period"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Changes lists every change in the order it was made, including those made by undo and redo
+	Changes       []Event `json:"changes"`
+	Created       int     `json:"created"`
+	StatusChanges int     `json:"status_changes"`
+	Deleted       int     `json:"deleted"`
+	// ByStatus counts the applications on the board by their current status
+	ByStatus map[string]int `json:"by_status"`
+}
+
+// Last returns the last day of the digest's period
+func (d Digest) Last() time.Time {
+	return d.To.AddDate(0, 0, -1)
+}
+
+// DigestPeriod returns the last complete period before now: the previous day, or for weekly
+// digests the previous week from Monday to Sunday (UTC)
+func DigestPeriod(period string, now time.Time) (from, to time.Time, err error) {
+	today := now.UTC().Truncate(day)
+	switch period {
+	case DigestDaily:
+		return today.AddDate(0, 0, -1), today, nil
+	case DigestWeekly:
+		to = weekStart(today)
+		return to.AddDate(0, 0, -7), to, nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("digest period must be %s or %s: %w", DigestDaily, DigestWeekly, ErrInvalidInput)
+}
+
+// GetDigest collects the changes made from from (inclusive) to to (exclusive)
+func (s *JobApplicationService) GetDigest(period string, from, to time.Time) (Digest, error) {
+	d := Digest{Period: period, From: from, To: to, Changes: []Event{}, ByStatus: map[string]int{}}
+
+	rows, err := s.db.Query(database.SelectChangesBetweenStmt, from.UTC().Format(time.DateTime), to.UTC().Format(time.DateTime))
+	if err != nil {
+		return Digest{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var before, after sql.NullString
+		var createdAt string
+		if err := rows.Scan(&before, &after, &createdAt); err != nil {
+			return Digest{}, err
+		}
+		var b, a *JobApplication
+		for _, snap := range []struct {
+			json sql.NullString
+			app  **JobApplication
+		}{{before, &b}, {after, &a}} {
+			if snap.json.Valid {
+				*snap.app = &JobApplication{}
+				if err := json.Unmarshal([]byte(snap.json.String), *snap.app); err != nil {
+					return Digest{}, err
+				}
+			}
+		}
+
+		e, ok := changeEvent(b, a)
+		if !ok {
+			continue
+		}
+		if t, ok := parseTimestamp(createdAt); ok {
+			e.OccurredAt = t.UTC().Format(time.RFC3339)
+		}
+		switch e.Type {
+		case EventCreated:
+			d.Created++
+		case EventStatusChanged:
+			d.StatusChanges++
+		case EventDeleted:
+			d.Deleted++
+		}
+		d.Changes = append(d.Changes, e)
+	}
+	if err := rows.Err(); err != nil {
+		return Digest{}, err
+	}
+	rows.Close()
+
+	apps, err := queryJobApplications(s.db, database.SelectAllStmt)
+	if err != nil {
+		return Digest{}, err
+	}
+	for _, app := range apps {
+		d.ByStatus[app.Status]++
+	}
+	return d, nil
+}
+
+// followUpKey identifies a follow-up reminder, so an application is reminded again if it
+// changes and then goes quiet once more
+func followUpKey(app JobApplication) string {
+	return fmt.Sprintf("%d@%s", app.ID, app.UpdatedAt)
+}
+
+// DueFollowUps lists the open applications that have not changed for afterDays, like
+// GetGhostedApplications, leaving out those a follow-up reminder was already sent for over channel
+func (s *JobApplicationService) DueFollowUps(channel string, afterDays int) ([]GhostedApplication, error) {
+	ghosted, err := s.GetGhostedApplications(afterDays)
+	if err != nil {
+		return nil, err
+	}
+	due := []GhostedApplication{}
+	for _, g := range ghosted {
+		sent, err := s.Notified(channel, NotificationFollowUp, followUpKey(g.JobApplication))
+		if err != nil {
+			return nil, err
+		}
+		if !sent {
+			due = append(due, g)
+		}
+	}
+	return due, nil
+}
+
+// MarkFollowUpsSent records that follow-up reminders were sent for the applications over channel
+func (s *JobApplicationService) MarkFollowUpsSent(channel string, apps []GhostedApplication) error {
+	for _, g := range apps {
+		if err := s.MarkNotified(channel, NotificationFollowUp, followUpKey(g.JobApplication)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Notified reports whether the notification identified by kind and key was sent over channel
+func (s *JobApplicationService) Notified(channel, kind, key string) (bool, error) {
+	var sent bool
+	err := s.db.QueryRow(database.SelectNotificationStmt, channel, kind, key).Scan(&sent)
+	return sent, err
+}
+
+// MarkNotified records that the notification identified by kind and key was sent over channel
+func (s *JobApplicationService) MarkNotified(channel, kind, key string) error {
+	_, err := s.db.Exec(database.InsertNotificationStmt, channel, kind, key)
+	return err
+}
+
+// QueueDueReminders queues a reminder_due webhook delivery for every application that became
+// due for a follow-up after afterDays without changes, see DueFollowUps, and returns how many
+// did. Each reminder is queued once, together with the record that it was sent.
+func (s *JobApplicationService) QueueDueReminders(afterDays int) (int, error) {
+	due, err := s.DueFollowUps(ChannelWebhook, afterDays)
+	if err != nil || len(due) == 0 {
+		return 0, err
+	}
+
+	m, err := s.begin()
+	if err != nil {
+		return 0, err
+	}
+	defer m.Rollback()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, g := range due {
+		app := g.JobApplication
+		e := Event{Type: EventReminderDue, OccurredAt: now, Application: &app, DaysSinceChange: g.DaysSinceChange}
+		if err := m.enqueueWebhooks(e); err != nil {
+			return 0, err
+		}
+		if _, err := m.Exec(database.InsertNotificationStmt, ChannelWebhook, NotificationFollowUp, followUpKey(app)); err != nil {
+			return 0, err
+		}
+	}
+	return len(due), m.Commit()
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// Columns of the activity report
+const (
+	ReportColumnDate          = "date"
+	ReportColumnCompany       = "company"
+	ReportColumnPosition      = "position"
+	ReportColumnContactMethod = "contact_method"
+	ReportColumnStatus        = "status"
+	ReportColumnLink          = "link"
+)
+
+// ReportColumns lists every column a report template can show, with its heading
+var ReportColumns = []ReportColumn{
+	{ReportColumnDate, "Date"},
+	{ReportColumnCompany, "Company"},
+	{ReportColumnPosition, "Position"},
+	{ReportColumnContactMethod, "Contact method"},
+	{ReportColumnStatus, "Status"},
+	{ReportColumnLink, "Link"},
+}
+
+// DefaultReportTemplate is used when no template is named, unless a template called "default"
+// has been saved
+var DefaultReportTemplate = ReportTemplate{
+	Name: "default",
+	ReportTemplateInput: ReportTemplateInput{
+		Title:   "Job search activity",
+		Columns: []string{ReportColumnDate, ReportColumnCompany, ReportColumnPosition, ReportColumnContactMethod, ReportColumnStatus},
+	},
+}
+
+// Report template limits
+const (
+	MaxReportTitleLength = 200
+	MaxReportTextLength  = 5000
+)
+
+var reportTemplateName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// ReportColumn is a column of the activity report
+type ReportColumn struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+}
+
+// ReportTemplateInput is what a report template is saved from. Header and Footer are Go text
+// templates (https://pkg.go.dev/text/template) executed with ReportFields, so they can mention
+// the period, e.g. "Claim 1234, week of {{.From}}".
+type ReportTemplateInput struct {
+	Title   string   `json:"title"`
+	Header  string   `json:"header"`
+	Footer  string   `json:"footer"`
+	Columns []string `json:"columns"`
+}
+
+// ReportTemplate is a saved layout of the activity report
+type ReportTemplate struct {
+	Name string `json:"name"`
+	ReportTemplateInput
+	UpdatedAt string `json:"updated_at,omitempty"`
+}
+
+// ReportFields are the values available to the header and footer of a report template
+type ReportFields struct {
+	From, To  string
+	Generated string
+	Count     int
+}
+
+// ReportEntry is one application listed in the activity report
+type ReportEntry struct {
+	ApplicationID int64  `json:"application_id"`
+	Date          string `json:"date"`
+	Company       string `json:"company"`
+	Position      string `json:"position"`
+	// ContactMethod is not tracked, it is derived from the site of the job link
+	ContactMethod string `json:"contact_method"`
+	Status        string `json:"status"`
+	Link          string `json:"link"`
+}
+
+// Value returns the entry's text for a report column
+func (e ReportEntry) Value(column string) string {
+	switch column {
+	case ReportColumnDate:
+		return e.Date
+	case ReportColumnCompany:
+		return e.Company
+	case ReportColumnPosition:
+		return e.Position
+	case ReportColumnContactMethod:
+		return e.ContactMethod
+	case ReportColumnStatus:
+		return e.Status
+	case ReportColumnLink:
+		return e.Link
+	}
+	return ""
+}
+
+// JobSearchReport lists the applications made within a date range, laid out by a template
+type JobSearchReport struct {
+	DateRange
+	Template  string         `json:"template"`
+	Title     string         `json:"title"`
+	Header    string         `json:"header"`
+	Footer    string         `json:"footer"`
+	Columns   []ReportColumn `json:"columns"`
+	Generated string         `json:"generated"`
+	Entries   []ReportEntry  `json:"entries"`
+}
+
+// normalize trims the template and lower-cases its column keys
+func (t *ReportTemplateInput) normalize() {
+	t.Title = strings.TrimSpace(t.Title)
+	t.Header = strings.TrimSpace(t.Header)
+	t.Footer = strings.TrimSpace(t.Footer)
+	for i, c := range t.Columns {
+		t.Columns[i] = strings.ToLower(strings.TrimSpace(c))
+	}
+}
+
+func (t ReportTemplateInput) validate(v *validator) {
+	if v.required("title", t.Title) {
+		v.maxLength("title", t.Title, MaxReportTitleLength)
+	}
+	for _, f := range []struct{ field, text string }{{"header", t.Header}, {"footer", t.Footer}} {
+		v.maxLength(f.field, f.text, MaxReportTextLength)
+		// Executing with empty fields also catches references to fields that don't exist
+		if _, err := renderReportText(f.text, ReportFields{}); err != nil {
+			v.add(f.field, "is not a valid template: %v", err)
+		}
+	}
+	if len(t.Columns) == 0 {
+		v.add("columns", "must list at least one column")
+	}
+	for i, c := range t.Columns {
+		if !slices.ContainsFunc(ReportColumns, func(col ReportColumn) bool { return col.Key == c }) {
+			v.add(fmt.Sprintf("columns[%d]", i), "must be one of %s", reportColumnKeys())
+		} else if slices.Index(t.Columns, c) != i {
+			v.add(fmt.Sprintf("columns[%d]", i), "is listed more than once")
+		}
+	}
+}
+
+func reportColumnKeys() string {
+	keys := make([]string, len(ReportColumns))
+	for i, c := range ReportColumns {
+		keys[i] = c.Key
+	}
+	return strings.Join(keys, ", ")
+}
+
+// renderReportText executes a header or footer template
+func renderReportText(text string, fields ReportFields) (string, error) {
+	t, err := template.New("").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, fields); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func scanReportTemplate(row scanner) (ReportTemplate, error) {
+	var t ReportTemplate
+	var columns string
+	if err := row.Scan(&t.Name, &t.Title, &t.Header, &t.Footer, &columns, &t.UpdatedAt); err != nil {
+		return ReportTemplate{}, err
+	}
+	t.Columns = strings.Split(columns, ",")
+	return t, nil
+}
+
+// GetReportTemplates lists the saved report templates
+func (s *JobApplicationService) GetReportTemplates() ([]ReportTemplate, error) {
+	rows, err := s.db.Query(database.SelectReportTemplatesStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []ReportTemplate{}
+	for rows.Next() {
+		t, err := scanReportTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	return templates, rows.Err()
+}
+
+// GetReportTemplate returns the named template, or DefaultReportTemplate for "default" or an
+// empty name unless it was replaced
+func (s *JobApplicationService) GetReportTemplate(name string) (ReportTemplate, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultReportTemplate.Name
+	}
+	t, err := scanReportTemplate(s.db.QueryRow(database.SelectReportTemplateStmt, name))
+	if errors.Is(err, sql.ErrNoRows) && name == DefaultReportTemplate.Name {
+		return DefaultReportTemplate, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return ReportTemplate{}, fmt.Errorf("report template %q: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return ReportTemplate{}, err
+	}
+	return t, nil
+}
+
+// SetReportTemplate saves a report template under name, replacing any earlier one
+func (s *JobApplicationService) SetReportTemplate(name string, in ReportTemplateInput) (ReportTemplate, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	in.normalize()
+	var v validator
+	if !reportTemplateName.MatchString(name) {
+		v.add("name", "must be 1 to 50 lower-case letters, digits, dashes or underscores")
+	}
+	in.validate(&v)
+	if err := v.err(); err != nil {
+		return ReportTemplate{}, err
+	}
+
+	if _, err := s.db.Exec(database.UpsertReportTemplateStmt, name, in.Title, in.Header, in.Footer, strings.Join(in.Columns, ",")); err != nil {
+		return ReportTemplate{}, translateDBError(err)
+	}
+	return s.GetReportTemplate(name)
+}
+
+// DeleteReportTemplate removes a saved report template. Deleting "default" restores DefaultReportTemplate.
+func (s *JobApplicationService) DeleteReportTemplate(name string) error {
+	res, err := s.db.Exec(database.DeleteReportTemplateStmt, strings.ToLower(strings.TrimSpace(name)))
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("report template %q: %w", name, ErrNotFound)
+	}
+	return nil
+}
+
+// contactMethod describes how an application was most likely made. How one applied is not
+// recorded, so it is inferred from the site of the job link.
+func contactMethod(link string) string {
+	if source := Source(link); source != "" {
+		return "Online (" + source + ")"
+	}
+	return ""
+}
+
+// GetJobSearchReport lists the applications created within r, by default the current week up to
+// today, laid out by the named report template
+func (s *JobApplicationService) GetJobSearchReport(r DateRange, templateName string) (JobSearchReport, error) {
+	var v validator
+	r.normalize(&v)
+	if err := v.err(); err != nil {
+		return JobSearchReport{}, err
+	}
+
+	now := time.Now().UTC()
+	if r.To == "" {
+		r.To = now.Format(time.DateOnly)
+	}
+	to, _ := time.Parse(time.DateOnly, r.To)
+	if r.From == "" {
+		r.From = weekStart(to).Format(time.DateOnly)
+	}
+	from, _ := time.Parse(time.DateOnly, r.From)
+	if from.After(to) {
+		v.add("from", "must not be after to")
+	} else if to.Sub(from) >= MaxActivityDays*day {
+		v.add("to", "must be less than %d days after from", MaxActivityDays)
+	}
+	if err := v.err(); err != nil {
+		return JobSearchReport{}, err
+	}
+
+	tmpl, err := s.GetReportTemplate(templateName)
+	if err != nil {
+		return JobSearchReport{}, err
+	}
+
+	applications, err := queryJobApplications(s.db, database.SelectCreatedBetweenStmt, r.From, r.To)
+	if err != nil {
+		return JobSearchReport{}, err
+	}
+
+	report := JobSearchReport{
+		DateRange: r,
+		Template:  tmpl.Name,
+		Title:     tmpl.Title,
+		Columns:   []ReportColumn{},
+		Generated: now.Format(time.DateOnly),
+		Entries:   []ReportEntry{},
+	}
+	for _, c := range tmpl.Columns {
+		if i := slices.IndexFunc(ReportColumns, func(col ReportColumn) bool { return col.Key == c }); i >= 0 {
+			report.Columns = append(report.Columns, ReportColumns[i])
+		}
+	}
+	for _, app := range applications {
+		date := app.CreatedAt
+		if t, ok := parseTimestamp(app.CreatedAt); ok {
+			date = t.UTC().Format(time.DateOnly)
+		}
+		report.Entries = append(report.Entries, ReportEntry{
+			ApplicationID: app.ID,
+			Date:          date,
+			Company:       app.Company,
+			Position:      app.Position,
+			ContactMethod: contactMethod(app.Link),
+			Status:        strings.ToUpper(app.Status[:1]) + app.Status[1:],
+			Link:          app.Link,
+		})
+	}
+
+	fields := ReportFields{From: r.From, To: r.To, Generated: report.Generated, Count: len(report.Entries)}
+	if report.Header, err = renderReportText(tmpl.Header, fields); err != nil {
+		return JobSearchReport{}, fmt.Errorf("rendering header of report template %q: %w", tmpl.Name, err)
+	}
+	if report.Footer, err = renderReportText(tmpl.Footer, fields); err != nil {
+		return JobSearchReport{}, fmt.Errorf("rendering footer of report template %q: %w", tmpl.Name, err)
+	}
+	return report, nil
+}
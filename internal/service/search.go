@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+	"github.com/rafrdz/ctrl-alt-me/internal/extract"
+)
+
+// Text extraction states of an attachment
+const (
+	TextPending     = "pending"
+	TextExtracted   = "extracted"
+	TextUnsupported = "unsupported"
+	TextFailed      = "failed"
+)
+
+// extractionBatchSize is how many attachments the extractor picks up per query
+const extractionBatchSize = 10
+
+// Search limits
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+	maxSearchTerms     = 16
+)
+
+// SearchResult is an application matching a search, with the matching text highlighted
+type SearchResult struct {
+	ApplicationID int64  `json:"application_id"`
+	Company       string `json:"company"`
+	Position      string `json:"position"`
+	Status        string `json:"status"`
+	// Source is "application" for a match in the company, position or notes, or "attachment"
+	Source       string `json:"source"`
+	AttachmentID int64  `json:"attachment_id,omitempty"`
+	Filename     string `json:"filename,omitempty"`
+	// Snippet is an excerpt of the matching text with the matched terms in **bold**
+	Snippet string `json:"snippet"`
+}
+
+// Search runs a full-text search over application notes and attachment text. Every word of
+// query must match, as a prefix, for a result to be returned.
+func (s *JobApplicationService) Search(query string, limit int) ([]SearchResult, error) {
+	var v validator
+	match := searchMatch(query)
+	if match == "" {
+		v.add("q", "must contain at least one word")
+	}
+	if limit == 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit < 1 || limit > MaxSearchLimit {
+		v.add("limit", "must be between 1 and %d", MaxSearchLimit)
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(database.SearchStmt, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var r SearchResult
+		var updatedAt string
+		if err := rows.Scan(&r.ApplicationID, &r.Company, &r.Position, &r.Status, &r.Source, &r.AttachmentID, &r.Filename, &r.Snippet, &updatedAt); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// searchMatch turns free text into an FTS query matching every word as a prefix. Words are
+// lower-cased so they are never taken for the AND, OR and NOT operators.
+func searchMatch(query string) string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+	for i, w := range words {
+		words[i] = w + "*"
+	}
+	return strings.Join(words, " ")
+}
+
+// GetAttachmentText returns the text extracted from an attachment
+func (s *JobApplicationService) GetAttachmentText(appID, id int64) (string, error) {
+	a, err := s.GetAttachment(appID, id)
+	if err != nil {
+		return "", err
+	}
+	if a.TextStatus != TextExtracted {
+		return "", fmt.Errorf("text of attachment %d is %s: %w", id, a.TextStatus, ErrNotFound)
+	}
+
+	var text string
+	if err := s.db.QueryRow(database.SelectAttachmentTextStmt, id).Scan(&text); err != nil {
+		return "", err
+	}
+	return text, nil
+}
+
+func (s *JobApplicationService) wakeTextExtractor() {
+	select {
+	case s.extractWake <- struct{}{}:
+	default:
+	}
+}
+
+// RunTextExtractor extracts the text of new attachments for search until ctx is cancelled.
+// It runs whenever an attachment is uploaded and every interval to pick up anything missed.
+func (s *JobApplicationService) RunTextExtractor(ctx context.Context, interval time.Duration) {
+	s.logger.Info("Text extractor started", "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for s.extractPending() {
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Text extractor stopped")
+			return
+		case <-ticker.C:
+		case <-s.extractWake:
+		}
+	}
+}
+
+// extractPending processes a batch of pending attachments and reports whether a full batch was found
+func (s *JobApplicationService) extractPending() bool {
+	rows, err := s.db.Query(database.SelectPendingAttachmentsStmt, extractionBatchSize)
+	if err != nil {
+		s.logger.Error("Failed to list attachments pending text extraction", "error", err)
+		return false
+	}
+	var pending []Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			s.logger.Error("Failed to read attachment pending text extraction", "error", err)
+			break
+		}
+		pending = append(pending, a)
+	}
+	rows.Close()
+
+	for _, a := range pending {
+		if err := s.extractAttachment(a); err != nil {
+			s.logger.Error("Failed to store extracted text", "attachment", a.ID, "error", err)
+			return false
+		}
+	}
+	return len(pending) == extractionBatchSize
+}
+
+// extractAttachment indexes the text of an attachment. The file name is indexed even when
+// no text can be extracted.
+func (s *JobApplicationService) extractAttachment(a Attachment) error {
+	status, text := TextExtracted, ""
+	if !extract.Supported(a.ContentType) {
+		status = TextUnsupported
+	} else if data, err := s.readBlob(a.SHA256); err != nil {
+		s.logger.Warn("Failed to read attachment for text extraction", "attachment", a.ID, "error", err)
+		status = TextFailed
+	} else if text, err = s.extractText(a, data); err != nil {
+		if errors.Is(err, extract.ErrUnsupported) {
+			status = TextUnsupported
+		} else {
+			status = TextFailed
+		}
+		s.logger.Warn("Failed to extract attachment text", "attachment", a.ID, "error", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(database.DeleteAttachmentTextStmt, a.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(database.InsertAttachmentTextStmt, a.ID, a.Filename, text); err != nil {
+		return err
+	}
+	res, err := tx.Exec(database.SetAttachmentTextStatusStmt, status, a.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		// The attachment was deleted meanwhile
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.logger.Debug("Indexed attachment text", "attachment", a.ID, "status", status, "length", len(text))
+	return nil
+}
+
+// extractText extracts the text of an attachment. A panic in an extractor fails the attachment
+// instead of the process, which would otherwise crash again on every start as the attachment
+// stays pending.
+func (s *JobApplicationService) extractText(a Attachment, data []byte) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("Text extraction panicked", "attachment", a.ID, "panic", r, "stack", string(debug.Stack()))
+			text, err = "", fmt.Errorf("extracting text panicked: %v", r)
+		}
+	}()
+	return extract.Text(a.ContentType, data)
+}
+
+func (s *JobApplicationService) readBlob(hash string) ([]byte, error) {
+	store, err := s.attachmentStore()
+	if err != nil {
+		return nil, err
+	}
+	f, err := store.Open(hash)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
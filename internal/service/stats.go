@@ -0,0 +1,228 @@
+package service
+
+import (
+	"cmp"
+	"math"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// Groupings of the funnel statistics
+const (
+	GroupByTag     = "tag"
+	GroupBySource  = "source"
+	GroupByCompany = "company"
+)
+
+// FunnelGroupings lists every accepted grouping of the funnel
+var FunnelGroupings = []string{GroupByTag, GroupBySource, GroupByCompany}
+
+// FunnelStages are the steps of the job search funnel, in order
+var FunnelStages = []string{StatusApplied, StatusInterview, StatusOffer}
+
+// DateRange limits statistics to applications created between From and To, both inclusive
+// dates in the YYYY-MM-DD format (UTC). Either end may be empty to leave the range open.
+type DateRange struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// normalize reduces both ends of the range to plain dates and reports unparsable ones
+func (r *DateRange) normalize(v *validator) {
+	for _, end := range []struct {
+		field string
+		value *string
+	}{{"from", &r.From}, {"to", &r.To}} {
+		if *end.value == "" {
+			continue
+		}
+		t, ok := parseTimestamp(*end.value)
+		if !ok {
+			v.add(end.field, "must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+			continue
+		}
+		*end.value = t.UTC().Format(time.DateOnly)
+	}
+	if r.From != "" && r.To != "" && r.From > r.To {
+		v.add("to", "must not be before from")
+	}
+}
+
+// FunnelStage is the number of applications that reached a stage of the funnel
+type FunnelStage struct {
+	Stage string `json:"stage"`
+	Count int    `json:"count"`
+	// ConversionPercent is the percentage (0 to 100) of the applications at the previous stage
+	// that reached this one
+	ConversionPercent float64 `json:"conversion_percent"`
+	// OverallPercent is the percentage (0 to 100) of all applications that reached this stage
+	OverallPercent float64 `json:"overall_percent"`
+}
+
+// Funnel shows how far a set of applications got
+type Funnel struct {
+	// Key is the tag, source or company the funnel is limited to, empty for applications without one
+	Key          string         `json:"key"`
+	Applications int            `json:"applications"`
+	Stages       []FunnelStage  `json:"stages"`
+	ByStatus     map[string]int `json:"by_status"`
+}
+
+// FunnelReport is the funnel of every application in a date range and, when grouped, of
+// every tag, source or company
+type FunnelReport struct {
+	DateRange
+	GroupBy string   `json:"group_by,omitempty"`
+	Total   Funnel   `json:"total"`
+	Groups  []Funnel `json:"groups,omitempty"`
+}
+
+// funnelEntry is an application as counted by the funnel
+type funnelEntry struct {
+	id                   int64
+	company, link        string
+	status               string
+	interviewed, offered bool
+}
+
+func newFunnel(key string) Funnel {
+	f := Funnel{Key: key, Stages: make([]FunnelStage, len(FunnelStages)), ByStatus: map[string]int{}}
+	for i, stage := range FunnelStages {
+		f.Stages[i].Stage = stage
+	}
+	for _, st := range ValidStatuses {
+		f.ByStatus[st] = 0
+	}
+	return f
+}
+
+func (f *Funnel) add(e funnelEntry) {
+	f.Applications++
+	f.ByStatus[e.status]++
+	f.Stages[0].Count++
+	if e.interviewed {
+		f.Stages[1].Count++
+	}
+	if e.offered {
+		f.Stages[2].Count++
+	}
+}
+
+func (f *Funnel) computePercentages() {
+	for i := range f.Stages {
+		st := &f.Stages[i]
+		if f.Applications > 0 {
+			st.OverallPercent = percent(st.Count, f.Applications)
+		}
+		if i == 0 {
+			st.ConversionPercent = st.OverallPercent
+		} else if prev := f.Stages[i-1].Count; prev > 0 {
+			st.ConversionPercent = percent(st.Count, prev)
+		}
+	}
+}
+
+// percent returns n as a percentage of total, rounded to one decimal
+func percent(n, total int) float64 {
+	return math.Round(float64(n)*1000/float64(total)) / 10
+}
+
+// Source returns where an application was found: the host of its link without a leading
+// "www.", or "" if it has no link
+func Source(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// GetFunnel counts how many of the applications created within r reached each stage of the
+// funnel. An application counts as having reached a stage if its status is, or ever was, that
+// stage or a later one. groupBy, if not empty, also breaks the funnel down by tag, source or
+// company; applications with several tags count towards each of them.
+func (s *JobApplicationService) GetFunnel(r DateRange, groupBy string) (FunnelReport, error) {
+	var v validator
+	r.normalize(&v)
+	groupBy = strings.ToLower(strings.TrimSpace(groupBy))
+	if groupBy != "" {
+		v.oneOf("group_by", groupBy, FunnelGroupings)
+	}
+	if err := v.err(); err != nil {
+		return FunnelReport{}, err
+	}
+
+	rows, err := s.db.Query(database.FunnelStmt, r.From, r.To)
+	if err != nil {
+		return FunnelReport{}, err
+	}
+	var entries []funnelEntry
+	for rows.Next() {
+		var e funnelEntry
+		if err := rows.Scan(&e.id, &e.company, &e.link, &e.status, &e.interviewed, &e.offered); err != nil {
+			rows.Close()
+			return FunnelReport{}, err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return FunnelReport{}, err
+	}
+
+	var tags map[int64][]string
+	if groupBy == GroupByTag {
+		if tags, err = applicationTags(s.db); err != nil {
+			return FunnelReport{}, err
+		}
+	}
+
+	report := FunnelReport{DateRange: r, GroupBy: groupBy, Total: newFunnel("")}
+	groups := map[string]*Funnel{}
+	addTo := func(key string, e funnelEntry) {
+		g, ok := groups[strings.ToLower(key)]
+		if !ok {
+			f := newFunnel(key)
+			g = &f
+			groups[strings.ToLower(key)] = g
+		}
+		g.add(e)
+	}
+
+	for _, e := range entries {
+		report.Total.add(e)
+		switch groupBy {
+		case GroupByTag:
+			if len(tags[e.id]) == 0 {
+				addTo("", e)
+			}
+			for _, t := range tags[e.id] {
+				addTo(t, e)
+			}
+		case GroupBySource:
+			addTo(Source(e.link), e)
+		case GroupByCompany:
+			addTo(e.company, e)
+		}
+	}
+
+	report.Total.computePercentages()
+	if groupBy != "" {
+		report.Groups = []Funnel{}
+		for _, g := range groups {
+			g.computePercentages()
+			report.Groups = append(report.Groups, *g)
+		}
+		slices.SortFunc(report.Groups, func(a, b Funnel) int {
+			if a.Applications != b.Applications {
+				return b.Applications - a.Applications
+			}
+			return cmp.Compare(strings.ToLower(a.Key), strings.ToLower(b.Key))
+		})
+	}
+	return report, nil
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// Tag limits enforced by validation
+const (
+	MaxTagLength          = 50
+	MaxTagsPerApplication = 20
+)
+
+// tagSeparators may not appear in tag names since they separate tags in CSV files and query strings
+const tagSeparators = ",;"
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Values for ListOptions.TagMatch
+const (
+	TagMatchAll = "all"
+	TagMatchAny = "any"
+)
+
+type NewTag struct {
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type Tag struct {
+	ID int64 `json:"id"`
+	NewTag
+	CreatedAt string `json:"created_at"`
+	// Applications is the number of applications carrying the tag
+	Applications int `json:"applications"`
+}
+
+func (t *NewTag) normalize() {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Color = strings.ToLower(strings.TrimSpace(t.Color))
+}
+
+// Validate returns a *ValidationError listing every invalid field, or nil
+func (t NewTag) Validate() error {
+	var v validator
+	v.tag("name", t.Name)
+	if t.Color != "" && !colorPattern.MatchString(t.Color) {
+		v.add("color", "must be a hex color such as #1f6feb")
+	}
+	return v.err()
+}
+
+func (v *validator) tag(field, name string) {
+	if !v.required(field, name) {
+		return
+	}
+	v.maxLength(field, name, MaxTagLength)
+	if strings.ContainsAny(name, tagSeparators) {
+		v.add(field, "must not contain any of %q", tagSeparators)
+	}
+}
+
+func (v *validator) tags(field string, names []string) {
+	if len(names) > MaxTagsPerApplication {
+		v.add(field, "must contain at most %d tags", MaxTagsPerApplication)
+	}
+	for i, name := range names {
+		v.tag(fmt.Sprintf("%s[%d]", field, i), name)
+	}
+}
+
+// normalizeTags trims tag names and drops empty and duplicate (ignoring case) entries
+func normalizeTags(names []string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		tags = append(tags, name)
+	}
+	return tags
+}
+
+// SplitTags parses a tag list as written in CSV files and query strings, separated by ; or ,
+func SplitTags(s string) []string {
+	return normalizeTags(strings.FieldsFunc(s, func(r rune) bool {
+		return strings.ContainsRune(tagSeparators, r)
+	}))
+}
+
+// setTags replaces the tags of an application, creating tags that do not exist yet
+func setTags(q querier, appID int64, names []string) error {
+	if _, err := q.Exec(database.ClearApplicationTagsStmt, appID); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := addTag(q, appID, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addTag(q querier, appID int64, name string) error {
+	if _, err := q.Exec(database.EnsureTagStmt, name); err != nil {
+		return translateDBError(err)
+	}
+	_, err := q.Exec(database.AddApplicationTagStmt, appID, name)
+	return translateDBError(err)
+}
+
+// loadTags fills in the tags of the given applications
+func loadTags(q querier, apps []JobApplication) error {
+	if len(apps) == 0 {
+		return nil
+	}
+
+	index := make(map[int64]int, len(apps))
+	for i := range apps {
+		apps[i].Tags = []string{}
+		index[apps[i].ID] = i
+	}
+
+	query, args := database.SelectApplicationTagsStmt, []any{}
+	if len(apps) == 1 {
+		query, args = database.SelectApplicationTagsByIDStmt, []any{apps[0].ID}
+	}
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var appID int64
+		var name string
+		if err := rows.Scan(&appID, &name); err != nil {
+			return err
+		}
+		if i, ok := index[appID]; ok {
+			apps[i].Tags = append(apps[i].Tags, name)
+		}
+	}
+	return rows.Err()
+}
+
+// applicationTags returns the tag names of every application by ID
+func applicationTags(q querier) (map[int64][]string, error) {
+	rows, err := q.Query(database.SelectApplicationTagsStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := map[int64][]string{}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		tags[id] = append(tags[id], name)
+	}
+	return tags, rows.Err()
+}
+
+// tagFilter returns the SQL condition and arguments restricting a list to the tags in opts
+func tagFilter(opts ListOptions) (string, []any, error) {
+	tags := normalizeTags(opts.Tags)
+	if len(tags) == 0 {
+		return "", nil, nil
+	}
+
+	var v validator
+	v.oneOf("tag_match", opts.TagMatch, []string{"", TagMatchAll, TagMatchAny})
+	if err := v.err(); err != nil {
+		return "", nil, err
+	}
+
+	args := make([]any, 0, len(tags)+1)
+	for _, t := range tags {
+		args = append(args, t)
+	}
+	required := len(tags)
+	if opts.TagMatch == TagMatchAny {
+		required = 1
+	}
+	args = append(args, required)
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tags)), ", ")
+	return fmt.Sprintf(database.TaggedWithFilter, placeholders), args, nil
+}
+
+func scanTag(row scanner) (Tag, error) {
+	var t Tag
+	err := row.Scan(&t.ID, &t.Name, &t.Color, &t.CreatedAt, &t.Applications)
+	return t, err
+}
+
+// GetTags lists every tag with the number of applications using it
+func (s *JobApplicationService) GetTags() ([]Tag, error) {
+	rows, err := s.db.Query(database.SelectTagsStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		t, err := scanTag(rows)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+func (s *JobApplicationService) GetTagByID(id int64) (Tag, error) {
+	t, err := scanTag(s.db.QueryRow(database.SelectTagByIDStmt, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Tag{}, notFound("tag", id)
+	}
+	return t, err
+}
+
+// CreateTag creates a tag, failing with ErrConflict if the name is taken (ignoring case)
+func (s *JobApplicationService) CreateTag(tag NewTag) (Tag, error) {
+	tag.normalize()
+	if err := tag.Validate(); err != nil {
+		return Tag{}, err
+	}
+
+	res, err := s.db.Exec(database.InsertTagStmt, tag.Name, tag.Color)
+	if err != nil {
+		return Tag{}, translateDBError(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Tag{}, err
+	}
+	return s.GetTagByID(id)
+}
+
+// UpdateTag renames or recolors a tag
+func (s *JobApplicationService) UpdateTag(id int64, tag NewTag) (Tag, error) {
+	tag.normalize()
+	if err := tag.Validate(); err != nil {
+		return Tag{}, err
+	}
+
+	res, err := s.db.Exec(database.UpdateTagStmt, tag.Name, tag.Color, id)
+	if err != nil {
+		return Tag{}, translateDBError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return Tag{}, err
+	}
+	if n == 0 {
+		return Tag{}, notFound("tag", id)
+	}
+	return s.GetTagByID(id)
+}
+
+// DeleteTag deletes a tag and removes it from every application
+func (s *JobApplicationService) DeleteTag(id int64) error {
+	res, err := s.db.Exec(database.DeleteTagStmt, id)
+	if err != nil {
+		return translateDBError(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound("tag", id)
+	}
+	return nil
+}
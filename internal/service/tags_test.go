@@ -0,0 +1,67 @@
+package service
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/jsonpatch"
+)
+
+func wantTags(t *testing.T, app JobApplication, tags ...string) {
+	t.Helper()
+	if tags == nil {
+		tags = []string{}
+	}
+	if !slices.Equal(app.Tags, tags) {
+		t.Errorf("tags = %q, want %q", app.Tags, tags)
+	}
+}
+
+func TestUpdateKeepsTagsWhenLeftOut(t *testing.T) {
+	svc := newTestService(t)
+	app := mustCreate(t, svc, NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusApplied, Tags: []string{"remote", "referral"}})
+	wantTags(t, app, "referral", "remote")
+
+	// An older client that does not know about tags
+	in := NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusInterview}
+	updated, err := svc.UpdateJobApplication(app.ID, app.Version, in)
+	if err != nil {
+		t.Fatalf("UpdateJobApplication: %v", err)
+	}
+	wantTags(t, updated, "referral", "remote")
+
+	in.Tags = []string{"Remote", " "}
+	updated, err = svc.UpdateJobApplication(app.ID, updated.Version, in)
+	if err != nil {
+		t.Fatalf("UpdateJobApplication: %v", err)
+	}
+	wantTags(t, updated, "remote")
+
+	in.Tags = []string{}
+	updated, err = svc.UpdateJobApplication(app.ID, updated.Version, in)
+	if err != nil {
+		t.Fatalf("UpdateJobApplication: %v", err)
+	}
+	wantTags(t, updated)
+}
+
+func TestPatchRemovingTagsClearsThem(t *testing.T) {
+	svc := newTestService(t)
+	app := mustCreate(t, svc, NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusApplied, Tags: []string{"remote"}})
+
+	patched, err := svc.PatchJobApplication(app.ID, app.Version, func(doc []byte) ([]byte, error) {
+		return jsonpatch.MergePatch(doc, []byte(`{"status":"interview"}`))
+	})
+	if err != nil {
+		t.Fatalf("PatchJobApplication: %v", err)
+	}
+	wantTags(t, patched, "remote")
+
+	patched, err = svc.PatchJobApplication(app.ID, patched.Version, func(doc []byte) ([]byte, error) {
+		return jsonpatch.MergePatch(doc, []byte(`{"tags":null}`))
+	})
+	if err != nil {
+		t.Fatalf("PatchJobApplication: %v", err)
+	}
+	wantTags(t, patched)
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"database/sql"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// Ghosted application thresholds, in days without any change
+const (
+	DefaultGhostedAfterDays = 21
+	MaxGhostedAfterDays     = 3650
+)
+
+// day is the unit durations are reported in
+const day = 24 * time.Hour
+
+// DurationStats summarizes a set of durations, in days
+type DurationStats struct {
+	Count      int     `json:"count"`
+	MedianDays float64 `json:"median_days"`
+	P90Days    float64 `json:"p90_days"`
+	MeanDays   float64 `json:"mean_days"`
+}
+
+// ResponseTimes reports how long companies take to respond to applications
+type ResponseTimes struct {
+	DateRange
+	// Responded summarizes the days from applying to the first response (an interview,
+	// offer or rejection) of the applications that got one
+	Responded DurationStats `json:"responded"`
+	// Awaiting counts the applications that never got a response, including ghosted ones
+	Awaiting int `json:"awaiting"`
+	// WaitingSoFar summarizes how long the open applications without a response have waited
+	WaitingSoFar DurationStats `json:"waiting_so_far"`
+	// ResponseRate is the share (0 to 1) of applications that got a response
+	ResponseRate float64 `json:"response_rate"`
+}
+
+// StageTime reports how long applications stay in a status
+type StageTime struct {
+	Status string `json:"status"`
+	// Completed summarizes the stays of applications that have since moved on
+	Completed DurationStats `json:"completed"`
+	// Current summarizes the time spent so far by applications still in the status
+	Current DurationStats `json:"current"`
+}
+
+// GhostedApplication is an open application that has not changed for a while
+type GhostedApplication struct {
+	JobApplication
+	DaysSinceChange float64 `json:"days_since_change"`
+}
+
+// statusPeriod is a stretch of time an application spent in one status
+type statusPeriod struct {
+	status     string
+	start, end time.Time
+	ongoing    bool
+}
+
+// timeline is the status history of an application
+type timeline struct {
+	id      int64
+	created time.Time
+	periods []statusPeriod
+}
+
+// statusTimelines rebuilds the status history of the applications created within r from the
+// change log. Applications created before the log existed count as having had their first
+// logged status, or their current one, since creation.
+func statusTimelines(q querier, r DateRange, now time.Time) ([]timeline, error) {
+	rows, err := q.Query(database.StatusTimelineStmt, r.From, r.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var timelines []timeline
+	var t *timeline
+	for rows.Next() {
+		var id int64
+		var status, createdAt string
+		var changedAt, before, after sql.NullString
+		if err := rows.Scan(&id, &status, &createdAt, &changedAt, &before, &after); err != nil {
+			return nil, err
+		}
+
+		if t == nil || t.id != id {
+			created, _ := parseTimestamp(createdAt)
+			initial := status
+			switch {
+			case before.Valid:
+				initial = before.String
+			case after.Valid:
+				initial = after.String
+			}
+			timelines = append(timelines, timeline{id: id, created: created, periods: []statusPeriod{{status: initial, start: created}}})
+			t = &timelines[len(timelines)-1]
+		}
+
+		last := &t.periods[len(t.periods)-1]
+		if !after.Valid || after.String == last.status {
+			continue
+		}
+		at, ok := parseTimestamp(changedAt.String)
+		if !ok {
+			continue
+		}
+		// Imported applications may have been created before their first change was logged
+		at = maxTime(at, last.start)
+		last.end = at
+		t.periods = append(t.periods, statusPeriod{status: after.String, start: at})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range timelines {
+		last := &timelines[i].periods[len(timelines[i].periods)-1]
+		last.end, last.ongoing = maxTime(now, last.start), true
+	}
+	return timelines, nil
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// summarize computes the statistics of durations given in days
+func summarize(days []float64) DurationStats {
+	stats := DurationStats{Count: len(days)}
+	if len(days) == 0 {
+		return stats
+	}
+	slices.Sort(days)
+	var sum float64
+	for _, d := range days {
+		sum += d
+	}
+	stats.MedianDays = roundDays(percentile(days, 0.5))
+	stats.P90Days = roundDays(percentile(days, 0.9))
+	stats.MeanDays = roundDays(sum / float64(len(days)))
+	return stats
+}
+
+// percentile interpolates the p-th percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	pos := p * float64(len(sorted)-1)
+	lower := int(math.Floor(pos))
+	upper := int(math.Ceil(pos))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(pos-float64(lower))
+}
+
+func roundDays(d float64) float64 {
+	return math.Round(d*100) / 100
+}
+
+func days(d time.Duration) float64 {
+	return d.Hours() / 24
+}
+
+// GetResponseTimes reports how long it took to get a first response to the applications
+// created within r. Only applications that started out as applied are counted.
+func (s *JobApplicationService) GetResponseTimes(r DateRange) (ResponseTimes, error) {
+	var v validator
+	r.normalize(&v)
+	if err := v.err(); err != nil {
+		return ResponseTimes{}, err
+	}
+
+	now := time.Now()
+	timelines, err := statusTimelines(s.db, r, now)
+	if err != nil {
+		return ResponseTimes{}, err
+	}
+
+	report := ResponseTimes{DateRange: r}
+	var responded, waiting []float64
+	for _, t := range timelines {
+		if t.periods[0].status != StatusApplied {
+			continue
+		}
+		i := slices.IndexFunc(t.periods, func(p statusPeriod) bool {
+			return slices.Contains(respondedStatuses, p.status)
+		})
+		switch {
+		case i >= 0:
+			responded = append(responded, days(t.periods[i].start.Sub(t.created)))
+		case t.periods[len(t.periods)-1].status == StatusApplied:
+			report.Awaiting++
+			waiting = append(waiting, days(now.Sub(t.created)))
+		default:
+			report.Awaiting++
+		}
+	}
+
+	report.Responded = summarize(responded)
+	report.WaitingSoFar = summarize(waiting)
+	if total := len(responded) + report.Awaiting; total > 0 {
+		report.ResponseRate = float64(len(responded)) / float64(total)
+	}
+	return report, nil
+}
+
+// GetTimeInStage reports how long the applications created within r spent in each status
+func (s *JobApplicationService) GetTimeInStage(r DateRange) ([]StageTime, error) {
+	var v validator
+	r.normalize(&v)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+
+	timelines, err := statusTimelines(s.db, r, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	completed := map[string][]float64{}
+	current := map[string][]float64{}
+	for _, t := range timelines {
+		for _, p := range t.periods {
+			d := days(p.end.Sub(p.start))
+			if p.ongoing {
+				current[p.status] = append(current[p.status], d)
+			} else {
+				completed[p.status] = append(completed[p.status], d)
+			}
+		}
+	}
+
+	stages := make([]StageTime, len(ValidStatuses))
+	for i, status := range ValidStatuses {
+		stages[i] = StageTime{Status: status, Completed: summarize(completed[status]), Current: summarize(current[status])}
+	}
+	return stages, nil
+}
+
+// GetGhostedApplications lists the applications on the board that are still applied or
+// interviewing but have not changed for the given number of days, longest silent first
+func (s *JobApplicationService) GetGhostedApplications(afterDays int) ([]GhostedApplication, error) {
+	if afterDays == 0 {
+		afterDays = DefaultGhostedAfterDays
+	}
+	if afterDays < 1 || afterDays > MaxGhostedAfterDays {
+		var v validator
+		v.add("days", "must be between 1 and %d", MaxGhostedAfterDays)
+		return nil, v.err()
+	}
+
+	apps, err := queryJobApplications(s.db, database.SelectGhostedStmt, afterDays)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	ghosted := make([]GhostedApplication, len(apps))
+	for i, app := range apps {
+		ghosted[i].JobApplication = app
+		if t, ok := parseTimestamp(app.UpdatedAt); ok {
+			ghosted[i].DaysSinceChange = roundDays(days(now.Sub(t)))
+		}
+	}
+	return ghosted, nil
+}
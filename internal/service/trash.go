@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// ArchiveJobApplication hides the application from the board while keeping it searchable.
+// expectedVersion behaves as for UpdateJobApplication.
+func (s *JobApplicationService) ArchiveJobApplication(id, expectedVersion int64) (JobApplication, error) {
+	return s.transition(database.ArchiveStmt, ActionArchived, id, expectedVersion)
+}
+
+// UnarchiveJobApplication puts an archived application back on the board
+func (s *JobApplicationService) UnarchiveJobApplication(id, expectedVersion int64) (JobApplication, error) {
+	return s.transition(database.UnarchiveStmt, ActionUnarchived, id, expectedVersion)
+}
+
+// transition runs a single transition in its own transaction
+func (s *JobApplicationService) transition(stmt, action string, id, expectedVersion int64) (JobApplication, error) {
+	m, err := s.begin()
+	if err != nil {
+		return JobApplication{}, err
+	}
+	defer m.Rollback()
+
+	app, err := m.transition(stmt, action, id, expectedVersion)
+	if err != nil {
+		return JobApplication{}, err
+	}
+	return app, m.Commit()
+}
+
+// GetTrash lists the applications in the trash, most recently deleted first
+func (s *JobApplicationService) GetTrash() ([]JobApplication, error) {
+	return queryJobApplications(s.db, database.SelectTrashStmt)
+}
+
+// RestoreJobApplication moves an application out of the trash
+func (s *JobApplicationService) RestoreJobApplication(id int64) (JobApplication, error) {
+	m, err := s.begin()
+	if err != nil {
+		return JobApplication{}, err
+	}
+	defer m.Rollback()
+
+	before, err := getAnyJobApplication(m, id)
+	if err != nil || before.DeletedAt == nil {
+		return JobApplication{}, notFound("trashed job application", id)
+	}
+
+	if _, err := m.Exec(database.RestoreStmt, id); err != nil {
+		return JobApplication{}, translateDBError(err)
+	}
+
+	after, err := getJobApplication(m, id)
+	if err != nil {
+		return JobApplication{}, err
+	}
+	if err := m.record(ActionRestored, &before, &after); err != nil {
+		return JobApplication{}, err
+	}
+	return after, m.Commit()
+}
+
+// PurgeJobApplication permanently deletes an application that is in the trash, along with its history
+func (s *JobApplicationService) PurgeJobApplication(id int64) error {
+	n, err := s.purge(database.PurgeStmt, id)
+	if err != nil {
+		return translateDBError(err)
+	}
+	if n == 0 {
+		return notFound("trashed job application", id)
+	}
+	return nil
+}
+
+// EmptyTrash permanently deletes every application in the trash and returns how many were removed
+func (s *JobApplicationService) EmptyTrash() (int64, error) {
+	return s.purge(database.PurgeAllStmt)
+}
+
+// PurgeExpiredTrash permanently deletes applications that have been in the trash for longer than retention
+func (s *JobApplicationService) PurgeExpiredTrash(retention time.Duration) (int64, error) {
+	return s.purge(database.PurgeExpiredStmt, int64(retention.Seconds()))
+}
+
+// purge runs a delete statement and drops the history and attachments of the removed applications
+func (s *JobApplicationService) purge(stmt string, args ...any) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, tx.Commit()
+	}
+	if _, err := tx.Exec(database.PurgeOrphanedChangesStmt); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// Attachment rows went with their applications, their files are removed unless shared
+	s.sweepAttachments()
+	return n, nil
+}
+
+// RunTrashPurger purges expired trash every interval until ctx is cancelled
+func (s *JobApplicationService) RunTrashPurger(ctx context.Context, retention, interval time.Duration) {
+	s.logger.Info("Trash purger started", "retention", retention.String(), "interval", interval.String())
+
+	purge := func() {
+		n, err := s.PurgeExpiredTrash(retention)
+		if err != nil {
+			s.logger.Error("Failed to purge expired trash", "error", err)
+			return
+		}
+		if n > 0 {
+			s.logger.Info("Purged expired trash", "count", n)
+		}
+	}
+
+	purge()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Trash purger stopped")
+			return
+		case <-ticker.C:
+			purge()
+		}
+	}
+}
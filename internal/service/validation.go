@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Application statuses accepted by the service
+const (
+	StatusApplied   = "applied"
+	StatusInterview = "interview"
+	StatusOffer     = "offer"
+	StatusRejected  = "rejected"
+	StatusGhosted   = "ghosted"
+)
+
+// ValidStatuses lists every accepted status, in pipeline order
+var ValidStatuses = []string{StatusApplied, StatusInterview, StatusOffer, StatusRejected, StatusGhosted}
+
+// Field limits enforced by Validate
+const (
+	MaxCompanyLength  = 200
+	MaxPositionLength = 200
+	MaxLinkLength     = 2048
+	MaxNotesLength    = 50000
+)
+
+// earliestDate is the oldest application date accepted, anything before is almost
+// certainly a typo or a mis-parsed date
+var earliestDate = time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// IsValidStatus reports whether status is one of ValidStatuses
+func IsValidStatus(status string) bool {
+	return slices.Contains(ValidStatuses, status)
+}
+
+// validator accumulates field errors so every violation is reported at once
+type validator struct {
+	prefix string
+	fields []FieldError
+}
+
+func (v *validator) add(field, format string, args ...any) {
+	v.fields = append(v.fields, FieldError{Field: v.prefix + field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(field, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) maxLength(field, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		v.add(field, "must be at most %d characters", max)
+	}
+}
+
+func (v *validator) url(field, value string) {
+	if value == "" {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(field, "must be an absolute http or https URL")
+	}
+}
+
+func (v *validator) oneOf(field, value string, allowed []string) {
+	if !slices.Contains(allowed, value) {
+		v.add(field, "must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+// date checks that value is a parsable timestamp that is neither implausibly old nor in the future
+func (v *validator) date(field, value string) {
+	if value == "" {
+		return
+	}
+	t, ok := parseTimestamp(value)
+	if !ok {
+		v.add(field, "must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+		return
+	}
+	if t.Before(earliestDate) {
+		v.add(field, "must not be before %s", earliestDate.Format(time.DateOnly))
+	}
+	// Allow a day of slack for clients in time zones ahead of the server
+	if t.After(time.Now().Add(24 * time.Hour)) {
+		v.add(field, "must not be in the future")
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+// parseTimestamp accepts the formats the API and SQLite produce for dates
+func parseTimestamp(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// normalize trims surrounding whitespace and lower-cases the status
+func (a *NewJobApplication) normalize() {
+	a.Company = strings.TrimSpace(a.Company)
+	a.Position = strings.TrimSpace(a.Position)
+	a.Link = strings.TrimSpace(a.Link)
+	a.Status = strings.ToLower(strings.TrimSpace(a.Status))
+	if a.Tags != nil {
+		a.Tags = normalizeTags(a.Tags)
+	}
+}
+
+func (a NewJobApplication) validate(v *validator) {
+	if v.required("company", a.Company) {
+		v.maxLength("company", a.Company, MaxCompanyLength)
+	}
+	if v.required("position", a.Position) {
+		v.maxLength("position", a.Position, MaxPositionLength)
+	}
+	v.maxLength("link", a.Link, MaxLinkLength)
+	v.url("link", a.Link)
+	if v.required("status", a.Status) {
+		v.oneOf("status", a.Status, ValidStatuses)
+	}
+	v.maxLength("notes", a.Notes, MaxNotesLength)
+	v.tags("tags", a.Tags)
+	if a.JobDescription != nil {
+		a.JobDescription.validate(v, "job_description")
+	}
+}
+
+// Validate returns a *ValidationError listing every invalid field, or nil
+func (a NewJobApplication) Validate() error {
+	var v validator
+	a.validate(&v)
+	return v.err()
+}
+
+func (a JobApplication) validate(v *validator) {
+	a.NewJobApplication.validate(v)
+	v.date("created_at", a.CreatedAt)
+}
+
+// Validate returns a *ValidationError listing every invalid field, or nil.
+// The ID is checked by the methods that need one.
+func (a JobApplication) Validate() error {
+	var v validator
+	a.validate(&v)
+	return v.err()
+}
@@ -0,0 +1,489 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rafrdz/ctrl-alt-me/internal/database"
+)
+
+// Webhook delivery statuses. Sending is the state of a test delivery while it is under way.
+const (
+	DeliveryPending   = "pending"
+	DeliverySending   = "sending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// EventPing is the event of test deliveries
+const EventPing = "ping"
+
+// Webhook limits and delivery settings
+const (
+	MaxWebhookDescriptionLength = 200
+	MinWebhookSecretLength      = 16
+	MaxWebhookSecretLength      = 200
+	// WebhookMaxAttempts is how often a delivery is tried before it is given up
+	WebhookMaxAttempts = 8
+	// WebhookRetryDelay is the wait before the first retry, it doubles with every further one
+	WebhookRetryDelay = 30 * time.Second
+	// WebhookTimeout limits how long a single attempt may take
+	WebhookTimeout = 10 * time.Second
+
+	DefaultWebhookDeliveryLimit = 50
+	MaxWebhookDeliveryLimit     = 500
+
+	webhookBatchSize       = 20
+	maxDeliveryErrorLength = 500
+)
+
+// WebhookInput is what a webhook is created or replaced from
+type WebhookInput struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+	// Secret signs the payloads. A random one is generated when a webhook is created without
+	// one, and the current one is kept when a webhook is replaced without one.
+	Secret string `json:"secret,omitempty"`
+	// Active defaults to true, inactive webhooks receive no events
+	Active *bool `json:"active,omitempty"`
+}
+
+// Webhook is a subscription of a URL to application events
+type Webhook struct {
+	ID          int64    `json:"id"`
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+	// Secret is only returned when it was generated or changed
+	Secret    string `json:"secret,omitempty"`
+	Active    bool   `json:"active"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// WebhookDelivery is an event sent, or still to be sent, to a webhook
+type WebhookDelivery struct {
+	ID        int64           `json:"id"`
+	WebhookID int64           `json:"webhook_id"`
+	Event     string          `json:"event"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	// NextAttemptAt is set while the delivery is pending
+	NextAttemptAt  *string `json:"next_attempt_at,omitempty"`
+	ResponseStatus *int    `json:"response_status,omitempty"`
+	Error          string  `json:"error,omitempty"`
+	CreatedAt      string  `json:"created_at"`
+	DeliveredAt    *string `json:"delivered_at,omitempty"`
+}
+
+func (in *WebhookInput) normalize() {
+	in.URL = strings.TrimSpace(in.URL)
+	in.Description = strings.TrimSpace(in.Description)
+	var events []string
+	for _, e := range in.Events {
+		if e = strings.ToLower(strings.TrimSpace(e)); !slices.Contains(events, e) {
+			events = append(events, e)
+		}
+	}
+	in.Events = events
+}
+
+func (in WebhookInput) validate(v *validator) {
+	if v.required("url", in.URL) {
+		v.url("url", in.URL)
+	}
+	v.maxLength("description", in.Description, MaxWebhookDescriptionLength)
+	if len(in.Events) == 0 {
+		v.add("events", "must list at least one of %s", strings.Join(EventTypes, ", "))
+	}
+	for i, e := range in.Events {
+		v.oneOf(fmt.Sprintf("events[%d]", i), e, EventTypes)
+	}
+	if in.Secret != "" && (len(in.Secret) < MinWebhookSecretLength || len(in.Secret) > MaxWebhookSecretLength) {
+		v.add("secret", "must be between %d and %d characters long", MinWebhookSecretLength, MaxWebhookSecretLength)
+	}
+}
+
+func newWebhookSecret() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func scanWebhook(row scanner) (Webhook, error) {
+	var w Webhook
+	var events string
+	if err := row.Scan(&w.ID, &w.URL, &w.Description, &events, &w.Secret, &w.Active, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		return Webhook{}, err
+	}
+	w.Events = strings.Split(events, ",")
+	return w, nil
+}
+
+// getWebhook returns a webhook including its secret
+func (s *JobApplicationService) getWebhook(id int64) (Webhook, error) {
+	w, err := scanWebhook(s.db.QueryRow(database.SelectWebhookStmt, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Webhook{}, notFound("webhook", id)
+	}
+	return w, err
+}
+
+// GetWebhooks lists the webhooks
+func (s *JobApplicationService) GetWebhooks() ([]Webhook, error) {
+	rows, err := s.db.Query(database.SelectWebhooksStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		w.Secret = ""
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// GetWebhook returns a webhook without its secret
+func (s *JobApplicationService) GetWebhook(id int64) (Webhook, error) {
+	w, err := s.getWebhook(id)
+	w.Secret = ""
+	return w, err
+}
+
+// CreateWebhook subscribes a URL to events. The returned webhook includes its secret.
+func (s *JobApplicationService) CreateWebhook(in WebhookInput) (Webhook, error) {
+	in.normalize()
+	var v validator
+	in.validate(&v)
+	if err := v.err(); err != nil {
+		return Webhook{}, err
+	}
+
+	if in.Secret == "" {
+		in.Secret = newWebhookSecret()
+	}
+	active := in.Active == nil || *in.Active
+	res, err := s.db.Exec(database.InsertWebhookStmt, in.URL, in.Description, strings.Join(in.Events, ","), in.Secret, active)
+	if err != nil {
+		return Webhook{}, translateDBError(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Webhook{}, err
+	}
+	return s.getWebhook(id)
+}
+
+// UpdateWebhook replaces a webhook. The returned webhook includes the secret if it was changed.
+func (s *JobApplicationService) UpdateWebhook(id int64, in WebhookInput) (Webhook, error) {
+	in.normalize()
+	var v validator
+	in.validate(&v)
+	if err := v.err(); err != nil {
+		return Webhook{}, err
+	}
+
+	current, err := s.getWebhook(id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	secret := in.Secret
+	if secret == "" {
+		secret = current.Secret
+	}
+	active := in.Active == nil || *in.Active
+	if _, err := s.db.Exec(database.UpdateWebhookStmt, in.URL, in.Description, strings.Join(in.Events, ","), secret, active, id); err != nil {
+		return Webhook{}, translateDBError(err)
+	}
+
+	w, err := s.getWebhook(id)
+	if in.Secret == "" {
+		w.Secret = ""
+	}
+	return w, err
+}
+
+// DeleteWebhook removes a webhook with its delivery log
+func (s *JobApplicationService) DeleteWebhook(id int64) error {
+	res, err := s.db.Exec(database.DeleteWebhookStmt, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound("webhook", id)
+	}
+	return nil
+}
+
+func scanWebhookDelivery(row scanner) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var payload, nextAttemptAt string
+	var responseStatus sql.NullInt64
+	err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &nextAttemptAt,
+		&responseStatus, &d.Error, &d.CreatedAt, &d.DeliveredAt)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	d.Payload = json.RawMessage(payload)
+	if d.Status == DeliveryPending {
+		d.NextAttemptAt = &nextAttemptAt
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		d.ResponseStatus = &status
+	}
+	return d, nil
+}
+
+// GetWebhookDeliveries lists the most recent deliveries of a webhook, newest first
+func (s *JobApplicationService) GetWebhookDeliveries(id int64, limit int) ([]WebhookDelivery, error) {
+	if limit == 0 {
+		limit = DefaultWebhookDeliveryLimit
+	}
+	if limit < 1 || limit > MaxWebhookDeliveryLimit {
+		var v validator
+		v.add("limit", "must be between 1 and %d", MaxWebhookDeliveryLimit)
+		return nil, v.err()
+	}
+	if _, err := s.getWebhook(id); err != nil {
+		return nil, err
+	}
+	return s.queryWebhookDeliveries(database.SelectWebhookDeliveriesStmt, id, limit)
+}
+
+func (s *JobApplicationService) queryWebhookDeliveries(query string, args ...any) ([]WebhookDelivery, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// enqueueWebhooks queues the event for every webhook subscribed to it, as part of the mutation
+// so it is only sent if the change is committed
+func (m *mutation) enqueueWebhooks(e Event) error {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	res, err := m.Exec(database.EnqueueWebhookDeliveriesStmt, e.Type, string(payload))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		m.webhooksQueued = true
+	}
+	return nil
+}
+
+// wakeWebhookDispatcher signals the dispatcher that deliveries are waiting
+func (s *JobApplicationService) wakeWebhookDispatcher() {
+	select {
+	case s.webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// TestWebhook sends a ping event to a webhook right away, whether or not it is active, and
+// returns the logged delivery. Test deliveries are not retried.
+func (s *JobApplicationService) TestWebhook(ctx context.Context, id int64) (WebhookDelivery, error) {
+	w, err := s.getWebhook(id)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"event":       EventPing,
+		"occurred_at": time.Now().UTC().Format(time.RFC3339),
+		"webhook_id":  w.ID,
+	})
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	res, err := s.db.Exec(database.InsertWebhookDeliveryStmt, w.ID, EventPing, string(payload))
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	deliveryID, err := res.LastInsertId()
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	d, err := scanWebhookDelivery(s.db.QueryRow(database.SelectWebhookDeliveryStmt, deliveryID))
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	// The outcome is recorded even if the caller goes away in the meantime
+	if err := s.attemptDelivery(context.WithoutCancel(ctx), w, d, false); err != nil {
+		return WebhookDelivery{}, err
+	}
+	return scanWebhookDelivery(s.db.QueryRow(database.SelectWebhookDeliveryStmt, deliveryID))
+}
+
+// Sign returns the signature of a webhook payload sent at timestamp (Unix seconds), as found in
+// the X-Webhook-Signature header: the hex encoded HMAC-SHA256 of the timestamp, a dot and the
+// payload, keyed with the webhook's secret
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// send posts a delivery to its webhook and returns the response status, if there was a response
+func (s *JobApplicationService) send(ctx context.Context, w Webhook, d WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ctrl-alt-me-webhooks")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", Sign(w.Secret, timestamp, d.Payload))
+
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Read some of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryDelay is the wait before the next attempt after the given number of failed ones
+func retryDelay(attempts int) time.Duration {
+	return WebhookRetryDelay << (attempts - 1)
+}
+
+// attemptDelivery sends a delivery once and records the outcome. Failed deliveries are
+// scheduled for another attempt if retry is set and attempts are left.
+func (s *JobApplicationService) attemptDelivery(ctx context.Context, w Webhook, d WebhookDelivery, retry bool) error {
+	responseStatus, sendErr := s.send(ctx, w, d)
+	if ctx.Err() != nil {
+		// Shutting down: leave the delivery as it was so it is tried again after a restart
+		return nil
+	}
+
+	attempts := d.Attempts + 1
+	status, delay, message := DeliverySucceeded, time.Duration(0), ""
+	if sendErr != nil {
+		message = sendErr.Error()
+		if len(message) > maxDeliveryErrorLength {
+			message = message[:maxDeliveryErrorLength]
+		}
+		status = DeliveryFailed
+		if retry && attempts < WebhookMaxAttempts {
+			status, delay = DeliveryPending, retryDelay(attempts)
+		}
+		s.logger.Warn("Webhook delivery failed", "webhook", w.ID, "delivery", d.ID, "attempt", attempts, "status", status, "error", message)
+	} else {
+		s.logger.Debug("Webhook delivered", "webhook", w.ID, "delivery", d.ID, "attempt", attempts)
+	}
+
+	var code sql.NullInt64
+	if responseStatus != 0 {
+		code = sql.NullInt64{Int64: int64(responseStatus), Valid: true}
+	}
+	_, err := s.db.Exec(database.UpdateWebhookDeliveryStmt, status, attempts, code, message, int(delay.Seconds()), d.ID)
+	return err
+}
+
+// deliverDue attempts a batch of the deliveries that are due and reports whether a full batch was found
+func (s *JobApplicationService) deliverDue(ctx context.Context) bool {
+	due, err := s.queryWebhookDeliveries(database.SelectDueWebhookDeliveriesStmt, webhookBatchSize)
+	if err != nil {
+		s.logger.Error("Failed to list due webhook deliveries", "error", err)
+		return false
+	}
+
+	webhooks := map[int64]Webhook{}
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return false
+		}
+		w, ok := webhooks[d.WebhookID]
+		if !ok {
+			if w, err = s.getWebhook(d.WebhookID); err != nil {
+				s.logger.Error("Failed to load webhook", "webhook", d.WebhookID, "error", err)
+				return false
+			}
+			webhooks[d.WebhookID] = w
+		}
+		if err := s.attemptDelivery(ctx, w, d, true); err != nil {
+			s.logger.Error("Failed to record webhook delivery", "delivery", d.ID, "error", err)
+			return false
+		}
+	}
+	return len(due) == webhookBatchSize
+}
+
+// RunWebhookDispatcher sends queued webhook deliveries as they are queued and retries failed
+// ones every interval until ctx is cancelled
+func (s *JobApplicationService) RunWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	s.logger.Info("Webhook dispatcher started", "interval", interval.String())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for s.deliverDue(ctx) {
+			if ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("Webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+		case <-s.webhookWake:
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver is a webhook endpoint that checks the signature of every request the way a
+// receiver would and answers with the status codes it is given, the last one repeatedly
+type webhookReceiver struct {
+	t      *testing.T
+	secret string
+
+	mu       sync.Mutex
+	statuses []int
+	received []http.Header
+}
+
+func newWebhookReceiver(t *testing.T, secret string, statuses ...int) (*webhookReceiver, *httptest.Server) {
+	rec := &webhookReceiver{t: t, secret: secret, statuses: statuses}
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+	return rec, srv
+}
+
+func (rec *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rec.t.Errorf("read webhook body: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte(rec.secret))
+	mac.Write([]byte(r.Header.Get("X-Webhook-Timestamp") + "." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); !hmac.Equal([]byte(r.Header.Get("X-Webhook-Signature")), []byte(want)) {
+		rec.t.Errorf("signature %q, want %q", r.Header.Get("X-Webhook-Signature"), want)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.received = append(rec.received, r.Header.Clone())
+	status := rec.statuses[0]
+	if len(rec.statuses) > 1 {
+		rec.statuses = rec.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rec *webhookReceiver) requests() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.received)
+}
+
+const testWebhookSecret = "0123456789abcdef-secret"
+
+func mustCreateWebhook(t *testing.T, svc *JobApplicationService, url string) Webhook {
+	t.Helper()
+	w, err := svc.CreateWebhook(WebhookInput{URL: url, Events: []string{EventCreated}, Secret: testWebhookSecret})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	return w
+}
+
+// lastDelivery returns the most recent delivery of a webhook
+func lastDelivery(t *testing.T, svc *JobApplicationService, webhookID int64) WebhookDelivery {
+	t.Helper()
+	deliveries, err := svc.GetWebhookDeliveries(webhookID, 1)
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries: %v", err)
+	}
+	if len(deliveries) == 0 {
+		t.Fatal("no deliveries")
+	}
+	return deliveries[0]
+}
+
+// makeDue moves the next attempt of every pending delivery into the past
+func makeDue(t *testing.T, svc *JobApplicationService) {
+	t.Helper()
+	if _, err := svc.db.Exec(`UPDATE webhook_deliveries SET next_attempt_at = datetime('now', '-1 seconds') WHERE status = 'pending'`); err != nil {
+		t.Fatalf("make deliveries due: %v", err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// Computed independently with: printf '1700000000.{"event":"ping"}' | openssl dgst -sha256 -hmac "0123456789abcdef-secret"
+	got := Sign(testWebhookSecret, 1700000000, []byte(`{"event":"ping"}`))
+	if want := "sha256=2ca9406507578889a90d304d3ae6dc4e8cd6a1bececb889e07df1d7397f962c7"; got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+	if Sign("another-secret-0123", 1700000000, []byte(`{"event":"ping"}`)) == got {
+		t.Error("signature does not depend on the secret")
+	}
+	if Sign(testWebhookSecret, 1700000001, []byte(`{"event":"ping"}`)) == got {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	want := WebhookRetryDelay
+	for attempts := 1; attempts < WebhookMaxAttempts; attempts++ {
+		if got := retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+		want *= 2
+	}
+}
+
+// A delivery answered with an error status is logged as failed and retried until it succeeds
+func TestWebhookDeliveryRetriesFailedResponses(t *testing.T) {
+	svc := newTestService(t)
+	rec, srv := newWebhookReceiver(t, testWebhookSecret, http.StatusInternalServerError, http.StatusNoContent)
+	w := mustCreateWebhook(t, svc, srv.URL)
+	mustCreate(t, svc, NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusApplied})
+
+	svc.deliverDue(context.Background())
+	d := lastDelivery(t, svc, w.ID)
+	if d.Status != DeliveryPending || d.Attempts != 1 || d.ResponseStatus == nil || *d.ResponseStatus != http.StatusInternalServerError || d.Error == "" {
+		t.Fatalf("after a 500: status %s, attempts %d, response %v, error %q", d.Status, d.Attempts, d.ResponseStatus, d.Error)
+	}
+	next, err := time.Parse(time.RFC3339, *d.NextAttemptAt)
+	if err != nil {
+		t.Fatalf("next_attempt_at %q: %v", *d.NextAttemptAt, err)
+	}
+	if wait := time.Until(next); wait < WebhookRetryDelay-5*time.Second || wait > WebhookRetryDelay+5*time.Second {
+		t.Errorf("retried in %v, want about %v", wait, WebhookRetryDelay)
+	}
+
+	// Not due yet
+	svc.deliverDue(context.Background())
+	if n := rec.requests(); n != 1 {
+		t.Fatalf("%d requests before the retry was due, want 1", n)
+	}
+
+	makeDue(t, svc)
+	svc.deliverDue(context.Background())
+	d = lastDelivery(t, svc, w.ID)
+	if d.Status != DeliverySucceeded || d.Attempts != 2 || d.DeliveredAt == nil || d.Error != "" {
+		t.Errorf("after the retry: status %s, attempts %d, delivered %v, error %q", d.Status, d.Attempts, d.DeliveredAt, d.Error)
+	}
+	if n := rec.requests(); n != 2 {
+		t.Errorf("%d requests, want 2", n)
+	}
+	if got := rec.received[0].Get("X-Webhook-Event"); got != EventCreated {
+		t.Errorf("X-Webhook-Event = %q, want %q", got, EventCreated)
+	}
+}
+
+func TestWebhookDeliveryGivesUpAfterMaxAttempts(t *testing.T) {
+	svc := newTestService(t)
+	rec, srv := newWebhookReceiver(t, testWebhookSecret, http.StatusServiceUnavailable)
+	w := mustCreateWebhook(t, svc, srv.URL)
+	mustCreate(t, svc, NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusApplied})
+
+	for i := 1; i <= WebhookMaxAttempts+2; i++ {
+		makeDue(t, svc)
+		svc.deliverDue(context.Background())
+	}
+
+	d := lastDelivery(t, svc, w.ID)
+	if d.Status != DeliveryFailed || d.Attempts != WebhookMaxAttempts || d.NextAttemptAt != nil {
+		t.Errorf("status %s, attempts %d, next attempt %v, want failed after %d attempts", d.Status, d.Attempts, d.NextAttemptAt, WebhookMaxAttempts)
+	}
+	if n := rec.requests(); n != WebhookMaxAttempts {
+		t.Errorf("%d requests, want %d", n, WebhookMaxAttempts)
+	}
+}
+
+func TestTestWebhookIsNotRetried(t *testing.T) {
+	svc := newTestService(t)
+	rec, srv := newWebhookReceiver(t, testWebhookSecret, http.StatusBadGateway, http.StatusOK)
+	w := mustCreateWebhook(t, svc, srv.URL)
+
+	d, err := svc.TestWebhook(context.Background(), w.ID)
+	if err != nil {
+		t.Fatalf("TestWebhook: %v", err)
+	}
+	if d.Event != EventPing || d.Status != DeliveryFailed || d.Attempts != 1 || d.NextAttemptAt != nil ||
+		d.ResponseStatus == nil || *d.ResponseStatus != http.StatusBadGateway {
+		t.Errorf("event %s, status %s, attempts %d, next attempt %v, response %v", d.Event, d.Status, d.Attempts, d.NextAttemptAt, d.ResponseStatus)
+	}
+
+	makeDue(t, svc)
+	svc.deliverDue(context.Background())
+	if n := rec.requests(); n != 1 {
+		t.Errorf("%d requests, want the test delivery only", n)
+	}
+	if got := rec.received[0].Get("X-Webhook-Event"); got != EventPing {
+		t.Errorf("X-Webhook-Event = %q, want %q", got, EventPing)
+	}
+}
+
+func TestQueueDueReminders(t *testing.T) {
+	svc := newTestService(t)
+	rec, srv := newWebhookReceiver(t, testWebhookSecret, http.StatusOK)
+	w, err := svc.CreateWebhook(WebhookInput{URL: srv.URL, Events: []string{EventReminderDue}, Secret: testWebhookSecret})
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	changes := mustCreateWebhook(t, svc, srv.URL)
+
+	quiet := mustCreate(t, svc, NewJobApplication{Company: "Acme", Position: "Engineer", Status: StatusApplied})
+	mustCreate(t, svc, NewJobApplication{Company: "Globex", Position: "Engineer", Status: StatusApplied})
+	if _, err := svc.db.Exec(`UPDATE job_applications SET updated_at = datetime('now', '-20 days') WHERE id = ?`, quiet.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	queued, err := svc.QueueDueReminders(14)
+	if err != nil || queued != 1 {
+		t.Fatalf("QueueDueReminders = %d, %v, want 1", queued, err)
+	}
+	// Each reminder is sent once
+	if queued, err := svc.QueueDueReminders(14); err != nil || queued != 0 {
+		t.Fatalf("second QueueDueReminders = %d, %v, want 0", queued, err)
+	}
+
+	svc.deliverDue(context.Background())
+	d := lastDelivery(t, svc, w.ID)
+	if d.Event != EventReminderDue || d.Status != DeliverySucceeded {
+		t.Errorf("delivery %s is %s", d.Event, d.Status)
+	}
+	var e Event
+	if err := json.Unmarshal(d.Payload, &e); err != nil {
+		t.Fatalf("payload %s: %v", d.Payload, err)
+	}
+	if e.Type != EventReminderDue || e.Application == nil || e.Application.ID != quiet.ID || e.DaysSinceChange < 19 {
+		t.Errorf("payload %s", d.Payload)
+	}
+
+	// Webhooks that did not subscribe to reminders only get the changes
+	deliveries, err := svc.GetWebhookDeliveries(changes.ID, 0)
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries: %v", err)
+	}
+	for _, d := range deliveries {
+		if d.Event != EventCreated {
+			t.Errorf("webhook subscribed to %v got %s", changes.Events, d.Event)
+		}
+	}
+	if n := rec.requests(); n != 1+len(deliveries) {
+		t.Errorf("%d requests, want %d", n, 1+len(deliveries))
+	}
+}
@@ -0,0 +1,144 @@
+// Package storage keeps uploaded files on disk, addressed by the SHA-256 of their content
+// so identical uploads are stored only once.
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrTooLarge is returned by Put when the content exceeds the store's size limit
+var ErrTooLarge = errors.New("file too large")
+
+// Store is a content-addressed file store rooted at a directory
+type Store struct {
+	dir     string
+	maxSize int64
+	mu      sync.Mutex
+}
+
+// Blob describes stored content
+type Blob struct {
+	Hash string
+	Size int64
+}
+
+// NewStore creates dir if needed and returns a store accepting files of up to maxSize bytes
+func NewStore(dir string, maxSize int64) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, maxSize: maxSize}, nil
+}
+
+// MaxSize returns the largest accepted file size in bytes
+func (s *Store) MaxSize() int64 {
+	return s.maxSize
+}
+
+// path spreads blobs over subdirectories named after the first two hex digits of their hash
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash)
+}
+
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+// Put stores the content of r, returning its hash and size. Content that is already
+// stored is not written again.
+func (s *Store) Put(r io.Reader) (Blob, error) {
+	tmp, err := os.CreateTemp(s.dir, "upload-*")
+	if err != nil {
+		return Blob{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	// Read one byte past the limit to tell a file of exactly maxSize from a larger one
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(r, s.maxSize+1))
+	if err != nil {
+		return Blob{}, err
+	}
+	if n > s.maxSize {
+		return Blob{}, fmt.Errorf("%w: limit is %d bytes", ErrTooLarge, s.maxSize)
+	}
+	if err := tmp.Sync(); err != nil {
+		return Blob{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Blob{}, err
+	}
+
+	blob := Blob{Hash: hex.EncodeToString(h.Sum(nil)), Size: n}
+	dest := s.path(blob.Hash)
+	if _, err := os.Stat(dest); err == nil {
+		return blob, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return Blob{}, err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return Blob{}, err
+	}
+	return blob, nil
+}
+
+// Open returns the stored content with the given hash
+func (s *Store) Open(hash string) (*os.File, error) {
+	if !validHash(hash) {
+		return nil, fs.ErrNotExist
+	}
+	return os.Open(s.path(hash))
+}
+
+// Remove deletes the content with the given hash, if stored
+func (s *Store) Remove(hash string) error {
+	if !validHash(hash) {
+		return nil
+	}
+	err := os.Remove(s.path(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Sweep removes every stored blob for which inUse returns false and returns how many were removed
+func (s *Store) Sweep(inUse func(hash string) bool) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !validHash(d.Name()) {
+			return err
+		}
+		if inUse(d.Name()) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return removed, err
+}
+
+// Do runs fn while holding the store's lock. Callers pair writes and removals with the
+// bookkeeping that references the blobs, so a blob is never removed while being claimed.
+func (s *Store) Do(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn()
+}